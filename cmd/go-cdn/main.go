@@ -4,15 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"go-cdn/internal/auth"
 	"go-cdn/internal/config"
 	"go-cdn/internal/database/controller"
 	"go-cdn/internal/database/repository/postgres"
 	"go-cdn/internal/database/repository/redis"
 	"go-cdn/internal/discovery/controller"
 	"go-cdn/internal/discovery/repository"
+	"go-cdn/internal/fetch"
 	"go-cdn/internal/logger"
+	"go-cdn/internal/metrics"
+	"go-cdn/internal/ratelimit"
 	"go-cdn/internal/server"
+	"go-cdn/internal/stats"
 	"go-cdn/internal/tracing"
+	"go-cdn/internal/warmup"
+	"go-cdn/pkg/signedurl"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,10 +29,10 @@ func main() {
 	cfg, err := config.New()
 
 	// Logger (File with rotation + Console)
-	sugar := logger.NewLogger(cfg)
+	sugar, log_levels := logger.NewLogger(cfg)
 	defer sugar.Sync()
 
-	// Print loaded configs after logger initialization
+	// Print loaded configs after logger initialization, the secrets are tagged json:"-" and left out
 	if err != nil {
 		sugar.Errorw("config load", "err", err)
 	}
@@ -85,19 +92,139 @@ func main() {
 	}
 	db := database.New(pg_repo)
 	defer db.Close()
+	if cfg.Metrics.MetricsEnable || cfg.Telemetry.TelemetryEnable {
+		metrics.RegisterPostgres(pg_repo.DB())
+	}
 
 	// Cache Repo
 	var cache *database.Controller
+	var egress_buffer *database.EgressBuffer
+	var rate_limiter ratelimit.Limiter
 	if cfg.Cache.RedisEnable {
 		rd_repo, err := redis.New(mctx, dc, cfg)
 		if err != nil {
 			sugar.Panicw("redis repo creation", "err", err)
 		}
 		cache = database.New(rd_repo)
+		if cfg.Metrics.MetricsEnable || cfg.Telemetry.TelemetryEnable {
+			metrics.RegisterRedis(rd_repo.PoolStats)
+		}
+		egress_buffer = database.NewEgressBuffer(rd_repo)
+
+		if cfg.RateLimit.RateLimitEnable && cfg.RateLimit.RateLimitStore == "redis" {
+			rate_limiter = rd_repo
+		}
+	}
+
+	// In-place updates, soft deletion, buckets and quotas, previous versions and trashed files are kept on the database
+	server_opts := []server.ServerOpt{
+		server.WithVersions(database.NewVersionController(pg_repo, cfg.Versions.VersionsKeep)),
+		server.WithTrash(database.NewTrashController(pg_repo, cfg.Trash.TrashRetention)),
+		server.WithAccess(database.NewAccessController(pg_repo)),
+		server.WithBuckets(database.NewBucketController(pg_repo)),
+		server.WithUsage(database.NewUsageController(pg_repo)),
+	}
+	server_opts = append(server_opts, server.WithLogLevels(log_levels))
+
+	// Access Statistics and Cache Warm-up
+	if cfg.Warmup.WarmupEnable {
+		bg_ctx, cancel := context.WithCancel(mctx)
+		defer cancel()
+
+		stats_ctl := database.NewStatsController(pg_repo)
+		hits := stats.NewHitCounter(stats_ctl, sugar)
+		go hits.Run(bg_ctx, cfg.Warmup.WarmupFlushInterval)
+		defer func() {
+			if err := hits.Flush(context.Background()); err != nil {
+				sugar.Errorw("hits flush", "err", err)
+			}
+		}()
+		server_opts = append(server_opts, server.WithHitCounter(hits))
+
+		if cache != nil {
+			warmer := warmup.New(db, cache, stats_ctl, cfg.Warmup.WarmupRate, sugar)
+			server_opts = append(server_opts, server.WithWarmer(warmer))
+
+			if cfg.Warmup.WarmupOnStartup {
+				err := warmer.Start(bg_ctx, warmup.Request{
+					Strategy: cfg.Warmup.WarmupStrategy,
+					Count:    cfg.Warmup.WarmupCount,
+					Hashes:   cfg.Warmup.WarmupHashes,
+				})
+				if err != nil {
+					sugar.Errorw("warmup start", "err", err)
+				}
+			}
+		}
+	}
+
+	// Rate Limiting, each instance keeps its own budgets unless they are shared through redis
+	if rate_limiter != nil {
+		server_opts = append(server_opts, server.WithRateLimiter(rate_limiter))
+	} else if cfg.RateLimit.RateLimitEnable && cfg.RateLimit.RateLimitStore == "redis" {
+		sugar.Warnw("rate limit store requires redis, using local budgets")
+	}
+
+	// Bandwidth Accounting, aggregated across instances through redis when available
+	if cfg.Egress.EgressEnable {
+		bg_ctx, cancel := context.WithCancel(mctx)
+		defer cancel()
+
+		traffic := database.NewEgressController(pg_repo)
+		egress := stats.NewEgressCounter(traffic, egress_buffer, cfg.Egress.EgressPeriod, sugar)
+		go egress.Run(bg_ctx, cfg.Egress.EgressFlushInterval)
+		defer func() {
+			if err := egress.Flush(context.Background()); err != nil {
+				sugar.Errorw("egress flush", "err", err)
+			}
+		}()
+		server_opts = append(server_opts, server.WithEgress(egress, traffic))
+	}
+
+	// Resumable Uploads
+	if cfg.Tus.TusEnable {
+		server_opts = append(server_opts, server.WithUploads(database.NewUploadController(pg_repo)))
+	}
+
+	// Remote Fetch
+	if cfg.Fetch.FetchEnable {
+		fetcher, err := fetch.New(cfg)
+		if err != nil {
+			sugar.Panicw("fetcher creation", "err", err)
+		}
+		server_opts = append(server_opts, server.WithFetcher(fetcher))
+	}
+
+	// Signed URLs
+	if len(cfg.Signing.SigningKeys) > 0 {
+		keys := []signedurl.Key{}
+		for _, k := range cfg.Signing.SigningKeys {
+			keys = append(keys, signedurl.Key{ID: k.ID, Secret: k.Secret})
+		}
+		signer, err := signedurl.New(keys, cfg.Signing.SigningActiveKey)
+		if err != nil {
+			sugar.Panicw("signer creation", "err", err)
+		}
+		server_opts = append(server_opts, server.WithSigner(signer))
+	}
+
+	// Authentication
+	if cfg.Auth.AuthEnable {
+		keys := database.NewKeyController(pg_repo)
+		authenticator := auth.NewAPIKeyAuthenticator(keys, cfg.Auth.AuthAdminKey, cfg.Auth.AuthCacheTTL)
+		server_opts = append(server_opts, server.WithAPIKeys(keys, authenticator))
+
+		if cfg.Auth.JWT.JWTEnable {
+			bearer, err := auth.NewJWTAuthenticator(mctx, cfg, sugar)
+			if err != nil {
+				sugar.Panicw("jwt authenticator creation", "err", err)
+			}
+			server_opts = append(server_opts, server.WithBearerAuth(bearer))
+		}
 	}
 
 	// Gin Setup
-	ginServer := server.New(cfg, db, cache, sugar)
+	ginServer := server.New(cfg, db, cache, sugar, server_opts...)
 	ginServer.Spawn(
 		server.WithMode(gin.ReleaseMode),
 	)
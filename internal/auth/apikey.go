@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go-cdn/internal/database/controller"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	keyIDLength     = 8
+	keySecretLength = 32
+)
+
+// APIKeyAuthenticator validates keys in the form <key_id>.<secret> against their hashes stored on the database.
+// Valid lookups are cached for a short time, so a revocation takes effect within the cache TTL
+type APIKeyAuthenticator struct {
+	keys      *database.KeyController
+	admin_key string
+	ttl       time.Duration
+	mu        sync.Mutex
+	cache     map[string]cachedPrincipal
+}
+
+type cachedPrincipal struct {
+	principal *Principal
+	hash      string
+	expires   time.Time
+}
+
+func NewAPIKeyAuthenticator(keys *database.KeyController, admin_key string, ttl time.Duration) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		keys:      keys,
+		admin_key: admin_key,
+		ttl:       ttl,
+		cache:     map[string]cachedPrincipal{},
+	}
+}
+
+// GenerateKey creates a new random key, returning the id, the full key to hand out and the hash to store
+func GenerateKey() (string, string, string, error) {
+	id := make([]byte, keyIDLength/2)
+	secret := make([]byte, keySecretLength)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	key_id := hex.EncodeToString(id)
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	return key_id, key_id + "." + encoded, hashSecret(encoded), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, credentials string) (*Principal, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "auth/APIKeyAuthenticator")
+	defer span.End()
+
+	// Static bootstrap key from configs, used to create the first keys
+	if a.admin_key != "" && subtle.ConstantTimeCompare([]byte(credentials), []byte(a.admin_key)) == 1 {
+		return &Principal{Subject: "admin", Method: "admin_key", Scopes: []Scope{ScopeAdmin}}, nil
+	}
+
+	key_id, secret, found := strings.Cut(credentials, ".")
+	if !found || key_id == "" || secret == "" {
+		return nil, ErrUnauthenticated
+	}
+	span.SetAttributes(attribute.String("auth.key_id", key_id))
+	hash := hashSecret(secret)
+
+	a.mu.Lock()
+	cached, ok := a.cache[key_id]
+	a.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(cached.hash)) != 1 {
+			return nil, ErrUnauthenticated
+		}
+		return cached.principal, nil
+	}
+
+	key, err := a.keys.GetKey(ctx, key_id)
+	if errors.Is(err, repository.ErrKeyDoesNotExist) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, ErrUnauthenticated
+	}
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(key.Hash)) != 1 {
+		return nil, ErrUnauthenticated
+	}
+
+	scopes, err := ParseScopes(key.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	principal := &Principal{Subject: "key:" + key.KeyID, Method: "api_key", Scopes: scopes, Bucket: key.Bucket}
+
+	expires := now.Add(a.ttl)
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(expires) {
+		expires = *key.ExpiresAt
+	}
+	a.mu.Lock()
+	a.cache[key_id] = cachedPrincipal{principal: principal, hash: key.Hash, expires: expires}
+	a.mu.Unlock()
+
+	return principal, nil
+}
+
+// Forget drops a key from the cache, so that a revocation on this instance is effective immediately
+func (a *APIKeyAuthenticator) Forget(key_id string) {
+	a.mu.Lock()
+	delete(a.cache, key_id)
+	a.mu.Unlock()
+}
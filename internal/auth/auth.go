@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+type Scope string
+
+const (
+	ScopeRead   = Scope("read")
+	ScopeWrite  = Scope("write")
+	ScopeDelete = Scope("delete")
+	ScopeAdmin  = Scope("admin") // Implies all the other scopes
+)
+
+var ErrUnauthenticated = errors.New("missing or invalid credentials")
+var ErrInvalidScope = errors.New("unknown scope")
+
+// Principal is the authenticated identity behind a request
+type Principal struct {
+	Subject string
+	Method  string // How the principal was authenticated, e.g. api_key
+	Scopes  []Scope
+	Bucket  string // Bucket the credentials are restricted to, empty for all
+}
+
+func (p *Principal) Has(scope Scope) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator resolves the credentials of a request into a Principal. It returns ErrUnauthenticated
+// if the credentials are not valid
+type Authenticator interface {
+	Authenticate(ctx context.Context, credentials string) (*Principal, error)
+}
+
+// ParseScopes validates a list of scope names
+func ParseScopes(names []string) ([]Scope, error) {
+	scopes := []Scope{}
+	for _, name := range names {
+		switch s := Scope(name); s {
+		case ScopeRead, ScopeWrite, ScopeDelete, ScopeAdmin:
+			scopes = append(scopes, s)
+		default:
+			return nil, ErrInvalidScope
+		}
+	}
+	return scopes, nil
+}
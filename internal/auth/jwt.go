@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-cdn/internal/config"
+	"go-cdn/internal/tracing"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// Unknown key ids and stale sets trigger a refresh of the key set, at most once in this interval even if
+// the source is unreachable
+const jwksMinRefreshInterval = time.Minute
+
+var ErrUnknownKey = errors.New("token signed with an unknown key")
+
+// JWTAuthenticator validates bearer tokens against a JSON Web Key Set, read from a file or an url,
+// and maps the claims of the token to scopes
+type JWTAuthenticator struct {
+	source        string
+	refresh       time.Duration
+	subject_claim string
+	scope_claim   string
+	mapping       map[string][]Scope
+	parser        *jwt.Parser
+	client        *http.Client
+	sugar         *zap.SugaredLogger
+	mu            sync.RWMutex
+	keys          map[string]any
+	fetched       time.Time
+	attempted     time.Time // Last refresh, failed or not
+	refreshing    singleflight.Group
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func NewJWTAuthenticator(ctx context.Context, cfg *config.Config, sugar *zap.SugaredLogger) (*JWTAuthenticator, error) {
+	jcfg := cfg.Auth.JWT
+
+	mapping := map[string][]Scope{}
+	for claim, names := range jcfg.JWTScopeMapping {
+		scopes, err := ParseScopes(names)
+		if err != nil {
+			return nil, fmt.Errorf("scope mapping %s: %w", claim, err)
+		}
+		mapping[claim] = scopes
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "PS256", "PS384", "PS512"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jcfg.JWTLeeway),
+	}
+	if jcfg.JWTIssuer != "" {
+		opts = append(opts, jwt.WithIssuer(jcfg.JWTIssuer))
+	}
+	if jcfg.JWTAudience != "" {
+		opts = append(opts, jwt.WithAudience(jcfg.JWTAudience))
+	}
+
+	a := &JWTAuthenticator{
+		source:        jcfg.JWTJWKS,
+		refresh:       jcfg.JWTRefreshInterval,
+		subject_claim: jcfg.JWTSubjectClaim,
+		scope_claim:   jcfg.JWTScopeClaim,
+		mapping:       mapping,
+		parser:        jwt.NewParser(opts...),
+		client:        &http.Client{Timeout: 10 * time.Second, Transport: &tracing.Transport{}},
+		sugar:         sugar,
+	}
+
+	if err := a.loadKeys(ctx); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, credentials string) (*Principal, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "auth/JWTAuthenticator")
+	defer span.End()
+
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(credentials, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return a.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", err.Error(), ErrUnauthenticated)
+	}
+
+	subject, _ := claims[a.subject_claim].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("missing claim %s: %w", a.subject_claim, ErrUnauthenticated)
+	}
+	span.SetAttributes(attribute.String("auth.subject", subject))
+
+	return &Principal{Subject: subject, Method: "jwt", Scopes: a.scopes(claims)}, nil
+}
+
+// Maps the values of the scope claim, either a space separated string or a list, to scopes.
+// Without a mapping, values matching a scope name are used as is
+func (a *JWTAuthenticator) scopes(claims jwt.MapClaims) []Scope {
+	values := []string{}
+	switch v := claims[a.scope_claim].(type) {
+	case string:
+		values = strings.Fields(v)
+	case []any:
+		for _, s := range v {
+			if str, ok := s.(string); ok {
+				values = append(values, str)
+			}
+		}
+	}
+
+	scopes := []Scope{}
+	for _, value := range values {
+		if len(a.mapping) > 0 {
+			scopes = append(scopes, a.mapping[strings.ToLower(value)]...)
+			continue
+		}
+		if s, err := ParseScopes([]string{value}); err == nil {
+			scopes = append(scopes, s...)
+		}
+	}
+	return scopes
+}
+
+// Returns the key with the given id, refreshing the set if it's stale or the id is unknown
+func (a *JWTAuthenticator) key(ctx context.Context, kid string) (any, error) {
+	a.mu.RLock()
+	key, ok := a.keys[kid]
+	stale := a.refresh > 0 && time.Since(a.fetched) > a.refresh
+	recent := time.Since(a.attempted) < jwksMinRefreshInterval
+	a.mu.RUnlock()
+
+	if (!ok || stale) && !recent {
+		// Concurrent requests wait for the same refresh. It's detached from the request that started it,
+		// whose cancellation would fail the others too
+		refresh_ctx := trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+		_, err, _ := a.refreshing.Do("jwks", func() (any, error) {
+			return nil, a.loadKeys(refresh_ctx)
+		})
+		if err != nil {
+			if ok {
+				return key, nil // Keeps using the known key if the source is unreachable
+			}
+			return nil, err
+		}
+		a.mu.RLock()
+		key, ok = a.keys[kid]
+		a.mu.RUnlock()
+	}
+
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (a *JWTAuthenticator) loadKeys(ctx context.Context) error {
+	defer func() {
+		a.mu.Lock()
+		a.attempted = time.Now()
+		a.mu.Unlock()
+	}()
+
+	raw, err := a.readSource(ctx)
+	if err != nil {
+		return fmt.Errorf("reading jwks: %w", err)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return fmt.Errorf("parsing jwks: %w", err)
+	}
+
+	// Identity providers publish other kinds of keys along with the signing ones, e.g. Ed25519 or symmetric
+	keys := map[string]any{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			a.sugar.Warnw("skipping jwk", "kid", jwk.Kid, "kty", jwk.Kty, "err", err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("no usable key in jwks")
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.fetched = time.Now()
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *JWTAuthenticator) readSource(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(a.source, "http://") && !strings.HasPrefix(a.source, "https://") {
+		return os.ReadFile(a.source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.source, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status=%d", res.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+func (k *jsonWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
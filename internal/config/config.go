@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"go-cdn/pkg/utils"
 	"strings"
+	"time"
 
 	capi "github.com/hashicorp/consul/api"
 	"github.com/spf13/viper"
@@ -14,13 +15,37 @@ func New() (*Config, error) {
 		Consul: Consul{
 			ConsulServiceID: utils.RandStringBytes(4),
 		},
-		Cache:      Cache{RedisEnable: false},
+		Cache:      Cache{RedisEnable: false, RedisTTL: time.Hour},
 		Database:   Database{DatabaseSSL: false},
-		HTTPServer: HTTPServer{DeliveryPort: 3000, RateLimitEnable: false},
-		Telemetry:  Telemetry{Sampling: 1, LogPath: "./logs", LogMaxSize: 500, LogMaxBackups: 3, LogMaxAge: 28},
+		HTTPServer: HTTPServer{DeliveryPort: 3000},
+		Admin:      Admin{AdminAddress: "127.0.0.1:3001"},
+		Health:     Health{HealthTimeout: 2 * time.Second},
+		AccessLog:  AccessLog{AccessLogEnable: true, AccessLogFormat: "json", AccessLogSampleRate: 1},
+		RateLimit:  RateLimit{RateLimitRate: 50, RateLimitBurst: 100, RateLimitMaxClients: 10000, RateLimitStore: "local", RateLimitFailOpen: true},
+		Telemetry:  Telemetry{Protocol: "http", Insecure: true, Sampling: 1, SamplingParent: true, MetricsInterval: 30 * time.Second, LogPath: "./logs", LogLevel: "info", LogConsoleLevel: "debug", LogMaxSize: 500, LogMaxBackups: 3, LogMaxAge: 28},
+		Metrics:    Metrics{MetricsPath: "/metrics"},
+		Debug:      Debug{DebugAddress: "127.0.0.1:6060"},
+		Upload:     Upload{UploadMaxSize: 32 << 20, UploadMaxBatchFiles: 100},
+		Auth:       Auth{AuthCacheTTL: 30 * time.Second, AuthRotationGrace: 24 * time.Hour, JWT: JWT{JWTSubjectClaim: "sub", JWTScopeClaim: "scope", JWTRefreshInterval: time.Hour}},
+		Signing:    Signing{SigningDefaultTTL: 15 * time.Minute, SigningMaxTTL: 7 * 24 * time.Hour},
+		Fetch:      Fetch{FetchTimeout: 30 * time.Second, FetchMaxRedirects: 3},
+		Trash:      Trash{TrashRetention: 7 * 24 * time.Hour, TrashPurgeInterval: time.Hour},
+		Versions:   Versions{VersionsKeep: 10},
+		Tus:        Tus{TusMaxSize: 1 << 30, TusMaxChunkSize: 8 << 20, TusExpiration: 24 * time.Hour, TusCleanupInterval: time.Hour},
+		Warmup:     Warmup{WarmupStrategy: "popular", WarmupCount: 100, WarmupRate: 50, WarmupFlushInterval: 30 * time.Second},
+		Throttle:   Throttle{ThrottleBurst: 256 << 10, ThrottleGlobalBurst: 1 << 20},
+		Egress:     Egress{EgressPeriod: time.Hour, EgressFlushInterval: 30 * time.Second},
 	}
 
+	defaults := cfg
 	err := cfg.loadFromFile()
+
+	// Intervals drive tickers, which can't run with a zero or negative one
+	keepPositive(&cfg.Warmup.WarmupFlushInterval, defaults.Warmup.WarmupFlushInterval)
+	keepPositive(&cfg.Tus.TusCleanupInterval, defaults.Tus.TusCleanupInterval)
+	keepPositive(&cfg.Trash.TrashPurgeInterval, defaults.Trash.TrashPurgeInterval)
+	keepPositive(&cfg.Egress.EgressFlushInterval, defaults.Egress.EgressFlushInterval)
+
 	if cfg.Consul.ConsulServiceAddress == AddressRetrievalAuto {
 		cfg.Consul.ConsulServiceAddress = utils.GetLocalIPv4()
 	}
@@ -28,6 +53,12 @@ func New() (*Config, error) {
 	return &cfg, err
 }
 
+func keepPositive(value *time.Duration, fallback time.Duration) {
+	if *value <= 0 {
+		*value = fallback
+	}
+}
+
 func (cfg *Config) loadFromFile() error {
 	viper.SetConfigName("configs")
 	viper.SetConfigType("yaml")
@@ -54,10 +85,10 @@ func (cfg *Config) GetConsulServiceDefinition() *capi.AgentServiceRegistration {
 		Address: csl.ConsulServiceAddress,
 		Port:    cfg.HTTPServer.DeliveryPort,
 		Check: &capi.AgentServiceCheck{
-			Name:                           "web_alive",
+			Name:                           "web_ready",
 			Interval:                       "10s",
 			Timeout:                        "30s",
-			HTTP:                           fmt.Sprintf("http://%s:%d/health", csl.ConsulServiceAddress, cfg.HTTPServer.DeliveryPort),
+			HTTP:                           fmt.Sprintf("http://%s:%d/readyz", csl.ConsulServiceAddress, cfg.HTTPServer.DeliveryPort),
 			DeregisterCriticalServiceAfter: "1m",
 		},
 	}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 const (
 	AddressRetrievalAuto string = "auto"
 )
@@ -9,7 +11,24 @@ type Config struct {
 	Cache      Cache      `mapstructure:"redis"`
 	Database   Database   `mapstructure:"postgres"`
 	HTTPServer HTTPServer `mapstructure:"http"`
+	Admin      Admin      `mapstructure:"admin"`
+	Health     Health     `mapstructure:"health"`
+	AccessLog  AccessLog  `mapstructure:"access_log"`
+	RateLimit  RateLimit  `mapstructure:"rate_limit"`
+	Throttle   Throttle   `mapstructure:"throttle"`
 	Telemetry  Telemetry  `mapstructure:"telemetry"`
+	Metrics    Metrics    `mapstructure:"metrics"`
+	Debug      Debug      `mapstructure:"debug"`
+	Warmup     Warmup     `mapstructure:"warmup"`
+	Tus        Tus        `mapstructure:"tus"`
+	Upload     Upload     `mapstructure:"upload"`
+	Trash      Trash      `mapstructure:"trash"`
+	Versions   Versions   `mapstructure:"versions"`
+	Fetch      Fetch      `mapstructure:"fetch"`
+	Auth       Auth       `mapstructure:"auth"`
+	Signing    Signing    `mapstructure:"signing"`
+	Quota      Quota      `mapstructure:"quota"`
+	Egress     Egress     `mapstructure:"egress"`
 }
 
 type Consul struct {
@@ -23,35 +42,202 @@ type Consul struct {
 }
 
 type Cache struct {
-	RedisEnable   bool   `mapstructure:"enable"`
-	RedisAddress  string `mapstructure:"host"`
-	RedisPassword string `mapstructure:"password"`
-	RedisDB       int    `mapstructure:"db"`
+	RedisEnable   bool          `mapstructure:"enable"`
+	RedisAddress  string        `mapstructure:"host"`
+	RedisPassword string        `mapstructure:"password" json:"-"`
+	RedisDB       int           `mapstructure:"db"`
+	RedisTTL      time.Duration `mapstructure:"ttl"`
 }
 
 type Database struct {
 	DatabaseAddress  string `mapstructure:"host"`
 	DatabaseUsername string `mapstructure:"username"`
-	DatabasePassword string `mapstructure:"password"`
+	DatabasePassword string `mapstructure:"password" json:"-"`
 	DatabaseName     string `mapstructure:"database"`
 	DatabaseSSL      bool   `mapstructure:"ssl"`
 }
 
 type HTTPServer struct {
-	DeliveryPort    int    `mapstructure:"port"`
-	ServerSubPath   string `mapstructure:"path"`
-	AllowDeletion   bool   `mapstructure:"allow_delete"`
-	AllowInsertion  bool   `mapstructure:"allow_insert"`
-	RateLimitEnable bool   `mapstructure:"rate_limit_enable"`
-	RateLimit       int    `mapstructure:"rate_limit"`
+	DeliveryPort   int      `mapstructure:"port"`
+	ServerSubPath  string   `mapstructure:"path"`
+	AllowDeletion  bool     `mapstructure:"allow_delete"`
+	AllowInsertion bool     `mapstructure:"allow_insert"`
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+type Admin struct {
+	AdminEnable          bool     `mapstructure:"enable"`
+	AdminAddress         string   `mapstructure:"address"`
+	AdminAllowedNetworks []string `mapstructure:"allowed_networks"`
+}
+
+type Health struct {
+	HealthTimeout       time.Duration `mapstructure:"timeout"`
+	HealthShutdownDelay time.Duration `mapstructure:"shutdown_delay"`
+}
+
+type AccessLog struct {
+	AccessLogEnable     bool     `mapstructure:"enable"`
+	AccessLogFormat     string   `mapstructure:"format"` // json or combined
+	AccessLogSampleRate float64  `mapstructure:"sample_rate"`
+	AccessLogFields     []string `mapstructure:"fields"`
+	AccessLogSkipPaths  []string `mapstructure:"skip_paths"`
+}
+
+type RateLimit struct {
+	RateLimitEnable          bool             `mapstructure:"enable"`
+	RateLimitRate            float64          `mapstructure:"rate"` // requests per second of each client
+	RateLimitBurst           int              `mapstructure:"burst"`
+	RateLimitPerRoute        bool             `mapstructure:"per_route"`   // a separate budget for each route
+	RateLimitMaxClients      int              `mapstructure:"max_clients"` // budgets kept in memory, the least recently seen are dropped
+	RateLimitStore           string           `mapstructure:"store"`       // local or redis, shared by all the instances
+	RateLimitFailOpen        bool             `mapstructure:"fail_open"`   // whether requests go through while the store is unavailable
+	RateLimitRoutes          []RateLimitRoute `mapstructure:"routes"`
+	RateLimitAllowedNetworks []string         `mapstructure:"allowed_networks"` // CIDRs never limited
+	RateLimitAllowedSubjects []string         `mapstructure:"allowed_subjects"` // e.g. key:<id>
+}
+
+type Throttle struct {
+	ThrottleEnable              bool     `mapstructure:"enable"`
+	ThrottleRate                int64    `mapstructure:"rate"` // bytes per second of each download, 0 means unlimited
+	ThrottleBurst               int64    `mapstructure:"burst"`
+	ThrottleGlobalRate          int64    `mapstructure:"global_rate"` // bytes per second of all the downloads together
+	ThrottleGlobalBurst         int64    `mapstructure:"global_burst"`
+	ThrottleExemptAuthenticated bool     `mapstructure:"exempt_authenticated"`
+	ThrottleExemptSubjects      []string `mapstructure:"exempt_subjects"` // e.g. key:<id> of premium clients
+}
+
+// RateLimitRoute overrides the rate of a route, given as method and path, e.g. "POST /content/batch"
+type RateLimitRoute struct {
+	Route string  `mapstructure:"route"`
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
+}
+
+type Metrics struct {
+	MetricsEnable bool   `mapstructure:"enable"`
+	MetricsPath   string `mapstructure:"path"`
 }
 
 type Telemetry struct {
-	TelemetryEnable bool    `mapstructure:"enable"`
-	JaegerAddress   string  `mapstructure:"jaeger_address"`
-	Sampling        float64 `mapstructure:"sampling"`
-	LogPath         string  `mapstructure:"logs_path"`
-	LogMaxSize      int     `mapstructure:"logs_max_size"`
-	LogMaxBackups   int     `mapstructure:"logs_max_backups"`
-	LogMaxAge       int     `mapstructure:"logs_max_age"`
+	TelemetryEnable bool              `mapstructure:"enable"`
+	JaegerAddress   string            `mapstructure:"jaeger_address"`
+	Protocol        string            `mapstructure:"protocol"` // http or grpc
+	Insecure        bool              `mapstructure:"insecure"`
+	CAFile          string            `mapstructure:"ca_file"`
+	Headers         map[string]string `mapstructure:"headers" json:"-"` // Usually carry credentials
+	Sampling        float64           `mapstructure:"sampling"`
+	SamplingParent  bool              `mapstructure:"parent_based"`
+	SamplingRules   []SamplingRule    `mapstructure:"sampling_rules"`
+	SamplingErrors  bool              `mapstructure:"sample_errors"`
+	SamplingSlow    time.Duration     `mapstructure:"sample_slow"`
+	MetricsInterval time.Duration     `mapstructure:"metrics_interval"`
+	LogPath         string            `mapstructure:"logs_path"` // Logs stay local, only traces and metrics go over OTLP
+	LogLevel        string            `mapstructure:"logs_level"`
+	LogConsoleLevel string            `mapstructure:"console_level"`
+	LogMaxSize      int               `mapstructure:"logs_max_size"`
+	LogMaxBackups   int               `mapstructure:"logs_max_backups"`
+	LogMaxAge       int               `mapstructure:"logs_max_age"`
+}
+
+// Sampling ratio of the requests to a route, e.g. 0 for the health checks
+type SamplingRule struct {
+	Route string  `mapstructure:"route"`
+	Ratio float64 `mapstructure:"ratio"`
+}
+
+type Debug struct {
+	DebugEnable  bool   `mapstructure:"enable"`
+	DebugAddress string `mapstructure:"address"`
+}
+
+type Warmup struct {
+	WarmupEnable        bool          `mapstructure:"enable"`
+	WarmupOnStartup     bool          `mapstructure:"on_startup"`
+	WarmupStrategy      string        `mapstructure:"strategy"` // popular or recent, ignored when hashes are given
+	WarmupCount         int           `mapstructure:"count"`
+	WarmupRate          int           `mapstructure:"rate"` // files per second, 0 means unlimited
+	WarmupHashes        []string      `mapstructure:"hashes"`
+	WarmupFlushInterval time.Duration `mapstructure:"stats_flush_interval"`
+}
+
+type Egress struct {
+	EgressEnable        bool          `mapstructure:"enable"`
+	EgressPeriod        time.Duration `mapstructure:"period"` // granularity of the rollup
+	EgressFlushInterval time.Duration `mapstructure:"flush_interval"`
+}
+
+type Tus struct {
+	TusEnable          bool          `mapstructure:"enable"`
+	TusMaxSize         int64         `mapstructure:"max_size"`       // bytes
+	TusMaxChunkSize    int64         `mapstructure:"max_chunk_size"` // bytes accepted by a single PATCH
+	TusExpiration      time.Duration `mapstructure:"expiration"`
+	TusCleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+}
+
+type Upload struct {
+	UploadMaxSize           int64    `mapstructure:"max_size"`      // bytes, 0 means unlimited
+	UploadAllowedTypes      []string `mapstructure:"allowed_types"` // e.g. image/*, empty allows everything
+	UploadDeniedTypes       []string `mapstructure:"denied_types"`
+	UploadAllowedExtensions []string `mapstructure:"allowed_extensions"`
+	UploadDeniedExtensions  []string `mapstructure:"denied_extensions"`
+	UploadAllowEmpty        bool     `mapstructure:"allow_empty"`
+	UploadMaxBatchFiles     int      `mapstructure:"max_batch_files"`
+}
+
+type Trash struct {
+	TrashRetention     time.Duration `mapstructure:"retention"`
+	TrashPurgeInterval time.Duration `mapstructure:"purge_interval"`
+}
+
+type Versions struct {
+	VersionsKeep int `mapstructure:"keep"`
+}
+
+type Fetch struct {
+	FetchEnable          bool          `mapstructure:"enable"`
+	FetchTimeout         time.Duration `mapstructure:"timeout"`
+	FetchMaxRedirects    int           `mapstructure:"max_redirects"`
+	FetchAllowedNetworks []string      `mapstructure:"allowed_networks"` // CIDRs reachable even if private or loopback
+}
+
+type Auth struct {
+	AuthEnable        bool          `mapstructure:"enable"`
+	AuthProtectRead   bool          `mapstructure:"protect_read"`
+	AuthAdminKey      string        `mapstructure:"admin_key" json:"-"` // Static key with admin scope, to bootstrap the first keys
+	AuthCacheTTL      time.Duration `mapstructure:"cache_ttl"`
+	AuthRotationGrace time.Duration `mapstructure:"rotation_grace"` // How long a rotated key keeps working
+	JWT               JWT           `mapstructure:"jwt"`
+}
+
+type JWT struct {
+	JWTEnable          bool                `mapstructure:"enable"`
+	JWTJWKS            string              `mapstructure:"jwks"` // File path or http(s) url of the key set
+	JWTIssuer          string              `mapstructure:"issuer"`
+	JWTAudience        string              `mapstructure:"audience"`
+	JWTSubjectClaim    string              `mapstructure:"subject_claim"`
+	JWTScopeClaim      string              `mapstructure:"scope_claim"`
+	JWTScopeMapping    map[string][]string `mapstructure:"scope_mapping"` // Claim value to scopes, empty uses the values as scope names
+	JWTLeeway          time.Duration       `mapstructure:"leeway"`
+	JWTRefreshInterval time.Duration       `mapstructure:"refresh_interval"`
+}
+
+type Signing struct {
+	SigningKeys       []SigningKey  `mapstructure:"keys"`
+	SigningActiveKey  string        `mapstructure:"active_key"` // Key used to mint new URLs, all the keys are accepted
+	SigningDefaultTTL time.Duration `mapstructure:"default_ttl"`
+	SigningMaxTTL     time.Duration `mapstructure:"max_ttl"`
+}
+
+type SigningKey struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret" json:"-"`
+}
+
+// Default limits of the uploaders without an explicit quota, 0 means unlimited
+type Quota struct {
+	QuotaSoftBytes   int64 `mapstructure:"soft_bytes"`
+	QuotaHardBytes   int64 `mapstructure:"hard_bytes"`
+	QuotaSoftObjects int64 `mapstructure:"soft_objects"`
+	QuotaHardObjects int64 `mapstructure:"hard_objects"`
 }
@@ -0,0 +1,22 @@
+package database
+
+import (
+	"context"
+)
+
+type accessRepository interface {
+	SetPrivate(ctx context.Context, bucket string, id_hash string, private bool) error
+}
+
+// AccessController manages who can read a file: private files are only served through signed URLs
+type AccessController struct {
+	repo accessRepository
+}
+
+func NewAccessController(repo accessRepository) *AccessController {
+	return &AccessController{repo}
+}
+
+func (c *AccessController) SetPrivate(ctx context.Context, bucket string, id_hash string, private bool) error {
+	return c.repo.SetPrivate(ctx, bucket, id_hash, private)
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	mod "go-cdn/pkg/model"
+)
+
+type bucketRepository interface {
+	AddBucket(ctx context.Context, bucket *mod.Bucket) error
+	GetBucket(ctx context.Context, name string) (*mod.Bucket, error)
+	GetBuckets(ctx context.Context) ([]mod.Bucket, error)
+	UpdateBucket(ctx context.Context, bucket *mod.Bucket) error
+	RemoveBucket(ctx context.Context, name string) error
+	GetBucketUsage(ctx context.Context, name string) (int64, error)
+}
+
+// BucketController manages the namespaces files are stored in, and their settings
+type BucketController struct {
+	repo bucketRepository
+}
+
+func NewBucketController(repo bucketRepository) *BucketController {
+	return &BucketController{repo}
+}
+
+func (c *BucketController) AddBucket(ctx context.Context, bucket *mod.Bucket) error {
+	return c.repo.AddBucket(ctx, bucket)
+}
+
+func (c *BucketController) GetBucket(ctx context.Context, name string) (*mod.Bucket, error) {
+	b, err := c.repo.GetBucket(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (c *BucketController) GetBuckets(ctx context.Context) ([]mod.Bucket, error) {
+	l, err := c.repo.GetBuckets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (c *BucketController) UpdateBucket(ctx context.Context, bucket *mod.Bucket) error {
+	return c.repo.UpdateBucket(ctx, bucket)
+}
+
+// RemoveBucket deletes an unused bucket, returns ErrBucketNotEmpty while files (even trashed), uploads or
+// API keys still belong to it
+func (c *BucketController) RemoveBucket(ctx context.Context, name string) error {
+	return c.repo.RemoveBucket(ctx, name)
+}
+
+// GetBucketUsage returns the bytes taken by the current files of the bucket
+func (c *BucketController) GetBucketUsage(ctx context.Context, name string) (int64, error) {
+	return c.repo.GetBucketUsage(ctx, name)
+}
@@ -6,10 +6,13 @@ import (
 )
 
 type databaseRepository interface {
-	GetFile(ctx context.Context, id_hash_search string) (*mod.StoredFile, error)
-	GetFileList(ctx context.Context) (*[]mod.StoredFile, error)
+	GetFile(ctx context.Context, bucket string, id_hash_search string) (*mod.StoredFile, error)
+	GetFileList(ctx context.Context, bucket string) (*[]mod.StoredFile, error)
 	AddFile(ctx context.Context, file *mod.StoredFile) error
-	RemoveFile(ctx context.Context, id_hash string) error
+	RemoveFile(ctx context.Context, bucket string, id_hash string) error
+	AddFiles(ctx context.Context, files []*mod.StoredFile) error
+	RemoveFiles(ctx context.Context, bucket string, id_hashes []string) ([]string, error)
+	Ping(ctx context.Context) error
 	CloseConnection() error
 }
 
@@ -21,22 +24,24 @@ func New(repo databaseRepository) *Controller {
 	return &Controller{repo}
 }
 
-func (c *Controller) GetFile(ctx context.Context, id_hash_search string) (*mod.StoredFile, error) {
-	file, err := c.repo.GetFile(ctx, id_hash_search)
+func (c *Controller) GetFile(ctx context.Context, bucket string, id_hash_search string) (*mod.StoredFile, error) {
+	file, err := c.repo.GetFile(ctx, bucket, id_hash_search)
 	if err != nil {
 		return nil, err
 	}
 	return file, nil
 }
 
-func (c *Controller) GetFileList(ctx context.Context) (*[]mod.StoredFile, error) {
-	l, err := c.repo.GetFileList(ctx)
+func (c *Controller) GetFileList(ctx context.Context, bucket string) (*[]mod.StoredFile, error) {
+	l, err := c.repo.GetFileList(ctx, bucket)
 	if err != nil {
 		return nil, err
 	}
 	return l, nil
 }
 
+// AddFile stores the file in the bucket set on it. Fails with repository.ErrQuotaExceeded or
+// ErrObjectQuotaExceeded if a hard quota of its owners would be exceeded
 func (c *Controller) AddFile(ctx context.Context, file *mod.StoredFile) error {
 	if err := c.repo.AddFile(ctx, file); err != nil {
 		return err
@@ -44,13 +49,35 @@ func (c *Controller) AddFile(ctx context.Context, file *mod.StoredFile) error {
 	return nil
 }
 
-func (c *Controller) RemoveFile(ctx context.Context, id_hash string) error {
-	if err := c.repo.RemoveFile(ctx, id_hash); err != nil {
+func (c *Controller) RemoveFile(ctx context.Context, bucket string, id_hash string) error {
+	if err := c.repo.RemoveFile(ctx, bucket, id_hash); err != nil {
 		return err
 	}
 	return nil
 }
 
+// AddFiles stores all the files or none of them. Fails with repository.ErrKeyExists if a hash is taken
+func (c *Controller) AddFiles(ctx context.Context, files []*mod.StoredFile) error {
+	if err := c.repo.AddFiles(ctx, files); err != nil {
+		return err
+	}
+	return nil
+}
+
+// RemoveFiles returns the hashes that were actually present and got removed
+func (c *Controller) RemoveFiles(ctx context.Context, bucket string, id_hashes []string) ([]string, error) {
+	removed, err := c.repo.RemoveFiles(ctx, bucket, id_hashes)
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// Ping checks that the database can be reached
+func (c *Controller) Ping(ctx context.Context) error {
+	return c.repo.Ping(ctx)
+}
+
 func (c *Controller) Close() error {
 	return c.repo.CloseConnection()
 }
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	mod "go-cdn/pkg/model"
+)
+
+type egressRepository interface {
+	RecordEgress(ctx context.Context, counts map[mod.EgressKey]mod.EgressCount) error
+	GetEgress(ctx context.Context, filter mod.EgressFilter) ([]mod.EgressReport, error)
+}
+
+type egressBufferRepository interface {
+	AddEgress(ctx context.Context, counts map[mod.EgressKey]mod.EgressCount) error
+	TakeEgress(ctx context.Context) (map[mod.EgressKey]mod.EgressCount, error)
+}
+
+// EgressController exposes the rollup of the bytes served by each file
+type EgressController struct {
+	repo egressRepository
+}
+
+func NewEgressController(repo egressRepository) *EgressController {
+	return &EgressController{repo}
+}
+
+func (c *EgressController) RecordEgress(ctx context.Context, counts map[mod.EgressKey]mod.EgressCount) error {
+	return c.repo.RecordEgress(ctx, counts)
+}
+
+func (c *EgressController) GetEgress(ctx context.Context, filter mod.EgressFilter) ([]mod.EgressReport, error) {
+	l, err := c.repo.GetEgress(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// EgressBuffer holds the traffic counted by all the instances until it gets rolled up
+type EgressBuffer struct {
+	repo egressBufferRepository
+}
+
+func NewEgressBuffer(repo egressBufferRepository) *EgressBuffer {
+	return &EgressBuffer{repo}
+}
+
+func (c *EgressBuffer) AddEgress(ctx context.Context, counts map[mod.EgressKey]mod.EgressCount) error {
+	return c.repo.AddEgress(ctx, counts)
+}
+
+// TakeEgress removes the pending traffic, the counts returned along with an error must still be recorded
+func (c *EgressBuffer) TakeEgress(ctx context.Context) (map[mod.EgressKey]mod.EgressCount, error) {
+	return c.repo.TakeEgress(ctx)
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	mod "go-cdn/pkg/model"
+	"time"
+)
+
+type keyRepository interface {
+	AddKey(ctx context.Context, key *mod.APIKey) error
+	GetKey(ctx context.Context, key_id string) (*mod.APIKey, error)
+	GetKeys(ctx context.Context) ([]mod.APIKey, error)
+	RevokeKey(ctx context.Context, key_id string) error
+	ExpireKey(ctx context.Context, key_id string, at time.Time) error
+}
+
+// KeyController stores the API keys used to authenticate clients
+type KeyController struct {
+	repo keyRepository
+}
+
+func NewKeyController(repo keyRepository) *KeyController {
+	return &KeyController{repo}
+}
+
+func (c *KeyController) AddKey(ctx context.Context, key *mod.APIKey) error {
+	return c.repo.AddKey(ctx, key)
+}
+
+func (c *KeyController) GetKey(ctx context.Context, key_id string) (*mod.APIKey, error) {
+	key, err := c.repo.GetKey(ctx, key_id)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (c *KeyController) GetKeys(ctx context.Context) ([]mod.APIKey, error) {
+	l, err := c.repo.GetKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (c *KeyController) RevokeKey(ctx context.Context, key_id string) error {
+	return c.repo.RevokeKey(ctx, key_id)
+}
+
+// ExpireKey brings the expiration of a key forward to at, if it would expire later
+func (c *KeyController) ExpireKey(ctx context.Context, key_id string, at time.Time) error {
+	return c.repo.ExpireKey(ctx, key_id, at)
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	mod "go-cdn/pkg/model"
+)
+
+type statsRepository interface {
+	RecordHits(ctx context.Context, hits map[mod.FileRef]int64) error
+	GetPopularFiles(ctx context.Context, limit int) ([]mod.FileRef, error)
+	GetRecentFiles(ctx context.Context, limit int) ([]mod.FileRef, error)
+}
+
+// StatsController exposes the access statistics kept alongside the stored files
+type StatsController struct {
+	repo statsRepository
+}
+
+func NewStatsController(repo statsRepository) *StatsController {
+	return &StatsController{repo}
+}
+
+func (c *StatsController) RecordHits(ctx context.Context, hits map[mod.FileRef]int64) error {
+	return c.repo.RecordHits(ctx, hits)
+}
+
+func (c *StatsController) GetPopularFiles(ctx context.Context, limit int) ([]mod.FileRef, error) {
+	l, err := c.repo.GetPopularFiles(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (c *StatsController) GetRecentFiles(ctx context.Context, limit int) ([]mod.FileRef, error) {
+	l, err := c.repo.GetRecentFiles(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	mod "go-cdn/pkg/model"
+	"time"
+)
+
+type trashRepository interface {
+	GetTrash(ctx context.Context, bucket string) ([]mod.TrashedFile, error)
+	RestoreFile(ctx context.Context, bucket string, id_hash string) error
+	PurgeFile(ctx context.Context, bucket string, id_hash string) error
+	PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// TrashController manages soft-deleted files, which can be restored until they are purged
+type TrashController struct {
+	repo      trashRepository
+	retention time.Duration
+}
+
+func NewTrashController(repo trashRepository, retention time.Duration) *TrashController {
+	return &TrashController{repo, retention}
+}
+
+func (c *TrashController) GetTrash(ctx context.Context, bucket string) ([]mod.TrashedFile, error) {
+	l, err := c.repo.GetTrash(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	for i := range l {
+		l[i].PurgeAt = l[i].DeletedAt.Add(c.retention)
+	}
+	return l, nil
+}
+
+func (c *TrashController) RestoreFile(ctx context.Context, bucket string, id_hash string) error {
+	return c.repo.RestoreFile(ctx, bucket, id_hash)
+}
+
+// PurgeFile permanently removes a file that is in the trash
+func (c *TrashController) PurgeFile(ctx context.Context, bucket string, id_hash string) error {
+	return c.repo.PurgeFile(ctx, bucket, id_hash)
+}
+
+// PurgeExpired permanently removes the files deleted longer than the retention period ago
+func (c *TrashController) PurgeExpired(ctx context.Context) (int64, error) {
+	return c.repo.PurgeDeletedBefore(ctx, time.Now().Add(-c.retention))
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	mod "go-cdn/pkg/model"
+)
+
+type uploadRepository interface {
+	CreateUpload(ctx context.Context, upload *mod.Upload) error
+	GetUpload(ctx context.Context, upload_id string) (*mod.Upload, error)
+	AppendChunk(ctx context.Context, upload_id string, offset int64, chunk []byte) (int64, error)
+	ReadUploadHead(ctx context.Context, upload_id string, n int) ([]byte, error)
+	FinalizeUpload(ctx context.Context, upload_id string, id_hash string) error
+	RemoveUpload(ctx context.Context, upload_id string) error
+	RemoveExpiredUploads(ctx context.Context) (int64, error)
+}
+
+// UploadController handles resumable uploads, whose chunks are persisted until the file is complete
+type UploadController struct {
+	repo uploadRepository
+}
+
+func NewUploadController(repo uploadRepository) *UploadController {
+	return &UploadController{repo}
+}
+
+func (c *UploadController) CreateUpload(ctx context.Context, upload *mod.Upload) error {
+	return c.repo.CreateUpload(ctx, upload)
+}
+
+func (c *UploadController) GetUpload(ctx context.Context, upload_id string) (*mod.Upload, error) {
+	upload, err := c.repo.GetUpload(ctx, upload_id)
+	if err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// AppendChunk stores the chunk if offset matches the current one, and returns the new offset
+func (c *UploadController) AppendChunk(ctx context.Context, upload_id string, offset int64, chunk []byte) (int64, error) {
+	return c.repo.AppendChunk(ctx, upload_id, offset, chunk)
+}
+
+// ReadUploadHead returns the first n bytes received, so that the type can be checked before finalizing
+func (c *UploadController) ReadUploadHead(ctx context.Context, upload_id string, n int) ([]byte, error) {
+	return c.repo.ReadUploadHead(ctx, upload_id, n)
+}
+
+// FinalizeUpload assembles the chunks into a stored file under id_hash and drops the upload. Returns
+// repository.ErrKeyExists if id_hash is already taken in the bucket
+func (c *UploadController) FinalizeUpload(ctx context.Context, upload_id string, id_hash string) error {
+	return c.repo.FinalizeUpload(ctx, upload_id, id_hash)
+}
+
+func (c *UploadController) RemoveUpload(ctx context.Context, upload_id string) error {
+	return c.repo.RemoveUpload(ctx, upload_id)
+}
+
+func (c *UploadController) RemoveExpiredUploads(ctx context.Context) (int64, error) {
+	return c.repo.RemoveExpiredUploads(ctx)
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	mod "go-cdn/pkg/model"
+)
+
+type usageRepository interface {
+	GetUsage(ctx context.Context, owner string) (*mod.Usage, error)
+	GetUsages(ctx context.Context) ([]mod.Usage, error)
+	GetQuota(ctx context.Context, owner string) (*mod.Quota, error)
+	GetQuotas(ctx context.Context) ([]mod.Quota, error)
+	SetQuota(ctx context.Context, quota *mod.Quota) error
+	RemoveQuota(ctx context.Context, owner string) error
+}
+
+// UsageController reports the storage taken by each owner, kept up to date along with the files, and
+// manages their quotas
+type UsageController struct {
+	repo usageRepository
+}
+
+func NewUsageController(repo usageRepository) *UsageController {
+	return &UsageController{repo}
+}
+
+// GetUsage returns a zero usage for owners that never stored anything
+func (c *UsageController) GetUsage(ctx context.Context, owner string) (*mod.Usage, error) {
+	u, err := c.repo.GetUsage(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func (c *UsageController) GetUsages(ctx context.Context) ([]mod.Usage, error) {
+	l, err := c.repo.GetUsages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// GetQuota returns ErrKeyDoesNotExist if the owner has no explicit quota
+func (c *UsageController) GetQuota(ctx context.Context, owner string) (*mod.Quota, error) {
+	q, err := c.repo.GetQuota(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (c *UsageController) GetQuotas(ctx context.Context) ([]mod.Quota, error) {
+	l, err := c.repo.GetQuotas(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (c *UsageController) SetQuota(ctx context.Context, quota *mod.Quota) error {
+	return c.repo.SetQuota(ctx, quota)
+}
+
+func (c *UsageController) RemoveQuota(ctx context.Context, owner string) error {
+	return c.repo.RemoveQuota(ctx, owner)
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	mod "go-cdn/pkg/model"
+)
+
+type versionRepository interface {
+	ReplaceFile(ctx context.Context, file *mod.StoredFile, keep int) (int, error)
+	GetFileVersion(ctx context.Context, bucket string, id_hash string, version int) (*mod.StoredFile, error)
+	GetFileVersions(ctx context.Context, bucket string, id_hash string) ([]mod.FileVersion, error)
+}
+
+// VersionController updates files in place, keeping up to keep of their previous revisions
+type VersionController struct {
+	repo versionRepository
+	keep int
+}
+
+func NewVersionController(repo versionRepository, keep int) *VersionController {
+	return &VersionController{repo, keep}
+}
+
+// ReplaceFile archives the current revision and stores the new content under the same hash, returning its version.
+// The oldest revisions beyond keep are dropped
+func (c *VersionController) ReplaceFile(ctx context.Context, file *mod.StoredFile) (int, error) {
+	return c.repo.ReplaceFile(ctx, file, c.keep)
+}
+
+func (c *VersionController) GetFileVersion(ctx context.Context, bucket string, id_hash string, version int) (*mod.StoredFile, error) {
+	file, err := c.repo.GetFileVersion(ctx, bucket, id_hash, version)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (c *VersionController) GetFileVersions(ctx context.Context, bucket string, id_hash string) ([]mod.FileVersion, error) {
+	l, err := c.repo.GetFileVersions(ctx, bucket, id_hash)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
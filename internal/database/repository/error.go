@@ -4,3 +4,8 @@ import "errors"
 
 var ErrDatabaseOp = errors.New("error on database operation")
 var ErrKeyDoesNotExist = errors.New("key does not exist")
+var ErrOffsetMismatch = errors.New("offset does not match the stored one")
+var ErrKeyExists = errors.New("key already exists")
+var ErrBucketNotEmpty = errors.New("bucket still contains files")
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+var ErrObjectQuotaExceeded = errors.New("object quota exceeded")
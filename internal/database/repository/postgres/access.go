@@ -0,0 +1,26 @@
+package postgres
+
+import (
+	"context"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func (r *PostgresRepository) SetPrivate(ctx context.Context, bucket string, id_hash string, private bool) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/SetPrivate")
+	span.SetAttributes(attribute.String("pg.bucket", bucket),
+		attribute.String("pg.hash", id_hash),
+		attribute.Bool("pg.private", private))
+	defer span.End()
+
+	res, err := r.client.ExecContext(ctx, `UPDATE fs_entities SET private=$3 WHERE bucket=$1 AND id_hash=$2 AND deleted_at IS NULL`, bucket, id_hash, private)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrKeyDoesNotExist
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	mod "go-cdn/pkg/model"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+)
+
+func (r *PostgresRepository) AddBucket(ctx context.Context, bucket *mod.Bucket) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/AddBucket")
+	span.SetAttributes(attribute.String("pg.bucket", bucket.Name))
+	defer span.End()
+
+	err := r.client.QueryRowContext(ctx, `
+		INSERT INTO buckets (name, private, quota_bytes, allowed_types, no_cache, cache_control)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at`,
+		bucket.Name, bucket.Private, bucket.QuotaBytes, pq.Array(bucket.AllowedTypes), bucket.NoCache, bucket.CacheControl).
+		Scan(&bucket.CreatedAt)
+
+	return keyExists(err)
+}
+
+// Reports unique violations as repository.ErrKeyExists
+func keyExists(err error) error {
+	var pq_err *pq.Error
+	if errors.As(err, &pq_err) && pq_err.Code == pqUniqueViolation {
+		return repository.ErrKeyExists
+	}
+	return err
+}
+
+func (r *PostgresRepository) GetBucket(ctx context.Context, name string) (*mod.Bucket, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetBucket")
+	span.SetAttributes(attribute.String("pg.bucket", name))
+	defer span.End()
+
+	b := &mod.Bucket{}
+	err := r.client.QueryRowContext(ctx, `SELECT name, private, quota_bytes, allowed_types, no_cache, cache_control, created_at FROM buckets WHERE name=$1`, name).
+		Scan(&b.Name, &b.Private, &b.QuotaBytes, pq.Array(&b.AllowedTypes), &b.NoCache, &b.CacheControl, &b.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (r *PostgresRepository) GetBuckets(ctx context.Context) ([]mod.Bucket, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetBuckets")
+	defer span.End()
+
+	rows, err := r.client.QueryContext(ctx, `SELECT name, private, quota_bytes, allowed_types, no_cache, cache_control, created_at FROM buckets ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []mod.Bucket{}
+	for rows.Next() {
+		var b mod.Bucket
+		if err := rows.Scan(&b.Name, &b.Private, &b.QuotaBytes, pq.Array(&b.AllowedTypes), &b.NoCache, &b.CacheControl, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
+
+// Replaces the settings of an existing bucket
+func (r *PostgresRepository) UpdateBucket(ctx context.Context, bucket *mod.Bucket) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/UpdateBucket")
+	span.SetAttributes(attribute.String("pg.bucket", bucket.Name))
+	defer span.End()
+
+	err := r.client.QueryRowContext(ctx, `
+		UPDATE buckets SET private=$2, quota_bytes=$3, allowed_types=$4, no_cache=$5, cache_control=$6
+		WHERE name=$1 RETURNING created_at`,
+		bucket.Name, bucket.Private, bucket.QuotaBytes, pq.Array(bucket.AllowedTypes), bucket.NoCache, bucket.CacheControl).
+		Scan(&bucket.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrKeyDoesNotExist
+	}
+	return err
+}
+
+// Deletes a bucket no longer referenced by files, uploads or API keys
+func (r *PostgresRepository) RemoveBucket(ctx context.Context, name string) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/RemoveBucket")
+	span.SetAttributes(attribute.String("pg.bucket", name))
+	defer span.End()
+
+	tx, err := r.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM buckets WHERE name=$1`, name)
+
+	var pq_err *pq.Error
+	if errors.As(err, &pq_err) && pq_err.Code == pqForeignKeyViolation {
+		return repository.ErrBucketNotEmpty
+	}
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrKeyDoesNotExist
+	}
+
+	// A bucket created again with the same name starts from scratch
+	if _, err := tx.ExecContext(ctx, `DELETE FROM storage_usage WHERE owner=$1`, mod.BucketOwner(name)); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM storage_quotas WHERE owner=$1`, mod.BucketOwner(name)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Size of the current files of the bucket, trashed files excluded
+func (r *PostgresRepository) GetBucketUsage(ctx context.Context, name string) (int64, error) {
+	usage, err := r.GetUsage(ctx, mod.BucketOwner(name))
+	if err != nil {
+		return 0, err
+	}
+	return usage.Bytes, nil
+}
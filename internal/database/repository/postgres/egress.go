@@ -0,0 +1,113 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"go-cdn/internal/tracing"
+	mod "go-cdn/pkg/model"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Columns selected and grouped on for each grouping of the egress report
+var egressGroupings = map[string][]string{
+	"bucket": {"bucket"},
+	"file":   {"bucket", "id_hash"},
+	"period": {"period"},
+}
+
+// Adds the counts to the rollup, periods already present are summed
+func (r *PostgresRepository) RecordEgress(ctx context.Context, counts map[mod.EgressKey]mod.EgressCount) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/RecordEgress")
+	span.SetAttributes(attribute.Int("pg.hashes", len(counts)))
+	defer span.End()
+
+	tx, err := r.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for key, count := range counts {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO egress_rollup (bucket, id_hash, period, bytes, requests) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (bucket, id_hash, period) DO UPDATE SET bytes = egress_rollup.bytes + $4, requests = egress_rollup.requests + $5`,
+			key.Bucket, key.Hash, key.Period, count.Bytes, count.Requests)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Sums the traffic matching filter, the largest first or chronologically when grouped by period
+func (r *PostgresRepository) GetEgress(ctx context.Context, filter mod.EgressFilter) ([]mod.EgressReport, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetEgress")
+	span.SetAttributes(attribute.String("pg.group_by", filter.GroupBy),
+		attribute.String("pg.bucket", filter.Bucket))
+	defer span.End()
+
+	columns, ok := egressGroupings[filter.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown grouping %q", filter.GroupBy)
+	}
+
+	conditions := []string{"true"}
+	args := []any{}
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if !filter.From.IsZero() {
+		where("period >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		where("period < $%d", filter.To)
+	}
+	if filter.Bucket != "" {
+		where("bucket = $%d", filter.Bucket)
+	}
+	if filter.Hash != "" {
+		where("id_hash = $%d", filter.Hash)
+	}
+
+	group := strings.Join(columns, ", ")
+	order := "SUM(bytes) DESC, " + group
+	if filter.GroupBy == "period" {
+		order = "period"
+	}
+	rows, err := r.client.QueryContext(ctx, fmt.Sprintf(`SELECT %s, SUM(bytes), SUM(requests) FROM egress_rollup WHERE %s GROUP BY %s ORDER BY %s`,
+		group, strings.Join(conditions, " AND "), group, order), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []mod.EgressReport{}
+	for rows.Next() {
+		var report mod.EgressReport
+		var period time.Time
+		dest := []any{}
+		for _, column := range columns {
+			switch column {
+			case "bucket":
+				dest = append(dest, &report.Bucket)
+			case "id_hash":
+				dest = append(dest, &report.Hash)
+			case "period":
+				dest = append(dest, &period)
+			}
+		}
+		dest = append(dest, &report.Bytes, &report.Requests)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		if !period.IsZero() {
+			report.Period = &period
+		}
+		reports = append(reports, report)
+	}
+	return reports, rows.Err()
+}
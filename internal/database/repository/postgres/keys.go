@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	mod "go-cdn/pkg/model"
+	"time"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func (r *PostgresRepository) AddKey(ctx context.Context, key *mod.APIKey) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/AddKey")
+	span.SetAttributes(attribute.String("pg.key_id", key.KeyID))
+	defer span.End()
+
+	return r.client.QueryRowContext(ctx, `INSERT INTO api_keys (key_id, key_hash, name, scopes, bucket, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at`,
+		key.KeyID, key.Hash, key.Name, pq.Array(key.Scopes), nullString(key.Bucket), key.ExpiresAt).Scan(&key.CreatedAt)
+}
+
+func (r *PostgresRepository) GetKey(ctx context.Context, key_id string) (*mod.APIKey, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetKey")
+	span.SetAttributes(attribute.String("pg.key_id", key_id))
+	defer span.End()
+
+	key := &mod.APIKey{}
+	var name, bucket sql.NullString
+	err := r.client.QueryRowContext(ctx, `SELECT key_id, key_hash, name, scopes, bucket, created_at, expires_at, revoked_at FROM api_keys WHERE key_id=$1`, key_id).
+		Scan(&key.KeyID, &key.Hash, &name, pq.Array(&key.Scopes), &bucket, &key.CreatedAt, &key.ExpiresAt, &key.RevokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	key.Name = name.String
+	key.Bucket = bucket.String
+	return key, nil
+}
+
+// Lists all the keys, hashes included, newest first
+func (r *PostgresRepository) GetKeys(ctx context.Context) ([]mod.APIKey, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetKeys")
+	defer span.End()
+
+	rows, err := r.client.QueryContext(ctx, `SELECT key_id, key_hash, name, scopes, bucket, created_at, expires_at, revoked_at FROM api_keys ORDER BY created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []mod.APIKey{}
+	for rows.Next() {
+		var key mod.APIKey
+		var name, bucket sql.NullString
+		if err := rows.Scan(&key.KeyID, &key.Hash, &name, pq.Array(&key.Scopes), &bucket, &key.CreatedAt, &key.ExpiresAt, &key.RevokedAt); err != nil {
+			return nil, err
+		}
+		key.Name = name.String
+		key.Bucket = bucket.String
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *PostgresRepository) RevokeKey(ctx context.Context, key_id string) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/RevokeKey")
+	span.SetAttributes(attribute.String("pg.key_id", key_id))
+	defer span.End()
+
+	res, err := r.client.ExecContext(ctx, `UPDATE api_keys SET revoked_at = now() WHERE key_id=$1 AND revoked_at IS NULL`, key_id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrKeyDoesNotExist
+	}
+	return nil
+}
+
+func (r *PostgresRepository) ExpireKey(ctx context.Context, key_id string, at time.Time) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/ExpireKey")
+	span.SetAttributes(attribute.String("pg.key_id", key_id))
+	defer span.End()
+
+	res, err := r.client.ExecContext(ctx, `UPDATE api_keys SET expires_at = LEAST(COALESCE(expires_at, $2), $2) WHERE key_id=$1 AND revoked_at IS NULL`, key_id, at)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrKeyDoesNotExist
+	}
+	return nil
+}
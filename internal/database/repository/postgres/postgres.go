@@ -11,33 +11,39 @@ import (
 	"go-cdn/internal/tracing"
 	mod "go-cdn/pkg/model"
 
+	"github.com/XSAM/otelsql"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
 type PostgresRepository struct {
 	client *sql.DB
+	quota  config.Quota // Default quotas of the uploaders, enforced along with the explicit ones
 }
 
 func New(ctx context.Context, dc *discovery.Controller, cfg *config.Config) (*PostgresRepository, error) {
-	_, span := tracing.Tracer.Start(ctx, "pg/New")
+	ctx, span := tracing.Tracer.Start(ctx, "pg/New")
 	defer span.End()
 
-	repo := &PostgresRepository{}
+	repo := &PostgresRepository{quota: cfg.Quota}
 	conStr, err := repo.getConnectionString(dc, cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	con, err := sql.Open(string(mod.DatabaseTypePostgres), conStr)
+	// Wraps the driver so that every statement gets a span under the caller's one
+	con, err := otelsql.Open(string(mod.DatabaseTypePostgres), conStr,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}))
 	if err != nil {
 		return nil, err
 	}
 
-	err = con.Ping()
+	err = con.PingContext(ctx)
 	repo.client = con
 	if err != nil {
 		return nil, err
@@ -46,12 +52,25 @@ func New(ctx context.Context, dc *discovery.Controller, cfg *config.Config) (*Po
 	return repo, err
 }
 
+// Checks the connection, used by the readiness probe
+func (r *PostgresRepository) Ping(ctx context.Context) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/Ping")
+	defer span.End()
+
+	return r.client.PingContext(ctx)
+}
+
 // Handle the termination of the connection
 func (r *PostgresRepository) CloseConnection() error {
 	err := r.client.Close()
 	return err
 }
 
+// DB exposes the connection pool, e.g. for its statistics
+func (r *PostgresRepository) DB() *sql.DB {
+	return r.client
+}
+
 // Retrieves the connection string. Interrogates Consul if set
 func (r *PostgresRepository) getConnectionString(dc *discovery.Controller, cfg *config.Config) (string, error) {
 	address, err := dc.DiscoverService(cfg.Database.DatabaseAddress)
@@ -80,7 +99,7 @@ func (r *PostgresRepository) getConnectionString(dc *discovery.Controller, cfg *
 
 // Apply all up-migrations under ./migrations
 func (r *PostgresRepository) migrateDB(ctx context.Context) error {
-	_, span := tracing.Tracer.Start(ctx, "pg/migrateDB")
+	ctx, span := tracing.Tracer.Start(ctx, "pg/migrateDB")
 	defer span.End()
 
 	driver, err := postgres.WithInstance(r.client, &postgres.Config{})
@@ -102,38 +121,137 @@ func (r *PostgresRepository) migrateDB(ctx context.Context) error {
 	return err
 }
 
-// Adds the byte stream as file in the database
+// Adds the byte stream as file in the database, accounting it to its owners
 func (r *PostgresRepository) AddFile(ctx context.Context, file *mod.StoredFile) error {
-	_, span := tracing.Tracer.Start(ctx, "pg/AddFile")
-	span.SetAttributes(attribute.String("pg.hash", file.IDHash),
+	ctx, span := tracing.Tracer.Start(ctx, "pg/AddFile")
+	span.SetAttributes(attribute.String("pg.bucket", file.Bucket),
+		attribute.String("pg.hash", file.IDHash),
 		attribute.String("pg.filename", file.Filename))
 	defer span.End()
 
-	con := r.client
-	// hash := utils.RandStringBytes(6)
-	_, err := con.Exec(`INSERT INTO fs_entities (id_hash, filename, content) VALUES ($1, $2, $3)`, file.IDHash, file.Filename, file.Content)
-	return err
+	tx, err := r.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO fs_entities (bucket, id_hash, filename, content, uploaded_by, private) VALUES ($1, $2, $3, $4, $5, $6)`,
+		file.Bucket, file.IDHash, file.Filename, file.Content, nullString(file.UploadedBy), file.Private)
+	if err != nil {
+		return keyExists(err)
+	}
+	if err := r.addUsage(ctx, tx, file.Bucket, nullString(file.UploadedBy), int64(len(file.Content)), 1); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Removes the file from the database, if present
-func (r *PostgresRepository) RemoveFile(ctx context.Context, id_hash string) error {
-	_, span := tracing.Tracer.Start(ctx, "pg/RemoveFile")
-	span.SetAttributes(attribute.String("pg.hash", id_hash))
+// Moves the file to the trash, it will be permanently removed after the retention period. Trashed files
+// no longer count in the usage of their owners
+func (r *PostgresRepository) RemoveFile(ctx context.Context, bucket string, id_hash string) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/RemoveFile")
+	span.SetAttributes(attribute.String("pg.bucket", bucket),
+		attribute.String("pg.hash", id_hash))
 	defer span.End()
 
-	con := r.client
-	_, err := con.Exec(`DELETE FROM fs_entities WHERE id_hash=$1`, id_hash)
-	return err
+	tx, err := r.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE fs_entities SET deleted_at = now() WHERE bucket=$1 AND id_hash=$2 AND deleted_at IS NULL
+		RETURNING id_hash, bucket, uploaded_by, octet_length(content)`, bucket, id_hash)
+	if err != nil {
+		return err
+	}
+	changes, err := scanUsageChanges(rows)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return repository.ErrKeyDoesNotExist
+	}
+	if err := r.applyUsageChanges(ctx, tx, changes, -1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Adds all the files in a single transaction
+func (r *PostgresRepository) AddFiles(ctx context.Context, files []*mod.StoredFile) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/AddFiles")
+	span.SetAttributes(attribute.Int("pg.files", len(files)))
+	defer span.End()
+
+	tx, err := r.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO fs_entities (bucket, id_hash, filename, content, uploaded_by, private) VALUES ($1, $2, $3, $4, $5, $6)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, file := range files {
+		if _, err := stmt.ExecContext(ctx, file.Bucket, file.IDHash, file.Filename, file.Content, nullString(file.UploadedBy), file.Private); err != nil {
+			return keyExists(err)
+		}
+		if err := r.addUsage(ctx, tx, file.Bucket, nullString(file.UploadedBy), int64(len(file.Content)), 1); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Moves the files to the trash in a single transaction, returns the hashes that were found
+func (r *PostgresRepository) RemoveFiles(ctx context.Context, bucket string, id_hashes []string) ([]string, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/RemoveFiles")
+	span.SetAttributes(attribute.String("pg.bucket", bucket),
+		attribute.Int("pg.files", len(id_hashes)))
+	defer span.End()
+
+	tx, err := r.client.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE fs_entities SET deleted_at = now() WHERE bucket=$1 AND id_hash = ANY($2) AND deleted_at IS NULL
+		RETURNING id_hash, bucket, uploaded_by, octet_length(content)`, bucket, pq.Array(id_hashes))
+	if err != nil {
+		return nil, err
+	}
+	changes, err := scanUsageChanges(rows)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.applyUsageChanges(ctx, tx, changes, -1); err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for _, c := range changes {
+		removed = append(removed, c.id_hash)
+	}
+	return removed, tx.Commit()
 }
 
 // Queries the specified file saved on the database
-func (r *PostgresRepository) GetFile(ctx context.Context, id_hash_search string) (*mod.StoredFile, error) {
-	_, span := tracing.Tracer.Start(ctx, "pg/GetFile")
-	span.SetAttributes(attribute.String("pg.hash", id_hash_search))
+func (r *PostgresRepository) GetFile(ctx context.Context, bucket string, id_hash_search string) (*mod.StoredFile, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetFile")
+	span.SetAttributes(attribute.String("pg.bucket", bucket),
+		attribute.String("pg.hash", id_hash_search))
 	defer span.End()
 
 	con := r.client
-	rows, err := con.Query("SELECT id, id_hash, filename, content FROM fs_entities WHERE id_hash=$1", id_hash_search)
+	rows, err := con.QueryContext(ctx, "SELECT id, id_hash, filename, content, version, uploaded_by, private FROM fs_entities WHERE bucket=$1 AND id_hash=$2 AND deleted_at IS NULL",
+		bucket, id_hash_search)
 	if err != nil {
 		return nil, err
 	}
@@ -144,8 +262,11 @@ func (r *PostgresRepository) GetFile(ctx context.Context, id_hash_search string)
 	var id_hash string
 	var filename string
 	var content []byte
+	var version int
+	var uploaded_by sql.NullString
+	var private bool
 	for rows.Next() {
-		if err := rows.Scan(&id, &id_hash, &filename, &content); err != nil {
+		if err := rows.Scan(&id, &id_hash, &filename, &content, &version, &uploaded_by, &private); err != nil {
 			return nil, err
 		}
 		found = true
@@ -154,16 +275,17 @@ func (r *PostgresRepository) GetFile(ctx context.Context, id_hash_search string)
 		return nil, repository.ErrKeyDoesNotExist
 	}
 
-	return &mod.StoredFile{IDHash: id_hash, Filename: filename, Content: content}, err
+	return &mod.StoredFile{Bucket: bucket, IDHash: id_hash, Filename: filename, Content: content, Version: version, UploadedBy: uploaded_by.String, Private: private}, err
 }
 
-// Retrieves a list of current files
-func (r *PostgresRepository) GetFileList(ctx context.Context) (*[]mod.StoredFile, error) {
-	_, span := tracing.Tracer.Start(ctx, "pg/GetFileList")
+// Retrieves a list of current files in the bucket
+func (r *PostgresRepository) GetFileList(ctx context.Context, bucket string) (*[]mod.StoredFile, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetFileList")
+	span.SetAttributes(attribute.String("pg.bucket", bucket))
 	defer span.End()
 
 	con := r.client
-	rows, err := con.Query("SELECT id_hash, filename FROM fs_entities")
+	rows, err := con.QueryContext(ctx, "SELECT id_hash, filename, uploaded_by, private FROM fs_entities WHERE bucket=$1 AND deleted_at IS NULL", bucket)
 	if err != nil {
 		return nil, err
 	}
@@ -171,18 +293,28 @@ func (r *PostgresRepository) GetFileList(ctx context.Context) (*[]mod.StoredFile
 
 	var id_hash string
 	var filename string
+	var uploaded_by sql.NullString
+	var private bool
 	file_list := []mod.StoredFile{}
 	for rows.Next() {
-		if err := rows.Scan(&id_hash, &filename); err != nil {
+		if err := rows.Scan(&id_hash, &filename, &uploaded_by, &private); err != nil {
 			return nil, err
 		}
 
 		file_list = append(file_list, mod.StoredFile{
-			IDHash:   id_hash,
-			Filename: filename,
-			Content:  nil,
+			Bucket:     bucket,
+			IDHash:     id_hash,
+			Filename:   filename,
+			Content:    nil,
+			UploadedBy: uploaded_by.String,
+			Private:    private,
 		})
 	}
 
 	return &file_list, err
 }
+
+// Maps empty strings to NULL, for optional text columns
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"go-cdn/internal/tracing"
+	mod "go-cdn/pkg/model"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Adds the accumulated hit counts to each file and refreshes its last access time
+func (r *PostgresRepository) RecordHits(ctx context.Context, hits map[mod.FileRef]int64) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/RecordHits")
+	span.SetAttributes(attribute.Int("pg.hashes", len(hits)))
+	defer span.End()
+
+	tx, err := r.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for ref, count := range hits {
+		_, err := tx.ExecContext(ctx, `UPDATE fs_entities SET hits = hits + $3, last_access = now() WHERE bucket=$1 AND id_hash=$2`, ref.Bucket, ref.Hash, count)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Retrieves the most requested files, across all buckets
+func (r *PostgresRepository) GetPopularFiles(ctx context.Context, limit int) ([]mod.FileRef, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetPopularFiles")
+	span.SetAttributes(attribute.Int("pg.limit", limit))
+	defer span.End()
+
+	return r.queryFileRefs(ctx, `SELECT bucket, id_hash FROM fs_entities WHERE deleted_at IS NULL ORDER BY hits DESC, last_access DESC NULLS LAST LIMIT $1`, limit)
+}
+
+// Retrieves the most recently added files, across all buckets
+func (r *PostgresRepository) GetRecentFiles(ctx context.Context, limit int) ([]mod.FileRef, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetRecentFiles")
+	span.SetAttributes(attribute.Int("pg.limit", limit))
+	defer span.End()
+
+	return r.queryFileRefs(ctx, `SELECT bucket, id_hash FROM fs_entities WHERE deleted_at IS NULL ORDER BY created_at DESC, id DESC LIMIT $1`, limit)
+}
+
+func (r *PostgresRepository) queryFileRefs(ctx context.Context, query string, args ...any) ([]mod.FileRef, error) {
+	rows, err := r.client.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refs := []mod.FileRef{}
+	for rows.Next() {
+		var ref mod.FileRef
+		if err := rows.Scan(&ref.Bucket, &ref.Hash); err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, rows.Err()
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	mod "go-cdn/pkg/model"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Retrieves the soft-deleted files, most recently deleted first
+func (r *PostgresRepository) GetTrash(ctx context.Context, bucket string) ([]mod.TrashedFile, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetTrash")
+	span.SetAttributes(attribute.String("pg.bucket", bucket))
+	defer span.End()
+
+	rows, err := r.client.QueryContext(ctx, `SELECT bucket, id_hash, filename, deleted_at FROM fs_entities WHERE bucket=$1 AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`, bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trash := []mod.TrashedFile{}
+	for rows.Next() {
+		var f mod.TrashedFile
+		if err := rows.Scan(&f.Bucket, &f.IDHash, &f.Filename, &f.DeletedAt); err != nil {
+			return nil, err
+		}
+		trash = append(trash, f)
+	}
+	return trash, rows.Err()
+}
+
+// Brings a soft-deleted file back, accounting it to its owners again within their hard quotas. Trashed
+// files keep their hash, which new files can't take, so restoring never clashes with a newer one
+func (r *PostgresRepository) RestoreFile(ctx context.Context, bucket string, id_hash string) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/RestoreFile")
+	span.SetAttributes(attribute.String("pg.bucket", bucket),
+		attribute.String("pg.hash", id_hash))
+	defer span.End()
+
+	tx, err := r.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		UPDATE fs_entities SET deleted_at = NULL WHERE bucket=$1 AND id_hash=$2 AND deleted_at IS NOT NULL
+		RETURNING id_hash, bucket, uploaded_by, octet_length(content)`, bucket, id_hash)
+	if err != nil {
+		return err
+	}
+	changes, err := scanUsageChanges(rows)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return repository.ErrKeyDoesNotExist
+	}
+	if err := r.applyUsageChanges(ctx, tx, changes, 1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Permanently removes a soft-deleted file along with its versions
+func (r *PostgresRepository) PurgeFile(ctx context.Context, bucket string, id_hash string) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/PurgeFile")
+	span.SetAttributes(attribute.String("pg.bucket", bucket),
+		attribute.String("pg.hash", id_hash))
+	defer span.End()
+
+	res, err := r.client.ExecContext(ctx, `DELETE FROM fs_entities WHERE bucket=$1 AND id_hash=$2 AND deleted_at IS NOT NULL`, bucket, id_hash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrKeyDoesNotExist
+	}
+	return nil
+}
+
+// Permanently removes the files soft-deleted before the given time, returns how many were removed
+func (r *PostgresRepository) PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/PurgeDeletedBefore")
+	defer span.End()
+
+	res, err := r.client.ExecContext(ctx, `DELETE FROM fs_entities WHERE deleted_at IS NOT NULL AND deleted_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	span.SetAttributes(attribute.Int64("pg.purged", n))
+	return n, err
+}
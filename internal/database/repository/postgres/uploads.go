@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	mod "go-cdn/pkg/model"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Registers a new resumable upload with no data received yet
+func (r *PostgresRepository) CreateUpload(ctx context.Context, upload *mod.Upload) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/CreateUpload")
+	span.SetAttributes(attribute.String("pg.upload_id", upload.ID),
+		attribute.Int64("pg.length", upload.Length))
+	defer span.End()
+
+	_, err := r.client.ExecContext(ctx, `INSERT INTO fs_uploads (upload_id, bucket, length, filename, metadata, uploaded_by, private, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		upload.ID, upload.Bucket, upload.Length, upload.Filename, upload.Metadata, nullString(upload.UploadedBy), upload.Private, upload.ExpiresAt)
+	return err
+}
+
+// Retrieves an upload that has not expired yet
+func (r *PostgresRepository) GetUpload(ctx context.Context, upload_id string) (*mod.Upload, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetUpload")
+	span.SetAttributes(attribute.String("pg.upload_id", upload_id))
+	defer span.End()
+
+	upload := &mod.Upload{}
+	err := r.client.QueryRowContext(ctx, `SELECT upload_id, bucket, length, upload_offset, filename, metadata, expires_at FROM fs_uploads WHERE upload_id=$1 AND expires_at > now()`, upload_id).
+		Scan(&upload.ID, &upload.Bucket, &upload.Length, &upload.Offset, &upload.Filename, &upload.Metadata, &upload.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// Stores a chunk at the given offset. The row lock serializes concurrent PATCH requests on the same upload
+func (r *PostgresRepository) AppendChunk(ctx context.Context, upload_id string, offset int64, chunk []byte) (int64, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/AppendChunk")
+	span.SetAttributes(attribute.String("pg.upload_id", upload_id),
+		attribute.Int64("pg.offset", offset),
+		attribute.Int("pg.chunk_size", len(chunk)))
+	defer span.End()
+
+	tx, err := r.client.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var current, length int64
+	err = tx.QueryRowContext(ctx, `SELECT upload_offset, length FROM fs_uploads WHERE upload_id=$1 AND expires_at > now() FOR UPDATE`, upload_id).
+		Scan(&current, &length)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, repository.ErrKeyDoesNotExist
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if current != offset {
+		return current, fmt.Errorf("offset=%d stored=%d: %w", offset, current, repository.ErrOffsetMismatch)
+	}
+	if offset+int64(len(chunk)) > length {
+		return current, fmt.Errorf("chunk exceeds upload length=%d: %w", length, repository.ErrOffsetMismatch)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO fs_upload_chunks (upload_id, chunk_offset, content) VALUES ($1, $2, $3)`, upload_id, offset, chunk)
+	if err != nil {
+		return current, err
+	}
+
+	current += int64(len(chunk))
+	_, err = tx.ExecContext(ctx, `UPDATE fs_uploads SET upload_offset=$2 WHERE upload_id=$1`, upload_id, current)
+	if err != nil {
+		return offset, err
+	}
+
+	return current, tx.Commit()
+}
+
+// Reads the first n bytes of the upload from the chunks starting before n
+func (r *PostgresRepository) ReadUploadHead(ctx context.Context, upload_id string, n int) ([]byte, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/ReadUploadHead")
+	span.SetAttributes(attribute.String("pg.upload_id", upload_id))
+	defer span.End()
+
+	rows, err := r.client.QueryContext(ctx, `SELECT substring(content from 1 for $3) FROM fs_upload_chunks WHERE upload_id=$1 AND chunk_offset < $2 ORDER BY chunk_offset`,
+		upload_id, int64(n), n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	head := []byte{}
+	for rows.Next() {
+		var chunk []byte
+		if err := rows.Scan(&chunk); err != nil {
+			return nil, err
+		}
+		head = append(head, chunk...)
+	}
+	if len(head) > n {
+		head = head[:n]
+	}
+	return head, rows.Err()
+}
+
+// Concatenates the chunks into a new file entity and removes the upload, all in a single transaction
+func (r *PostgresRepository) FinalizeUpload(ctx context.Context, upload_id string, id_hash string) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/FinalizeUpload")
+	span.SetAttributes(attribute.String("pg.upload_id", upload_id),
+		attribute.String("pg.hash", id_hash))
+	defer span.End()
+
+	tx, err := r.client.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO fs_entities (bucket, id_hash, filename, content, uploaded_by, private)
+		SELECT u.bucket, $1, u.filename, COALESCE(string_agg(c.content, ''::bytea ORDER BY c.chunk_offset), ''::bytea), u.uploaded_by, u.private
+		FROM fs_uploads u LEFT JOIN fs_upload_chunks c ON c.upload_id = u.upload_id
+		WHERE u.upload_id=$2 AND u.upload_offset = u.length
+		GROUP BY u.upload_id, u.bucket, u.filename, u.uploaded_by, u.private
+		RETURNING id_hash, bucket, uploaded_by, octet_length(content)`, id_hash, upload_id)
+	if err != nil {
+		return keyExists(err)
+	}
+	changes, err := scanUsageChanges(rows)
+	if err != nil {
+		return keyExists(err)
+	}
+	if len(changes) == 0 {
+		return repository.ErrKeyDoesNotExist
+	}
+	if err := r.applyUsageChanges(ctx, tx, changes, 1); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM fs_uploads WHERE upload_id=$1`, upload_id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Removes the upload and its chunks, if present
+func (r *PostgresRepository) RemoveUpload(ctx context.Context, upload_id string) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/RemoveUpload")
+	span.SetAttributes(attribute.String("pg.upload_id", upload_id))
+	defer span.End()
+
+	_, err := r.client.ExecContext(ctx, `DELETE FROM fs_uploads WHERE upload_id=$1`, upload_id)
+	return err
+}
+
+// Removes abandoned uploads past their expiration, returns how many were deleted
+func (r *PostgresRepository) RemoveExpiredUploads(ctx context.Context) (int64, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/RemoveExpiredUploads")
+	defer span.End()
+
+	res, err := r.client.ExecContext(ctx, `DELETE FROM fs_uploads WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
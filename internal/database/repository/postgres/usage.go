@@ -0,0 +1,220 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	mod "go-cdn/pkg/model"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Adjusts the usage of the owners of a file within the transaction changing it, so that the counters
+// can't drift from the stored files
+func (r *PostgresRepository) addUsage(ctx context.Context, tx *sql.Tx, bucket string, uploaded_by sql.NullString, bytes int64, objects int64) error {
+	if err := r.addOwnerUsage(ctx, tx, mod.BucketOwner(bucket), bytes, objects); err != nil {
+		return err
+	}
+	if uploaded_by.Valid {
+		return r.addOwnerUsage(ctx, tx, uploaded_by.String, bytes, objects)
+	}
+	return nil
+}
+
+// Growing beyond a hard quota fails with repository.ErrQuotaExceeded or ErrObjectQuotaExceeded. The update
+// locks the usage row until the transaction ends, so concurrent uploads can't both slip under the limit
+func (r *PostgresRepository) addOwnerUsage(ctx context.Context, tx *sql.Tx, owner string, bytes int64, objects int64) error {
+	var total_bytes, total_objects int64
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO storage_usage (owner, bytes, objects) VALUES ($1, $2, $3)
+		ON CONFLICT (owner) DO UPDATE SET bytes = storage_usage.bytes + $2, objects = storage_usage.objects + $3, updated_at = now()
+		RETURNING bytes, objects`,
+		owner, bytes, objects).Scan(&total_bytes, &total_objects)
+	if err != nil || (bytes <= 0 && objects <= 0) {
+		return err
+	}
+
+	hard_bytes, hard_objects, err := r.hardQuota(ctx, tx, owner)
+	switch {
+	case err != nil:
+		return err
+	case bytes > 0 && hard_bytes > 0 && total_bytes > hard_bytes:
+		return repository.ErrQuotaExceeded
+	case objects > 0 && hard_objects > 0 && total_objects > hard_objects:
+		return repository.ErrObjectQuotaExceeded
+	}
+	return nil
+}
+
+// Hard limits of owner, resolved as the server does: its explicit quota or, for uploaders, the configured
+// defaults. Buckets are also limited by their quota_bytes setting. 0 means unlimited
+func (r *PostgresRepository) hardQuota(ctx context.Context, tx *sql.Tx, owner string) (int64, int64, error) {
+	var hard_bytes, hard_objects int64
+	is_bucket := strings.HasPrefix(owner, mod.BucketOwner(""))
+
+	err := tx.QueryRowContext(ctx, `SELECT hard_bytes, hard_objects FROM storage_quotas WHERE owner=$1`, owner).
+		Scan(&hard_bytes, &hard_objects)
+	switch {
+	case errors.Is(err, sql.ErrNoRows) && !is_bucket:
+		hard_bytes, hard_objects = r.quota.QuotaHardBytes, r.quota.QuotaHardObjects
+	case err != nil && !errors.Is(err, sql.ErrNoRows):
+		return 0, 0, err
+	}
+	if !is_bucket {
+		return hard_bytes, hard_objects, nil
+	}
+
+	var quota_bytes int64
+	err = tx.QueryRowContext(ctx, `SELECT quota_bytes FROM buckets WHERE name=$1`, strings.TrimPrefix(owner, mod.BucketOwner(""))).
+		Scan(&quota_bytes)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, err
+	}
+	if quota_bytes > 0 && (hard_bytes == 0 || quota_bytes < hard_bytes) {
+		hard_bytes = quota_bytes
+	}
+	return hard_bytes, hard_objects, nil
+}
+
+// A file added or removed, as returned by "RETURNING id_hash, bucket, uploaded_by, octet_length(content)"
+type usageChange struct {
+	id_hash     string
+	bucket      string
+	uploaded_by sql.NullString
+	size        int64
+}
+
+// Reads all the changes before the usage is updated, since the connection of the transaction is busy
+// until the rows are closed
+func scanUsageChanges(rows *sql.Rows) ([]usageChange, error) {
+	defer rows.Close()
+
+	changes := []usageChange{}
+	for rows.Next() {
+		var c usageChange
+		if err := rows.Scan(&c.id_hash, &c.bucket, &c.uploaded_by, &c.size); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// sign is 1 when the files were added, -1 when they were removed
+func (r *PostgresRepository) applyUsageChanges(ctx context.Context, tx *sql.Tx, changes []usageChange, sign int64) error {
+	for _, c := range changes {
+		if err := r.addUsage(ctx, tx, c.bucket, c.uploaded_by, sign*c.size, sign); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the usage of an owner, zero if it never stored anything
+func (r *PostgresRepository) GetUsage(ctx context.Context, owner string) (*mod.Usage, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetUsage")
+	span.SetAttributes(attribute.String("pg.owner", owner))
+	defer span.End()
+
+	u := &mod.Usage{Owner: owner}
+	err := r.client.QueryRowContext(ctx, `SELECT bytes, objects, updated_at FROM storage_usage WHERE owner=$1`, owner).
+		Scan(&u.Bytes, &u.Objects, &u.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Returns the usage of all the owners, the largest first
+func (r *PostgresRepository) GetUsages(ctx context.Context) ([]mod.Usage, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetUsages")
+	defer span.End()
+
+	rows, err := r.client.QueryContext(ctx, `SELECT owner, bytes, objects, updated_at FROM storage_usage ORDER BY bytes DESC, owner`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usages := []mod.Usage{}
+	for rows.Next() {
+		var u mod.Usage
+		if err := rows.Scan(&u.Owner, &u.Bytes, &u.Objects, &u.UpdatedAt); err != nil {
+			return nil, err
+		}
+		usages = append(usages, u)
+	}
+	return usages, rows.Err()
+}
+
+func (r *PostgresRepository) GetQuota(ctx context.Context, owner string) (*mod.Quota, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetQuota")
+	span.SetAttributes(attribute.String("pg.owner", owner))
+	defer span.End()
+
+	q := &mod.Quota{Owner: owner}
+	err := r.client.QueryRowContext(ctx, `SELECT soft_bytes, hard_bytes, soft_objects, hard_objects FROM storage_quotas WHERE owner=$1`, owner).
+		Scan(&q.SoftBytes, &q.HardBytes, &q.SoftObjects, &q.HardObjects)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (r *PostgresRepository) GetQuotas(ctx context.Context) ([]mod.Quota, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetQuotas")
+	defer span.End()
+
+	rows, err := r.client.QueryContext(ctx, `SELECT owner, soft_bytes, hard_bytes, soft_objects, hard_objects FROM storage_quotas ORDER BY owner`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quotas := []mod.Quota{}
+	for rows.Next() {
+		var q mod.Quota
+		if err := rows.Scan(&q.Owner, &q.SoftBytes, &q.HardBytes, &q.SoftObjects, &q.HardObjects); err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, q)
+	}
+	return quotas, rows.Err()
+}
+
+// Creates or replaces the quota of an owner
+func (r *PostgresRepository) SetQuota(ctx context.Context, quota *mod.Quota) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/SetQuota")
+	span.SetAttributes(attribute.String("pg.owner", quota.Owner))
+	defer span.End()
+
+	_, err := r.client.ExecContext(ctx, `
+		INSERT INTO storage_quotas (owner, soft_bytes, hard_bytes, soft_objects, hard_objects) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (owner) DO UPDATE SET soft_bytes = $2, hard_bytes = $3, soft_objects = $4, hard_objects = $5`,
+		quota.Owner, quota.SoftBytes, quota.HardBytes, quota.SoftObjects, quota.HardObjects)
+	return err
+}
+
+func (r *PostgresRepository) RemoveQuota(ctx context.Context, owner string) error {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/RemoveQuota")
+	span.SetAttributes(attribute.String("pg.owner", owner))
+	defer span.End()
+
+	res, err := r.client.ExecContext(ctx, `DELETE FROM storage_quotas WHERE owner=$1`, owner)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return repository.ErrKeyDoesNotExist
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	mod "go-cdn/pkg/model"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Moves the current revision into fs_entity_versions and overwrites the entity, keeping its id and hash.
+// Only the keep newest archived revisions are retained
+func (r *PostgresRepository) ReplaceFile(ctx context.Context, file *mod.StoredFile, keep int) (int, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/ReplaceFile")
+	span.SetAttributes(attribute.String("pg.bucket", file.Bucket),
+		attribute.String("pg.hash", file.IDHash),
+		attribute.String("pg.filename", file.Filename))
+	defer span.End()
+
+	tx, err := r.client.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	var old_size int64
+	var old_uploaded_by sql.NullString
+	err = tx.QueryRowContext(ctx, `SELECT id, octet_length(content), uploaded_by FROM fs_entities WHERE bucket=$1 AND id_hash=$2 AND deleted_at IS NULL FOR UPDATE`, file.Bucket, file.IDHash).
+		Scan(&id, &old_size, &old_uploaded_by)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, repository.ErrKeyDoesNotExist
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO fs_entity_versions (entity_id, version, filename, content, uploaded_by, created_at)
+		SELECT id, version, filename, content, uploaded_by, COALESCE(updated_at, created_at) FROM fs_entities WHERE id=$1`, id)
+	if err != nil {
+		return 0, err
+	}
+
+	// The archived revisions aren't accounted, so they are bounded instead
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM fs_entity_versions WHERE entity_id=$1 AND version <= (SELECT version FROM fs_entities WHERE id=$1) - $2`, id, keep)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = tx.QueryRowContext(ctx, `UPDATE fs_entities SET filename=$2, content=$3, uploaded_by=$4, version=version+1, updated_at=now() WHERE id=$1 RETURNING version`,
+		id, file.Filename, file.Content, nullString(file.UploadedBy)).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	span.SetAttributes(attribute.Int("pg.version", version))
+
+	// Only the current content is accounted, to whoever uploaded it. The archived revisions are capped above.
+	// Owners are only charged for the growth, so that the quotas don't count the file twice
+	size := int64(len(file.Content))
+	uploaded_by := nullString(file.UploadedBy)
+	if uploaded_by == old_uploaded_by {
+		err = r.addUsage(ctx, tx, file.Bucket, uploaded_by, size-old_size, 0)
+	} else {
+		err = r.addOwnerUsage(ctx, tx, mod.BucketOwner(file.Bucket), size-old_size, 0)
+		if err == nil && old_uploaded_by.Valid {
+			err = r.addOwnerUsage(ctx, tx, old_uploaded_by.String, -old_size, -1)
+		}
+		if err == nil && uploaded_by.Valid {
+			err = r.addOwnerUsage(ctx, tx, uploaded_by.String, size, 1)
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return version, tx.Commit()
+}
+
+// Retrieves a specific revision, which might also be the current one. Privacy applies to all the revisions
+func (r *PostgresRepository) GetFileVersion(ctx context.Context, bucket string, id_hash string, version int) (*mod.StoredFile, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetFileVersion")
+	span.SetAttributes(attribute.String("pg.bucket", bucket),
+		attribute.String("pg.hash", id_hash),
+		attribute.Int("pg.version", version))
+	defer span.End()
+
+	file := &mod.StoredFile{Bucket: bucket, IDHash: id_hash, Version: version}
+	var uploaded_by sql.NullString
+	err := r.client.QueryRowContext(ctx, `
+		SELECT filename, content, uploaded_by, private FROM fs_entities WHERE bucket=$1 AND id_hash=$2 AND version=$3 AND deleted_at IS NULL
+		UNION ALL
+		SELECT v.filename, v.content, v.uploaded_by, e.private FROM fs_entity_versions v JOIN fs_entities e ON e.id = v.entity_id
+		WHERE e.bucket=$1 AND e.id_hash=$2 AND v.version=$3 AND e.deleted_at IS NULL`, bucket, id_hash, version).
+		Scan(&file.Filename, &file.Content, &uploaded_by, &file.Private)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	file.UploadedBy = uploaded_by.String
+	return file, nil
+}
+
+// Lists all the revisions of a file, newest first
+func (r *PostgresRepository) GetFileVersions(ctx context.Context, bucket string, id_hash string) ([]mod.FileVersion, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "pg/GetFileVersions")
+	span.SetAttributes(attribute.String("pg.bucket", bucket),
+		attribute.String("pg.hash", id_hash))
+	defer span.End()
+
+	rows, err := r.client.QueryContext(ctx, `
+		SELECT version, filename, octet_length(content), uploaded_by, COALESCE(updated_at, created_at), true FROM fs_entities WHERE bucket=$1 AND id_hash=$2 AND deleted_at IS NULL
+		UNION ALL
+		SELECT v.version, v.filename, octet_length(v.content), v.uploaded_by, v.created_at, false FROM fs_entity_versions v
+		JOIN fs_entities e ON e.id = v.entity_id WHERE e.bucket=$1 AND e.id_hash=$2 AND e.deleted_at IS NULL
+		ORDER BY 1 DESC`, bucket, id_hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []mod.FileVersion{}
+	for rows.Next() {
+		var v mod.FileVersion
+		var size sql.NullInt64
+		var uploaded_by sql.NullString
+		if err := rows.Scan(&v.Version, &v.Filename, &size, &uploaded_by, &v.CreatedAt, &v.Current); err != nil {
+			return nil, err
+		}
+		v.Size = size.Int64
+		v.UploadedBy = uploaded_by.String
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	return versions, nil
+}
@@ -0,0 +1,95 @@
+package redis
+
+import (
+	"context"
+	"go-cdn/internal/tracing"
+	"go-cdn/pkg/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Set of the periods with pending traffic, each one counted in a hash of egressPeriodKey
+const egressPeriodsKey = "egress:periods"
+
+func egressPeriodKey(period time.Time) string {
+	return "egress:" + strconv.FormatInt(period.Unix(), 10)
+}
+
+// Fields of a period hash are bytes:<bucket>/<hash> and requests:<bucket>/<hash>
+func egressField(counter string, key model.EgressKey) string {
+	return counter + ":" + key.Bucket + "/" + key.Hash
+}
+
+// Adds the traffic counted by an instance to the shared counters
+func (rc *RedisRepository) AddEgress(ctx context.Context, counts map[model.EgressKey]model.EgressCount) error {
+	ctx, span := tracing.Tracer.Start(ctx, "rd/AddEgress")
+	span.SetAttributes(attribute.Int("rd.hashes", len(counts)))
+	defer span.End()
+
+	_, err := rc.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, count := range counts {
+			pipe.HIncrBy(ctx, egressPeriodKey(key.Period), egressField("bytes", key), count.Bytes)
+			pipe.HIncrBy(ctx, egressPeriodKey(key.Period), egressField("requests", key), count.Requests)
+			pipe.SAdd(ctx, egressPeriodsKey, key.Period.Unix())
+		}
+		return nil
+	})
+	return err
+}
+
+// Removes a period from the pending ones and returns its counters, atomically so that the counts can't be
+// returned twice nor left behind without their period
+var takeEgressScript = redis.NewScript(`
+redis.call('SREM', KEYS[1], ARGV[1])
+local fields = redis.call('HGETALL', KEYS[2])
+redis.call('DEL', KEYS[2])
+return fields
+`)
+
+// Removes and returns the pending traffic. Writes happening meanwhile recreate the period and add it back.
+// On failure the counts already taken are returned along with the error
+func (rc *RedisRepository) TakeEgress(ctx context.Context) (map[model.EgressKey]model.EgressCount, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "rd/TakeEgress")
+	defer span.End()
+
+	periods, err := rc.client.SMembers(ctx, egressPeriodsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[model.EgressKey]model.EgressCount{}
+	for _, p := range periods {
+		unix, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			rc.client.SRem(ctx, egressPeriodsKey, p)
+			continue
+		}
+		period := time.Unix(unix, 0).UTC()
+
+		fields, err := takeEgressScript.Run(ctx, rc.client, []string{egressPeriodsKey, egressPeriodKey(period)}, p).StringSlice()
+		if err != nil {
+			return counts, err
+		}
+		// HGETALL replies with the fields and their values in turn
+		for i := 0; i+1 < len(fields); i += 2 {
+			counter, ref, _ := strings.Cut(fields[i], ":")
+			bucket, hash, _ := strings.Cut(ref, "/")
+			n, _ := strconv.ParseInt(fields[i+1], 10, 64)
+
+			key := model.EgressKey{Bucket: bucket, Hash: hash, Period: period}
+			count := counts[key]
+			switch counter {
+			case "bytes":
+				count.Bytes += n
+			case "requests":
+				count.Requests += n
+			}
+			counts[key] = count
+		}
+	}
+	return counts, nil
+}
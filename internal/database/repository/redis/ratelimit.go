@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"context"
+	"go-cdn/internal/ratelimit"
+	"go-cdn/internal/tracing"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// GCRA: a key stores the theoretical arrival time of the next request, in microseconds. A request is allowed
+// while it's less than burst emission intervals ahead of now. The clock of Redis is used so that the
+// instances don't need to agree on the time. Returns allowed, remaining, retry after and reset
+var gcraScript = redis.NewScript(`
+local now_t = redis.call('TIME')
+local now = tonumber(now_t[1]) * 1000000 + tonumber(now_t[2])
+local emission = tonumber(ARGV[1])
+local tolerance = emission * tonumber(ARGV[2])
+
+local tat = tonumber(redis.call('GET', KEYS[1]) or now)
+if tat < now then
+	tat = now
+end
+
+local new_tat = tat + emission
+local allow_at = new_tat - tolerance
+if allow_at > now then
+	return {0, 0, allow_at - now, tat - now}
+end
+
+redis.call('SET', KEYS[1], new_tat, 'PX', math.ceil((new_tat - now) / 1000))
+return {1, math.floor((now + tolerance - new_tat) / emission), 0, new_tat - now}
+`)
+
+// Allow makes the repository a ratelimit.Limiter shared by all the instances
+func (rc *RedisRepository) Allow(ctx context.Context, key string, rate ratelimit.Rate) (ratelimit.Result, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "rd/Allow")
+	span.SetAttributes(attribute.String("rd.key", key))
+	defer span.End()
+
+	// The emission interval would be infinite
+	if !rate.Valid() {
+		return ratelimit.Result{Limit: rate.Burst}, nil
+	}
+	emission := int64(float64(time.Second/time.Microsecond) / rate.PerSecond)
+	values, err := gcraScript.Run(ctx, rc.client, []string{"ratelimit:" + key}, emission, rate.Burst).Int64Slice()
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+
+	return ratelimit.Result{
+		Allowed:    values[0] == 1,
+		Limit:      rate.Burst,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Microsecond,
+		Reset:      time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
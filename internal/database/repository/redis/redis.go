@@ -15,24 +15,22 @@ import (
 )
 
 type RedisRepository struct {
-	ctx    context.Context
 	client *redis.Client
+	ttl    time.Duration
 }
 
 func New(ctx context.Context, dc *discovery.Controller, cfg *config.Config) (*RedisRepository, error) {
-	_, span := tracing.Tracer.Start(ctx, "rd/New")
+	ctx, span := tracing.Tracer.Start(ctx, "rd/New")
 	defer span.End()
 
-	rc := &RedisRepository{
-		ctx: context.Background(),
-	}
+	rc := &RedisRepository{ttl: cfg.Cache.RedisTTL}
 	err := rc.connect(ctx, dc, cfg)
 	return rc, err
 }
 
 func (rc *RedisRepository) connect(ctx context.Context, dc *discovery.Controller, cfg *config.Config) error {
-    _, span := tracing.Tracer.Start(ctx, "rd/connect")
-    defer span.End()
+	ctx, span := tracing.Tracer.Start(ctx, "rd/connect")
+	defer span.End()
 
 	address, err := rc.GetConnectionString(dc, cfg)
 	if err != nil {
@@ -46,15 +44,27 @@ func (rc *RedisRepository) connect(ctx context.Context, dc *discovery.Controller
 		ReadTimeout:  2 * time.Second,
 		WriteTimeout: 2 * time.Second,
 	})
+	rc.client.AddHook(tracingHook{address: address})
 
-	_, err = rc.client.Ping(rc.ctx).Result()
+	_, err = rc.client.Ping(ctx).Result()
 	return err
 }
 
+func (rc *RedisRepository) Ping(ctx context.Context) error {
+	ctx, span := tracing.Tracer.Start(ctx, "rd/Ping")
+	defer span.End()
+
+	return rc.client.Ping(ctx).Err()
+}
+
 func (rc *RedisRepository) CloseConnection() error {
 	return rc.client.Close()
 }
 
+func (rc *RedisRepository) PoolStats() *redis.PoolStats {
+	return rc.client.PoolStats()
+}
+
 func (rc *RedisRepository) GetConnectionString(dc *discovery.Controller, cfg *config.Config) (string, error) {
 	address, err := dc.DiscoverService(cfg.Cache.RedisAddress)
 	if err != nil {
@@ -64,12 +74,40 @@ func (rc *RedisRepository) GetConnectionString(dc *discovery.Controller, cfg *co
 	return address, nil
 }
 
-func (rc *RedisRepository) GetFile(ctx context.Context, id_hash string) (*model.StoredFile, error) {
-	_, span := tracing.Tracer.Start(ctx, "rd/GetFile")
-	span.SetAttributes(attribute.String("rd.hash", id_hash))
+// Keys are namespaced by bucket, so that equal hashes in different buckets don't collide, and apart from
+// the egress and rate limit keys, so that no bucket name can reach them
+func fileKey(bucket string, id_hash string) string {
+	return "file:" + bucket + ":" + id_hash
+}
+
+// A purge keeps the file from being cached again for a while, so that a GET which read the file before
+// its change can't fill the cache with the old content or access settings once the purge is done
+const purgeFence = time.Minute
+
+func fenceKey(bucket string, id_hash string) string {
+	return "fence:" + bucket + ":" + id_hash
+}
+
+// Caches a file unless it was purged recently, with an optional expiration in milliseconds
+var fillScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+func (rc *RedisRepository) GetFile(ctx context.Context, bucket string, id_hash string) (*model.StoredFile, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "rd/GetFile")
+	span.SetAttributes(attribute.String("rd.bucket", bucket),
+		attribute.String("rd.hash", id_hash))
 	defer span.End()
 
-	bytes, err := rc.client.Get(rc.ctx, id_hash).Bytes()
+	bytes, err := rc.client.Get(ctx, fileKey(bucket, id_hash)).Bytes()
 
 	// Documentation at https://redis.uptrace.dev/guide/go-redis.html#redis-nil
 	switch {
@@ -79,28 +117,76 @@ func (rc *RedisRepository) GetFile(ctx context.Context, id_hash string) (*model.
 		return nil, err
 	}
 
-	return &model.StoredFile{IDHash: id_hash, Filename: "", Content: bytes}, nil
+	return &model.StoredFile{Bucket: bucket, IDHash: id_hash, Filename: "", Content: bytes}, nil
 }
-func (rc *RedisRepository) GetFileList(ctx context.Context) (*[]model.StoredFile, error) {
-	_, span := tracing.Tracer.Start(ctx, "rd/GetFileList")
+func (rc *RedisRepository) GetFileList(ctx context.Context, bucket string) (*[]model.StoredFile, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "rd/GetFileList")
 	defer span.End()
 	return nil, fmt.Errorf("not implemented")
 }
 
 func (rc *RedisRepository) AddFile(ctx context.Context, file *model.StoredFile) error {
-	_, span := tracing.Tracer.Start(ctx, "rd/AddFile")
-	span.SetAttributes(attribute.String("rd.hash", file.IDHash))
+	ctx, span := tracing.Tracer.Start(ctx, "rd/AddFile")
+	span.SetAttributes(attribute.String("rd.bucket", file.Bucket),
+		attribute.String("rd.hash", file.IDHash))
 	defer span.End()
 
-	_, err := rc.client.Set(rc.ctx, file.IDHash, file.Content, 0).Result()
+	keys := []string{fileKey(file.Bucket, file.IDHash), fenceKey(file.Bucket, file.IDHash)}
+	return fillScript.Run(ctx, rc.client, keys, file.Content, rc.ttl.Milliseconds()).Err()
+}
+
+func (rc *RedisRepository) RemoveFile(ctx context.Context, bucket string, id_hash string) error {
+	ctx, span := tracing.Tracer.Start(ctx, "rd/RemoveFile")
+	span.SetAttributes(attribute.String("rd.bucket", bucket),
+		attribute.String("rd.hash", id_hash))
+	defer span.End()
+
+	_, err := rc.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, fileKey(bucket, id_hash))
+		pipe.Set(ctx, fenceKey(bucket, id_hash), 1, purgeFence)
+		return nil
+	})
 	return err
 }
 
-func (rc *RedisRepository) RemoveFile(ctx context.Context, id_hash string) error {
-	_, span := tracing.Tracer.Start(ctx, "rd/RemoveFile")
-	span.SetAttributes(attribute.String("rd.hash", id_hash))
+func (rc *RedisRepository) AddFiles(ctx context.Context, files []*model.StoredFile) error {
+	ctx, span := tracing.Tracer.Start(ctx, "rd/AddFiles")
+	span.SetAttributes(attribute.Int("rd.files", len(files)))
 	defer span.End()
 
-	_, err := rc.client.Del(rc.ctx, id_hash).Result()
+	_, err := rc.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, file := range files {
+			keys := []string{fileKey(file.Bucket, file.IDHash), fenceKey(file.Bucket, file.IDHash)}
+			fillScript.Eval(ctx, pipe, keys, file.Content, rc.ttl.Milliseconds())
+		}
+		return nil
+	})
 	return err
 }
+
+func (rc *RedisRepository) RemoveFiles(ctx context.Context, bucket string, id_hashes []string) ([]string, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "rd/RemoveFiles")
+	span.SetAttributes(attribute.String("rd.bucket", bucket),
+		attribute.Int("rd.files", len(id_hashes)))
+	defer span.End()
+
+	cmds, err := rc.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id_hash := range id_hashes {
+			pipe.Del(ctx, fileKey(bucket, id_hash))
+			pipe.Set(ctx, fenceKey(bucket, id_hash), 1, purgeFence)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Each hash queued a DEL followed by a SET
+	removed := []string{}
+	for i, id_hash := range id_hashes {
+		if cmds[2*i].(*redis.IntCmd).Val() > 0 {
+			removed = append(removed, id_hash)
+		}
+	}
+	return removed, nil
+}
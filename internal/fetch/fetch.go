@@ -0,0 +1,196 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-cdn/internal/config"
+	"go-cdn/internal/tracing"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"syscall"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var ErrUnsupportedScheme = errors.New("only http and https urls are supported")
+var ErrForbiddenAddress = errors.New("destination address is not allowed")
+var ErrTooManyRedirects = errors.New("too many redirects")
+var ErrTooLarge = errors.New("remote file exceeds the maximum size")
+var ErrBadStatus = errors.New("remote server returned an error")
+
+// Address ranges that are never reachable unless explicitly allowed, on top of loopback, private,
+// link-local, multicast and unspecified addresses
+var deniedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",     // "This" network
+	"100.64.0.0/10", // Carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // Benchmarking
+	"240.0.0.0/4",   // Reserved
+	"64:ff9b::/96",  // NAT64, may map to internal IPv4 addresses
+)
+
+type Result struct {
+	Content     []byte
+	ContentType string // As declared by the remote server
+	Filename    string // Last path element of the final url
+}
+
+// Fetcher downloads remote files, refusing to connect to internal addresses. The check is done on the
+// resolved address at dial time, so it also covers redirects and DNS rebinding
+type Fetcher struct {
+	client  *http.Client
+	allowed []*net.IPNet
+	maxSize int64
+}
+
+func New(cfg *config.Config) (*Fetcher, error) {
+	f := &Fetcher{maxSize: cfg.Upload.UploadMaxSize}
+
+	for _, cidr := range cfg.Fetch.FetchAllowedNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("allowed network %s: %w", cidr, err)
+		}
+		f.allowed = append(f.allowed, network)
+	}
+
+	dialer := &net.Dialer{
+		Timeout: cfg.Fetch.FetchTimeout,
+		Control: f.checkAddress,
+	}
+	transport := &http.Transport{
+		Proxy:                 nil, // A proxy would hide the real destination from checkAddress
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.Fetch.FetchTimeout,
+		ResponseHeaderTimeout: cfg.Fetch.FetchTimeout,
+		MaxIdleConns:          10,
+	}
+
+	max_redirects := cfg.Fetch.FetchMaxRedirects
+	f.client = &http.Client{
+		Transport: transport, // No request id nor trace context towards the origins, which anyone picks
+		Timeout:   cfg.Fetch.FetchTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > max_redirects {
+				return ErrTooManyRedirects
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrUnsupportedScheme
+			}
+			return nil
+		},
+	}
+	return f, nil
+}
+
+func (f *Fetcher) Fetch(ctx context.Context, raw_url string) (*Result, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "fetch/Fetch")
+	span.SetAttributes(attribute.String("fetch.url", raw_url))
+	defer span.End()
+
+	u, err := url.Parse(raw_url)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, ErrUnsupportedScheme
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "go-cdn-fetch")
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	span.SetAttributes(attribute.Int("fetch.status", res.StatusCode))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("status=%d: %w", res.StatusCode, ErrBadStatus)
+	}
+
+	if f.maxSize > 0 && res.ContentLength > f.maxSize {
+		return nil, ErrTooLarge
+	}
+
+	body := io.Reader(res.Body)
+	if f.maxSize > 0 {
+		body = io.LimitReader(res.Body, f.maxSize+1)
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if f.maxSize > 0 && int64(len(content)) > f.maxSize {
+		return nil, ErrTooLarge
+	}
+
+	content_type, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil {
+		content_type = ""
+	}
+
+	filename := path.Base(res.Request.URL.Path)
+	if filename == "/" || filename == "." {
+		filename = ""
+	}
+
+	return &Result{Content: content, ContentType: content_type, Filename: filename}, nil
+}
+
+// Dialer hook, runs after DNS resolution for every connection attempt
+func (f *Fetcher) checkAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("address=%s: %w", address, ErrForbiddenAddress)
+	}
+
+	for _, network := range f.allowed {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+
+	if isDenied(ip) {
+		return fmt.Errorf("address=%s: %w", address, ErrForbiddenAddress)
+	}
+	return nil
+}
+
+func isDenied(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range deniedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -11,7 +11,27 @@ import (
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
-func NewLogger(cfg *config.Config) *zap.SugaredLogger {
+// Levels of the outputs, changed at runtime through the admin API
+type Levels struct {
+	File    zap.AtomicLevel
+	Console zap.AtomicLevel
+}
+
+// Parses the configured level, falling back to def when unset or invalid
+func level(text string, def zapcore.Level) zap.AtomicLevel {
+	l, err := zap.ParseAtomicLevel(text)
+	if err != nil {
+		return zap.NewAtomicLevelAt(def)
+	}
+	return l
+}
+
+func NewLogger(cfg *config.Config) (*zap.SugaredLogger, *Levels) {
+	levels := &Levels{
+		File:    level(cfg.Telemetry.LogLevel, zap.InfoLevel),
+		Console: level(cfg.Telemetry.LogConsoleLevel, zap.DebugLevel),
+	}
+
 	writer_file := zapcore.AddSync(&lumberjack.Logger{
 		Filename: fmt.Sprintf("%s/go-cdn-%s.log",
 			strings.TrimRight(cfg.Telemetry.LogPath, "/"),
@@ -26,15 +46,15 @@ func NewLogger(cfg *config.Config) *zap.SugaredLogger {
 		zapcore.NewCore(
 			zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
 			writer_file,
-			zap.InfoLevel,
+			levels.File,
 		),
 		zapcore.NewCore(
 			zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()),
 			writer_console,
-			zap.DebugLevel,
+			levels.Console,
 		),
 	)
 	logger := zap.New(core, zap.AddCaller())
 	sugar := logger.Sugar()
-	return sugar
+	return sugar, levels
 }
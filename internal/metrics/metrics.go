@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/go-redis/redis/v9"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+const namespace = "gocdn"
+
+// Registry holds the metrics exposed on /metrics, along with the Go runtime and process ones
+var Registry = prometheus.NewRegistry()
+
+var (
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Requests handled, by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to handle a request, by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// Served and uploaded bytes
+	ResponseBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_response_bytes_total",
+		Help:      "Bytes of the response bodies, by route.",
+	}, []string{"route"})
+
+	RequestBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_request_bytes_total",
+		Help:      "Bytes of the request bodies, by route.",
+	}, []string{"route"})
+
+	// Results of the cache lookups of the downloads: hit, miss or fill
+	Cache = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by result, a fill is a file added to the cache after a miss.",
+	}, []string{"result"})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limited_total",
+		Help:      "Requests rejected by the rate limit, by route.",
+	}, []string{"route"})
+
+	RateLimitErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_errors_total",
+		Help:      "Requests the rate limiter failed to account for.",
+	})
+
+	ThrottledResponses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "throttled_responses_total",
+		Help:      "Downloads slowed down by the bandwidth shaping.",
+	})
+
+	ThrottledSeconds = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "throttled_seconds_total",
+		Help:      "Time the downloads waited on the bandwidth shaping.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		Requests, RequestDuration, ResponseBytes, RequestBytes, Cache,
+		RateLimited, RateLimitErrors, ThrottledResponses, ThrottledSeconds,
+	)
+}
+
+// RegisterPostgres exposes the connection pool of the database
+func RegisterPostgres(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, "postgres"))
+	observePools("cdn.postgres.pool", func() (int64, int64) {
+		s := db.Stats()
+		return int64(s.OpenConnections), int64(s.Idle)
+	})
+}
+
+// RegisterRedis exposes the connection pool of the cache
+func RegisterRedis(stats func() *redis.PoolStats) {
+	gauge := func(name string, help string, value func(s *redis.PoolStats) uint32) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "redis_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(value(stats())) })
+	}
+	counter := func(name string, help string, value func(s *redis.PoolStats) uint32) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "redis_pool",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(value(stats())) })
+	}
+
+	Registry.MustRegister(
+		gauge("connections", "Connections in the pool.", func(s *redis.PoolStats) uint32 { return s.TotalConns }),
+		gauge("idle_connections", "Idle connections in the pool.", func(s *redis.PoolStats) uint32 { return s.IdleConns }),
+		counter("hits_total", "Connections reused from the pool.", func(s *redis.PoolStats) uint32 { return s.Hits }),
+		counter("misses_total", "Connections created because none was free.", func(s *redis.PoolStats) uint32 { return s.Misses }),
+		counter("timeouts_total", "Waits for a connection that timed out.", func(s *redis.PoolStats) uint32 { return s.Timeouts }),
+		counter("stale_connections_total", "Connections removed from the pool.", func(s *redis.PoolStats) uint32 { return s.StaleConns }),
+	)
+	observePools("cdn.redis.pool", func() (int64, int64) {
+		s := stats()
+		return int64(s.TotalConns), int64(s.IdleConns)
+	})
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"context"
+	"go-cdn/internal/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// The same measures pushed over OTLP, they are no-ops until the telemetry pipeline is installed
+var (
+	otelRequests, _        = tracing.Meter.Int64Counter("http.server.requests", metric.WithDescription("Requests handled, by route, method and status."))
+	otelRequestDuration, _ = tracing.Meter.Float64Histogram("http.server.duration", metric.WithUnit("s"), metric.WithDescription("Time to handle a request, by route, method and status."))
+	otelResponseBytes, _   = tracing.Meter.Int64Counter("http.server.response.size", metric.WithUnit("By"), metric.WithDescription("Bytes of the response bodies, by route."))
+	otelRequestBytes, _    = tracing.Meter.Int64Counter("http.server.request.size", metric.WithUnit("By"), metric.WithDescription("Bytes of the request bodies, by route."))
+	otelCache, _           = tracing.Meter.Int64Counter("cdn.cache.requests", metric.WithDescription("Cache lookups by result."))
+	otelRateLimited, _     = tracing.Meter.Int64Counter("cdn.rate_limit.rejected", metric.WithDescription("Requests rejected by the rate limit, by route."))
+	otelRateLimitErrors, _ = tracing.Meter.Int64Counter("cdn.rate_limit.errors", metric.WithDescription("Requests the rate limiter failed to account for."))
+	otelThrottled, _       = tracing.Meter.Int64Counter("cdn.throttle.responses", metric.WithDescription("Downloads slowed down by the bandwidth shaping."))
+	otelThrottledTime, _   = tracing.Meter.Float64Counter("cdn.throttle.duration", metric.WithUnit("s"), metric.WithDescription("Time the downloads waited on the bandwidth shaping."))
+)
+
+// RecordRequest accounts for a handled request, the sizes are skipped when unknown
+func RecordRequest(ctx context.Context, route string, method string, status string, duration time.Duration, request_size int64, response_size int64) {
+	Requests.WithLabelValues(route, method, status).Inc()
+	RequestDuration.WithLabelValues(route, method, status).Observe(duration.Seconds())
+
+	attrs := metric.WithAttributes(attribute.String("http.route", route), attribute.String("http.method", method), attribute.String("http.status_code", status))
+	otelRequests.Add(ctx, 1, attrs)
+	otelRequestDuration.Record(ctx, duration.Seconds(), attrs)
+
+	route_attr := metric.WithAttributes(attribute.String("http.route", route))
+	if response_size > 0 {
+		ResponseBytes.WithLabelValues(route).Add(float64(response_size))
+		otelResponseBytes.Add(ctx, response_size, route_attr)
+	}
+	if request_size > 0 {
+		RequestBytes.WithLabelValues(route).Add(float64(request_size))
+		otelRequestBytes.Add(ctx, request_size, route_attr)
+	}
+}
+
+// RecordCache accounts for a cache lookup: hit, miss or fill
+func RecordCache(ctx context.Context, result string) {
+	Cache.WithLabelValues(result).Inc()
+	otelCache.Add(ctx, 1, metric.WithAttributes(attribute.String("result", result)))
+}
+
+func RecordRateLimited(ctx context.Context, route string) {
+	RateLimited.WithLabelValues(route).Inc()
+	otelRateLimited.Add(ctx, 1, metric.WithAttributes(attribute.String("http.route", route)))
+}
+
+func RecordRateLimitError(ctx context.Context) {
+	RateLimitErrors.Inc()
+	otelRateLimitErrors.Add(ctx, 1)
+}
+
+func RecordThrottled(ctx context.Context, waited time.Duration) {
+	ThrottledResponses.Inc()
+	ThrottledSeconds.Add(waited.Seconds())
+	otelThrottled.Add(ctx, 1)
+	otelThrottledTime.Add(ctx, waited.Seconds())
+}
+
+// Observes the connection pools on each collection
+func observePools(name string, stats func() (open int64, idle int64)) {
+	open, _ := tracing.Meter.Int64ObservableGauge(name+".connections", metric.WithDescription("Connections in the pool."))
+	idle, _ := tracing.Meter.Int64ObservableGauge(name+".idle_connections", metric.WithDescription("Idle connections in the pool."))
+	tracing.Meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		open_conns, idle_conns := stats()
+		o.ObserveInt64(open, open_conns)
+		o.ObserveInt64(idle, idle_conns)
+		return nil
+	}, open, idle)
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Rate is a token bucket refilled at PerSecond tokens per second, holding at most Burst of them
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// Valid reports whether the rate lets requests through at all, the limiters deny everything otherwise
+func (r Rate) Valid() bool {
+	return r.PerSecond > 0 && r.Burst > 0
+}
+
+// Result of a request against the budget of a client
+type Result struct {
+	Allowed    bool
+	Limit      int // the burst, most requests allowed at once
+	Remaining  int
+	RetryAfter time.Duration // until a request is allowed again, when denied
+	Reset      time.Duration // until the budget is full again
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, key string, rate Rate) (Result, error)
+}
+
+// Local keeps the budgets in memory, bounded to the most recently seen keys. An evicted client starts
+// again with a full budget
+type Local struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	buckets  map[string]*list.Element
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+func NewLocal(capacity int) *Local {
+	return &Local{
+		capacity: capacity,
+		order:    list.New(),
+		buckets:  map[string]*list.Element{},
+	}
+}
+
+func (l *Local) Allow(ctx context.Context, key string, rate Rate) (Result, error) {
+	if !rate.Valid() {
+		return Result{Limit: rate.Burst}, nil
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.buckets[key]
+	if ok {
+		l.order.MoveToFront(e)
+	} else {
+		e = l.order.PushFront(&bucket{key: key, tokens: float64(rate.Burst), last: now})
+		l.buckets[key] = e
+		if l.capacity > 0 && l.order.Len() > l.capacity {
+			oldest := l.order.Back()
+			l.order.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*bucket).key)
+		}
+	}
+
+	b := e.Value.(*bucket)
+	b.tokens = math.Min(float64(rate.Burst), b.tokens+now.Sub(b.last).Seconds()*rate.PerSecond)
+	b.last = now
+	return take(&b.tokens, rate), nil
+}
+
+// Takes a token if available and describes the budget left
+func take(tokens *float64, rate Rate) Result {
+	res := Result{Limit: rate.Burst}
+	if *tokens >= 1 {
+		*tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - *tokens) / rate.PerSecond)
+	}
+	res.Remaining = int(*tokens)
+	res.Reset = seconds((float64(rate.Burst) - *tokens) / rate.PerSecond)
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
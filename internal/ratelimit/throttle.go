@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Throttle shapes a flow of bytes to a rate, allowing bursts of up to burst bytes
+type Throttle struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	burst  int64
+	tokens float64
+	last   time.Time
+	waited int64 // nanoseconds, accessed atomically
+}
+
+func NewThrottle(rate int64, burst int64) *Throttle {
+	return &Throttle{
+		rate:   float64(rate),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (t *Throttle) Burst() int64 {
+	return t.burst
+}
+
+// Wait blocks until n bytes, at most the burst, may be sent and returns the time it waited. Bytes are
+// reserved right away, so concurrent callers are served in turn, and given back if ctx is done first
+func (t *Throttle) Wait(ctx context.Context, n int) (time.Duration, error) {
+	t.mu.Lock()
+	now := time.Now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > float64(t.burst) {
+		t.tokens = float64(t.burst)
+	}
+	t.last = now
+	t.tokens -= float64(n)
+	delay := seconds(-t.tokens / t.rate)
+	t.mu.Unlock()
+
+	if delay <= 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		atomic.AddInt64(&t.waited, int64(delay))
+		return delay, nil
+	case <-ctx.Done():
+		t.mu.Lock()
+		t.tokens += float64(n)
+		t.mu.Unlock()
+		return 0, ctx.Err()
+	}
+}
+
+// Waited is the total time spent waiting on the throttle
+func (t *Throttle) Waited() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.waited))
+}
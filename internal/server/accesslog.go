@@ -0,0 +1,175 @@
+package server
+
+import (
+	"fmt"
+	"go-cdn/internal/config"
+	"go-cdn/pkg/signedurl"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Fields of the JSON access log, all of them are logged unless the configuration picks some
+var accessLogFields = []string{
+	"method", "path", "route", "status", "bytes", "latency", "client_ip", "user_agent", "referer",
+	"cache", "subject", "request.id", "trace_id", "span_id",
+}
+
+type accessLog struct {
+	logger    *zap.Logger
+	combined  bool
+	rate      float64
+	fields    map[string]bool
+	skipPaths map[string]bool
+}
+
+func newAccessLog(cfg config.AccessLog, sugar *zap.SugaredLogger) *accessLog {
+	a := &accessLog{
+		logger:    sugar.Desugar().Named("access").WithOptions(zap.WithCaller(false)),
+		combined:  cfg.AccessLogFormat == "combined",
+		rate:      cfg.AccessLogSampleRate,
+		fields:    map[string]bool{},
+		skipPaths: map[string]bool{},
+	}
+	if cfg.AccessLogFormat != "" && cfg.AccessLogFormat != "json" && !a.combined {
+		sugar.Warnw("unknown access log format, using json", "format", cfg.AccessLogFormat)
+	}
+
+	fields := cfg.AccessLogFields
+	if len(fields) == 0 {
+		fields = accessLogFields
+	}
+	for _, f := range fields {
+		if !containsString(accessLogFields, f) {
+			sugar.Warnw("unknown access log field", "field", f)
+		}
+		a.fields[f] = true
+	}
+	for _, p := range cfg.AccessLogSkipPaths {
+		a.skipPaths[p] = true
+	}
+	return a
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Records how the cache answered the request, for the access log
+func setCacheStatus(c *gin.Context, status string) {
+	c.Set("cache.status", status)
+}
+
+// Logs each request through zap, so that it ends up in the rotated files along with the rest.
+// Failed requests are always logged, the others are sampled
+func (g *GinServer) accessLogMiddleware() gin.HandlerFunc {
+	a := newAccessLog(g.Config.AccessLog, g.Sugar)
+
+	return func(c *gin.Context) {
+		if a.skipPaths[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		// Read before the handlers replace the context with their own spans
+		span_ctx := trace.SpanContextFromContext(c.Request.Context())
+		c.Next()
+
+		status := c.Writer.Status()
+		if status < http.StatusBadRequest && a.rate < 1 && rand.Float64() >= a.rate {
+			return
+		}
+
+		if a.combined {
+			a.logger.Info(combinedLine(c, start, status))
+			return
+		}
+
+		fields := make([]zap.Field, 0, len(a.fields))
+		add := func(name string, field func(key string) zap.Field) {
+			if a.fields[name] {
+				fields = append(fields, field(name))
+			}
+		}
+		add("method", func(k string) zap.Field { return zap.String(k, c.Request.Method) })
+		add("path", func(k string) zap.Field { return zap.String(k, c.Request.URL.Path) })
+		add("route", func(k string) zap.Field { return zap.String(k, c.FullPath()) })
+		add("status", func(k string) zap.Field { return zap.Int(k, status) })
+		add("bytes", func(k string) zap.Field { return zap.Int(k, responseSize(c)) })
+		add("latency", func(k string) zap.Field { return zap.Duration(k, time.Since(start)) })
+		add("client_ip", func(k string) zap.Field { return zap.String(k, c.ClientIP()) })
+		add("user_agent", func(k string) zap.Field { return zap.String(k, c.Request.UserAgent()) })
+		add("referer", func(k string) zap.Field { return zap.String(k, c.Request.Referer()) })
+		add("cache", func(k string) zap.Field { return zap.String(k, c.GetString("cache.status")) })
+		add("subject", func(k string) zap.Field { return zap.String(k, subject(c)) })
+		add("request.id", func(k string) zap.Field { return zap.String(k, c.GetString("request.id")) })
+		if span_ctx.IsValid() {
+			add("trace_id", func(k string) zap.Field { return zap.String(k, span_ctx.TraceID().String()) })
+			add("span_id", func(k string) zap.Field { return zap.String(k, span_ctx.SpanID().String()) })
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.String("errors", c.Errors.String()))
+		}
+
+		a.logger.Info("request", fields...)
+	}
+}
+
+// Size of the body written, 0 instead of -1 when there was none
+func responseSize(c *gin.Context) int {
+	if size := c.Writer.Size(); size > 0 {
+		return size
+	}
+	return 0
+}
+
+// The request URI without the signature of signed URLs, which would grant access to whoever reads the logs
+func loggedURI(u *url.URL) string {
+	query := u.Query()
+	if !query.Has(signedurl.ParamSig) {
+		return u.RequestURI()
+	}
+	for _, param := range []string{signedurl.ParamSig, signedurl.ParamExpires, signedurl.ParamKeyID, signedurl.ParamIP} {
+		query.Del(param)
+	}
+	stripped := *u
+	stripped.RawQuery = query.Encode()
+	return stripped.RequestURI()
+}
+
+// Formats the request in the Combined Log Format of Apache and nginx
+func combinedLine(c *gin.Context, start time.Time, status int) string {
+	user := subject(c)
+	if user == "" {
+		user = "-"
+	}
+	referer := c.Request.Referer()
+	if referer == "" {
+		referer = "-"
+	}
+
+	return fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %d "%s" "%s"`,
+		c.ClientIP(),
+		user,
+		start.Format("02/Jan/2006:15:04:05 -0700"),
+		c.Request.Method,
+		loggedURI(c.Request.URL),
+		c.Request.Proto,
+		status,
+		responseSize(c),
+		strings.ReplaceAll(referer, `"`, `\"`),
+		strings.ReplaceAll(c.Request.UserAgent(), `"`, `\"`),
+	)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"go-cdn/internal/tracing"
+	"go-cdn/internal/warmup"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST handler to start a cache warm-up job. Missing fields fall back to the configured defaults
+func (g *GinServer) postWarmupHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, span := tracing.Tracer.Start(c.Request.Context(), "gin/postWarmupHandler")
+		defer span.End()
+
+		req := warmup.Request{
+			Strategy: g.Config.Warmup.WarmupStrategy,
+			Count:    g.Config.Warmup.WarmupCount,
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				String(c, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		// The job outlives the request
+		err := g.Warmer.Start(context.Background(), req)
+		switch {
+		case errors.Is(err, warmup.ErrWarmupRunning):
+			JSON(c, http.StatusConflict, g.Warmer.Progress())
+			return
+		case errors.Is(err, warmup.ErrUnknownStrategy), errors.Is(err, warmup.ErrInvalidCount):
+			String(c, http.StatusBadRequest, err.Error())
+			return
+		case err != nil:
+			g.requestLogger(c).Errorw("warmup start", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		JSON(c, http.StatusAccepted, g.Warmer.Progress())
+	}
+}
+
+// GET handler to report the progress of the last warm-up job
+func (g *GinServer) getWarmupHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		JSON(c, http.StatusOK, g.Warmer.Progress())
+	}
+}
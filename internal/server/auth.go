@@ -0,0 +1,116 @@
+package server
+
+import (
+	"errors"
+	"go-cdn/internal/auth"
+	"go-cdn/pkg/model"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Requires the request to carry credentials granting scope, valid for the bucket of the route if any.
+// Does nothing if authentication is disabled. Unless auth.protect_read is set reads are anonymous, the
+// credentials are only checked if sent, e.g. to read private files
+func (g *GinServer) authorize(scope auth.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		optional := scope == auth.ScopeRead && !g.Config.Auth.AuthProtectRead
+		if !g.Config.Auth.AuthEnable || (optional && !hasCredentials(c)) {
+			c.Next()
+			return
+		}
+
+		principal, err := g.authenticate(c)
+		if errors.Is(err, auth.ErrUnauthenticated) {
+			c.Header("WWW-Authenticate", g.authChallenge())
+			c.Abort()
+			JSON(c, http.StatusUnauthorized, gin.H{"error": "unauthenticated", "message": err.Error()})
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("authentication", "err", err)
+			c.Abort()
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		if !principal.Has(scope) {
+			c.Abort()
+			JSON(c, http.StatusForbidden, gin.H{"error": "forbidden", "message": "missing scope " + string(scope)})
+			return
+		}
+
+		// Credentials restricted to a bucket never grant access to the routes outside of it
+		if principal.Bucket != "" {
+			bucket, scoped := c.Get("bucket")
+			if scope == auth.ScopeAdmin || (scoped && bucket.(*model.Bucket).Name != principal.Bucket) {
+				c.Abort()
+				forbidBucket(c)
+				return
+			}
+		}
+
+		c.Set("auth.principal", principal)
+		c.Next()
+	}
+}
+
+// Resolves the credentials sent with the request, either an API key or a bearer token
+func (g *GinServer) authenticate(c *gin.Context) (*auth.Principal, error) {
+	if key := c.GetHeader("X-API-Key"); key != "" && g.APIKeys != nil {
+		return g.APIKeys.Authenticate(c.Request.Context(), key)
+	}
+
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "Bearer") && g.Bearer != nil {
+		return g.Bearer.Authenticate(c.Request.Context(), strings.TrimSpace(token))
+	}
+	return nil, auth.ErrUnauthenticated
+}
+
+func hasCredentials(c *gin.Context) bool {
+	return c.GetHeader("X-API-Key") != "" || c.GetHeader("Authorization") != ""
+}
+
+// Value of WWW-Authenticate listing the accepted schemes
+func (g *GinServer) authChallenge() string {
+	challenges := []string{}
+	if g.APIKeys != nil || g.Bearer == nil {
+		challenges = append(challenges, `ApiKey realm="go-cdn"`)
+	}
+	if g.Bearer != nil {
+		challenges = append(challenges, `Bearer realm="go-cdn"`)
+	}
+	return strings.Join(challenges, ", ")
+}
+
+// Returns the principal set by authorize, nil for anonymous requests
+func principal(c *gin.Context) *auth.Principal {
+	if p, ok := c.Get("auth.principal"); ok {
+		return p.(*auth.Principal)
+	}
+	return nil
+}
+
+// Subject of the authenticated caller, empty for anonymous requests
+func subject(c *gin.Context) string {
+	if p := principal(c); p != nil {
+		return p.Subject
+	}
+	return ""
+}
+
+// Logger carrying the request id, the trace and the authenticated subject
+func (g *GinServer) requestLogger(c *gin.Context) *zap.SugaredLogger {
+	logger := g.Sugar.With("request.id", c.GetString("request.id"))
+	if span_ctx := trace.SpanContextFromContext(c.Request.Context()); span_ctx.IsValid() {
+		logger = logger.With("trace_id", span_ctx.TraceID().String(), "span_id", span_ctx.SpanID().String())
+	}
+	if p := principal(c); p != nil {
+		logger = logger.With("auth.subject", p.Subject, "auth.method", p.Method)
+	}
+	return logger
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	"go-cdn/pkg/model"
+	"go-cdn/pkg/utils"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type batchUploadResult struct {
+	Filename string `json:"filename"`
+	Hash     string `json:"hash,omitempty"`
+	Status   int    `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+type batchDeleteRequest struct {
+	Hashes []string `json:"hashes" binding:"required"`
+}
+
+// POST handler to add many images at once, sent as multiple "file" parts. Valid files are stored in a
+// single transaction, the response reports the outcome of each one with 207 if any was not stored
+func (g *GinServer) postBatchHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/postBatchHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		bucket := currentBucket(c)
+		max_files := g.Config.Upload.UploadMaxBatchFiles
+		if max := g.maxBodySize(); max > 0 && max_files > 0 {
+			max = g.Config.Upload.UploadMaxSize*int64(max_files) + multipartOverhead
+			if c.Request.ContentLength > max {
+				JSON(c, http.StatusRequestEntityTooLarge, errTooLarge(g.Config.Upload.UploadMaxSize))
+				return
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+		}
+
+		form, err := c.MultipartForm()
+		if err != nil {
+			var max_err *http.MaxBytesError
+			if errors.As(err, &max_err) {
+				JSON(c, http.StatusRequestEntityTooLarge, errTooLarge(g.Config.Upload.UploadMaxSize))
+				return
+			}
+			g.requestLogger(c).Errorw("MultipartForm", "err", err)
+			String(c, http.StatusBadRequest, "")
+			return
+		}
+
+		parts := form.File["file"]
+		private := len(form.Value["private"]) > 0 && parseBool(form.Value["private"][0])
+		span.SetAttributes(attribute.Int("batch.files", len(parts)))
+		switch {
+		case len(parts) == 0:
+			JSON(c, http.StatusBadRequest, &policyError{Code: "no_files", Message: "no file parts were sent"})
+			return
+		case max_files > 0 && len(parts) > max_files:
+			JSON(c, http.StatusRequestEntityTooLarge, &policyError{Code: "too_many_files", Message: "too many files in a single batch"})
+			return
+		}
+
+		results := make([]batchUploadResult, len(parts))
+		files := []*model.StoredFile{}
+		stored := []int{} // Index in results of each entry of files
+		var size int64
+		for i, part := range parts {
+			filename, bytes, err := g.readUpload(bucket, part, "")
+			results[i].Filename = filename
+
+			var perr *policyError
+			switch {
+			case errors.As(err, &perr):
+				results[i].Status, results[i].Error, results[i].Message = perr.Status, perr.Code, perr.Message
+				continue
+			case err != nil:
+				results[i].Status, results[i].Error = http.StatusBadRequest, "unreadable_file"
+				continue
+			}
+
+			files = append(files, &model.StoredFile{Bucket: bucket.Name, IDHash: utils.RandStringBytes(6), Filename: filename, Content: bytes, UploadedBy: subject(c), Private: private})
+			stored = append(stored, i)
+			size += int64(len(bytes))
+		}
+
+		// The batch is stored as a whole, so it must fit in the quota as a whole
+		if len(files) > 0 {
+			warnings, perr, err := g.checkQuota(c, bucket, size, int64(len(files)))
+			if err != nil {
+				g.requestLogger(c).Errorw("db get bucket usage", "err", err)
+				String(c, http.StatusInternalServerError, "error")
+				return
+			}
+			if perr != nil {
+				for _, i := range stored {
+					results[i].Status, results[i].Error, results[i].Message = perr.Status, perr.Code, perr.Message
+				}
+				files, stored = nil, nil
+			}
+			g.warnQuota(c, warnings)
+		}
+
+		status := http.StatusOK
+		if len(files) > 0 {
+			err := g.addFiles(c.Request.Context(), files)
+			perr := storedQuotaError(err)
+			if err != nil && perr == nil {
+				g.requestLogger(c).Errorw("db add files", "err", err)
+				perr = &policyError{Status: http.StatusInternalServerError, Code: "storage_error"}
+			}
+			if perr != nil {
+				for _, i := range stored {
+					results[i].Status, results[i].Error, results[i].Message = perr.Status, perr.Code, perr.Message
+				}
+				stored = nil
+			}
+		}
+		for j, i := range stored {
+			results[i].Hash, results[i].Status = files[j].IDHash, http.StatusCreated
+		}
+		if len(stored) != len(parts) {
+			status = http.StatusMultiStatus
+		}
+
+		g.requestLogger(c).Infow("batch upload", "files", len(parts), "stored", len(stored))
+		JSON(c, status, gin.H{
+			"results": results,
+		})
+	}
+}
+
+// Stores the files in a single transaction. A taken hash aborts it, then new hashes are drawn for all the
+// files and it's tried again
+func (g *GinServer) addFiles(ctx context.Context, files []*model.StoredFile) error {
+	for attempt := 1; ; attempt++ {
+		err := g.DB.AddFiles(ctx, files)
+		if !errors.Is(err, repository.ErrKeyExists) || attempt == hashAttempts {
+			return err
+		}
+		for _, f := range files {
+			f.IDHash = utils.RandStringBytes(6)
+		}
+	}
+}
+
+// POST handler to remove many images at once. Cache entries are purged for every requested hash
+func (g *GinServer) postBatchDeleteHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/postBatchDeleteHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		// Setup error propagation
+		err_ch := c.MustGet("err_ch").(chan error)
+		wg := c.MustGet("wg").(*sync.WaitGroup)
+		bucket := currentBucket(c).Name
+
+		var req batchDeleteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			String(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if max := g.Config.Upload.UploadMaxBatchFiles; max > 0 && len(req.Hashes) > max {
+			JSON(c, http.StatusRequestEntityTooLarge, &policyError{Code: "too_many_files", Message: "too many files in a single batch"})
+			return
+		}
+		span.SetAttributes(attribute.Int("batch.files", len(req.Hashes)))
+
+		if g.Config.Cache.RedisEnable {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := g.Cache.RemoveFiles(c.Request.Context(), bucket, req.Hashes)
+				err_ch <- err
+			}()
+		}
+
+		removed, err := g.DB.RemoveFiles(c.Request.Context(), bucket, req.Hashes)
+		if err != nil {
+			g.requestLogger(c).Errorw("db remove files", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		found := map[string]bool{}
+		for _, id_hash := range removed {
+			found[id_hash] = true
+		}
+		not_found := []string{}
+		for _, id_hash := range req.Hashes {
+			if !found[id_hash] {
+				not_found = append(not_found, id_hash)
+			}
+		}
+
+		JSON(c, http.StatusOK, gin.H{
+			"removed":   removed,
+			"not_found": not_found,
+		})
+	}
+}
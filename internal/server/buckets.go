@@ -0,0 +1,306 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	"go-cdn/pkg/model"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Settings are read on every request, a change made on another instance is visible within this time
+const bucketCacheTTL = 10 * time.Second
+
+var bucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+
+// Names taken by the routes of the default bucket, e.g. /content/list, or by the other Redis namespaces
+var reservedBucketNames = map[string]bool{
+	"list":      true,
+	"batch":     true,
+	"fetch":     true,
+	"trash":     true,
+	"versions":  true,
+	"egress":    true,
+	"ratelimit": true,
+}
+
+type bucketRequest struct {
+	Name         string   `json:"name"`
+	Private      bool     `json:"private"`
+	QuotaBytes   int64    `json:"quota_bytes"`
+	AllowedTypes []string `json:"allowed_types"`
+	NoCache      bool     `json:"no_cache"`
+	CacheControl string   `json:"cache_control"`
+}
+
+type bucketCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedBucket
+}
+
+type cachedBucket struct {
+	bucket  *model.Bucket
+	expires time.Time
+}
+
+func validBucketName(name string) bool {
+	return bucketNameRegexp.MatchString(name) && !reservedBucketNames[name]
+}
+
+// Returns the settings of a bucket, ErrKeyDoesNotExist if it's unknown. Without bucket management only the
+// default bucket exists, with no particular setting
+func (g *GinServer) bucket(ctx context.Context, name string) (*model.Bucket, error) {
+	if g.Buckets == nil {
+		if name == model.DefaultBucket {
+			return &model.Bucket{Name: model.DefaultBucket}, nil
+		}
+		return nil, repository.ErrKeyDoesNotExist
+	}
+
+	g.buckets.mu.Lock()
+	cached, ok := g.buckets.entries[name]
+	g.buckets.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.bucket, nil
+	}
+
+	bucket, err := g.Buckets.GetBucket(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	g.buckets.mu.Lock()
+	g.buckets.entries[name] = cachedBucket{bucket: bucket, expires: time.Now().Add(bucketCacheTTL)}
+	g.buckets.mu.Unlock()
+	return bucket, nil
+}
+
+// Drops the cached settings of a bucket after a change on this instance
+func (g *GinServer) forgetBucket(name string) {
+	g.buckets.mu.Lock()
+	delete(g.buckets.entries, name)
+	g.buckets.mu.Unlock()
+}
+
+// Resolves the bucket of a content route, from the :bucket segment if scoped or the default one otherwise,
+// and stores its settings on the context
+func (g *GinServer) bucketScope(scoped bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := model.DefaultBucket
+		if scoped {
+			name = c.Param("bucket")
+		}
+
+		bucket, err := g.bucket(c.Request.Context(), name)
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			c.Abort()
+			JSON(c, http.StatusNotFound, gin.H{"error": "unknown_bucket", "message": fmt.Sprintf("bucket %q does not exist", name)})
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db get bucket", "bucket", name, "err", err)
+			c.Abort()
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("bucket", name))
+		c.Set("bucket", bucket)
+		c.Next()
+	}
+}
+
+// Returns the bucket set by bucketScope
+func currentBucket(c *gin.Context) *model.Bucket {
+	return c.MustGet("bucket").(*model.Bucket)
+}
+
+// Hash of the file a route refers to. The routes of the default bucket carry it in the :bucket segment,
+// since gin requires a single wildcard name per segment
+func fileHash(c *gin.Context) string {
+	if hash := c.Param("hash"); hash != "" {
+		return hash
+	}
+	return c.Param("bucket")
+}
+
+// Whether the authenticated caller may access the files of bucket. Keys restricted to a bucket are
+// rejected everywhere else
+func bucketAllowed(c *gin.Context, bucket string) bool {
+	p := principal(c)
+	return p == nil || p.Bucket == "" || p.Bucket == bucket
+}
+
+func forbidBucket(c *gin.Context) {
+	JSON(c, http.StatusForbidden, gin.H{"error": "forbidden", "message": "the credentials are not valid for this bucket"})
+}
+
+// GET handler to list the buckets
+func (g *GinServer) getBucketsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/getBucketsHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		buckets, err := g.Buckets.GetBuckets(c.Request.Context())
+		if err != nil {
+			g.requestLogger(c).Errorw("db get buckets", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		JSON(c, http.StatusOK, gin.H{
+			"list": buckets,
+		})
+	}
+}
+
+// GET handler returning the settings and the usage of a bucket
+func (g *GinServer) getBucketHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/getBucketHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		bucket, err := g.Buckets.GetBucket(c.Request.Context(), c.Param("name"))
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			String(c, http.StatusNotFound, "")
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db get bucket", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		usage, err := g.Buckets.GetBucketUsage(c.Request.Context(), bucket.Name)
+		if err != nil {
+			g.requestLogger(c).Errorw("db get bucket usage", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		JSON(c, http.StatusOK, gin.H{
+			"bucket":     bucket,
+			"used_bytes": usage,
+		})
+	}
+}
+
+// POST handler to create a bucket
+func (g *GinServer) postBucketHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/postBucketHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		var req bucketRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			String(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !validBucketName(req.Name) {
+			String(c, http.StatusBadRequest, "invalid bucket name")
+			return
+		}
+
+		bucket := req.bucket(req.Name)
+		err := g.Buckets.AddBucket(c.Request.Context(), bucket)
+		if errors.Is(err, repository.ErrKeyExists) {
+			String(c, http.StatusConflict, "bucket already exists")
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db add bucket", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		g.requestLogger(c).Infow("created bucket", "bucket", bucket.Name)
+		JSON(c, http.StatusCreated, bucket)
+	}
+}
+
+// PUT handler to replace the settings of a bucket
+func (g *GinServer) putBucketHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/putBucketHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		var req bucketRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			String(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		bucket := req.bucket(c.Param("name"))
+		err := g.Buckets.UpdateBucket(c.Request.Context(), bucket)
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			String(c, http.StatusNotFound, "")
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db update bucket", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+		g.forgetBucket(bucket.Name)
+
+		g.requestLogger(c).Infow("updated bucket", "bucket", bucket.Name)
+		JSON(c, http.StatusOK, bucket)
+	}
+}
+
+// DELETE handler to remove an empty bucket
+func (g *GinServer) deleteBucketHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/deleteBucketHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		name := c.Param("name")
+		if name == model.DefaultBucket {
+			String(c, http.StatusBadRequest, "the default bucket can't be removed")
+			return
+		}
+
+		err := g.Buckets.RemoveBucket(c.Request.Context(), name)
+		switch {
+		case errors.Is(err, repository.ErrKeyDoesNotExist):
+			String(c, http.StatusNotFound, "")
+			return
+		case errors.Is(err, repository.ErrBucketNotEmpty):
+			String(c, http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			g.requestLogger(c).Errorw("db remove bucket", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+		g.forgetBucket(name)
+
+		g.requestLogger(c).Infow("removed bucket", "bucket", name)
+		String(c, http.StatusOK, "OK")
+	}
+}
+
+func (r *bucketRequest) bucket(name string) *model.Bucket {
+	return &model.Bucket{
+		Name:         name,
+		Private:      r.Private,
+		QuotaBytes:   r.QuotaBytes,
+		AllowedTypes: r.AllowedTypes,
+		NoCache:      r.NoCache,
+		CacheControl: r.CacheControl,
+	}
+}
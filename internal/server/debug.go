@@ -0,0 +1,132 @@
+package server
+
+import (
+	"go-cdn/internal/auth"
+	"go-cdn/internal/tracing"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap/zapcore"
+)
+
+var startedAt = time.Now()
+
+type logLevelRequest struct {
+	Level   string `json:"level"` // Sets both outputs
+	File    string `json:"file"`
+	Console string `json:"console"`
+}
+
+func (g *GinServer) logLevels() gin.H {
+	return gin.H{"file": g.LogLevels.File.String(), "console": g.LogLevels.Console.String()}
+}
+
+// GET handler returning the current levels of the logger
+func (g *GinServer) getLogLevelHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		JSON(c, http.StatusOK, g.logLevels())
+	}
+}
+
+// PUT handler changing the levels of the logger until the next restart
+func (g *GinServer) putLogLevelHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/putLogLevelHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		var req logLevelRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			String(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.Level != "" {
+			req.File, req.Console = req.Level, req.Level
+		}
+
+		// Both are validated before any is applied
+		levels := map[string]zapcore.Level{}
+		for name, text := range map[string]string{"file": req.File, "console": req.Console} {
+			if text == "" {
+				continue
+			}
+			level, err := zapcore.ParseLevel(text)
+			if err != nil {
+				JSON(c, http.StatusBadRequest, gin.H{"error": "invalid_level", "message": err.Error()})
+				return
+			}
+			levels[name] = level
+		}
+		if len(levels) == 0 {
+			String(c, http.StatusBadRequest, "no level given")
+			return
+		}
+
+		if level, ok := levels["file"]; ok {
+			g.LogLevels.File.SetLevel(level)
+		}
+		if level, ok := levels["console"]; ok {
+			g.LogLevels.Console.SetLevel(level)
+		}
+		g.requestLogger(c).Warnw("log levels changed", "file", g.LogLevels.File.String(), "console", g.LogLevels.Console.String())
+		JSON(c, http.StatusOK, g.logLevels())
+	}
+}
+
+// GET handler reporting the state of the Go runtime
+func runtimeHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+
+		JSON(c, http.StatusOK, gin.H{
+			"go_version":     runtime.Version(),
+			"uptime":         time.Since(startedAt).Round(time.Second).String(),
+			"goroutines":     runtime.NumGoroutine(),
+			"cpus":           runtime.NumCPU(),
+			"gomaxprocs":     runtime.GOMAXPROCS(0),
+			"heap_alloc":     mem.HeapAlloc,
+			"heap_inuse":     mem.HeapInuse,
+			"heap_objects":   mem.HeapObjects,
+			"sys":            mem.Sys,
+			"num_gc":         mem.NumGC,
+			"gc_pause_total": time.Duration(mem.PauseTotalNs).String(),
+			"last_gc":        time.Unix(0, int64(mem.LastGC)).UTC(),
+		})
+	}
+}
+
+// DebugRouter serves pprof and the runtime stats. It's meant for a listener bound to a private address,
+// admin credentials are still required when authentication is enabled
+func (g *GinServer) DebugRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	debug := r.Group("/debug", g.authorize(auth.ScopeAdmin))
+	debug.GET("/runtime", runtimeHandler())
+
+	debug.GET("/pprof/", gin.WrapF(pprof.Index))
+	debug.GET("/pprof/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/pprof/profile", gin.WrapF(pprof.Profile))
+	debug.GET("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	debug.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/pprof/trace", gin.WrapF(pprof.Trace))
+	// Named profiles, e.g. heap, goroutine or mutex
+	debug.GET("/pprof/:name", func(c *gin.Context) {
+		pprof.Handler(c.Param("name")).ServeHTTP(c.Writer, c.Request)
+	})
+
+	g.logLevelRoutes(debug)
+	return r
+}
+
+// The log levels are only served on the private listeners, never on the public port
+func (g *GinServer) logLevelRoutes(rg *gin.RouterGroup) {
+	if g.LogLevels != nil {
+		rg.GET("/log/level", g.getLogLevelHandler())
+		rg.PUT("/log/level", g.putLogLevelHandler())
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"go-cdn/internal/tracing"
+	"go-cdn/pkg/model"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Counts the bytes written by the handler once it's done, only for files actually served
+func (g *GinServer) egressMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		status, size := c.Writer.Status(), c.Writer.Size()
+		if status != http.StatusOK && status != http.StatusPartialContent || size <= 0 {
+			return
+		}
+		g.Egress.Record(currentBucket(c).Name, fileHash(c), int64(size))
+	}
+}
+
+// GET handler reporting the bytes served, grouped by bucket, file or period. The range is given by ?from=
+// and ?to= as RFC 3339 times, ?bucket= and ?hash= narrow it down
+func (g *GinServer) getEgressHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/getEgressHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		filter := model.EgressFilter{
+			Bucket:  c.Query("bucket"),
+			Hash:    c.Query("hash"),
+			GroupBy: c.DefaultQuery("group_by", "bucket"),
+		}
+		if filter.GroupBy != "bucket" && filter.GroupBy != "file" && filter.GroupBy != "period" {
+			String(c, http.StatusBadRequest, "group_by must be bucket, file or period")
+			return
+		}
+		for param, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+			value := c.Query(param)
+			if value == "" {
+				continue
+			}
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				String(c, http.StatusBadRequest, param+" must be an RFC 3339 time")
+				return
+			}
+			*t = parsed
+		}
+
+		reports, err := g.Traffic.GetEgress(c.Request.Context(), filter)
+		if err != nil {
+			g.requestLogger(c).Errorw("db get egress", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		var total model.EgressCount
+		for _, r := range reports {
+			total.Bytes += r.Bytes
+			total.Requests += r.Requests
+		}
+
+		JSON(c, http.StatusOK, gin.H{
+			"list":  reports,
+			"total": total,
+		})
+	}
+}
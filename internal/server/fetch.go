@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-cdn/internal/fetch"
+	"go-cdn/internal/tracing"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fetchRequest struct {
+	URL      string `json:"url" binding:"required"`
+	Filename string `json:"filename"`
+	Private  bool   `json:"private"`
+}
+
+// POST handler to store a file downloaded from a remote url. The file goes through the same validation
+// and storage as the ones uploaded via POST /content/
+func (g *GinServer) postFetchHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/postFetchHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		bucket := currentBucket(c)
+
+		var req fetchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			String(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		res, err := g.Fetcher.Fetch(c.Request.Context(), req.URL)
+		if err != nil {
+			g.requestLogger(c).Infow("fetch failed", "url", req.URL, "err", err)
+			perr := fetchError(err)
+			JSON(c, perr.Status, perr)
+			return
+		}
+
+		// The declared type is checked too, then the sniffed one by validateUpload
+		if res.ContentType != "" && !g.allowedType(bucket, res.ContentType) {
+			JSON(c, http.StatusUnsupportedMediaType, &policyError{
+				Code:    "type_not_allowed",
+				Message: fmt.Sprintf("files of type %q are not accepted", res.ContentType),
+			})
+			return
+		}
+
+		filename := req.Filename
+		if filename == "" {
+			filename = res.Filename
+		}
+		filename = sanitizeFilename(filename)
+
+		if _, perr := g.validateUpload(bucket, filename, res.Content); perr != nil {
+			JSON(c, perr.Status, perr)
+			return
+		}
+		if !g.enforceQuota(c, bucket, int64(len(res.Content)), 1) {
+			return
+		}
+
+		hash, err := g.addFile(c, filename, res.Content, req.Private)
+		if perr := storedQuotaError(err); perr != nil {
+			JSON(c, perr.Status, perr)
+			return
+		}
+		if err != nil {
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		JSON(c, http.StatusOK, gin.H{
+			"hash": hash,
+		})
+	}
+}
+
+// Maps the errors of the fetcher to the response returned to the client
+func fetchError(err error) *policyError {
+	var url_err *url.Error
+	switch {
+	case errors.Is(err, fetch.ErrUnsupportedScheme):
+		return &policyError{Status: http.StatusBadRequest, Code: "unsupported_scheme", Message: err.Error()}
+	case errors.Is(err, fetch.ErrForbiddenAddress):
+		return &policyError{Status: http.StatusForbidden, Code: "forbidden_address", Message: "the url resolves to an address that is not allowed"}
+	case errors.Is(err, fetch.ErrTooManyRedirects):
+		return &policyError{Status: http.StatusBadGateway, Code: "too_many_redirects", Message: err.Error()}
+	case errors.Is(err, fetch.ErrTooLarge):
+		return &policyError{Status: http.StatusRequestEntityTooLarge, Code: "file_too_large", Message: err.Error()}
+	case errors.Is(err, fetch.ErrBadStatus):
+		return &policyError{Status: http.StatusBadGateway, Code: "bad_status", Message: err.Error()}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &url_err) && url_err.Timeout():
+		return &policyError{Status: http.StatusGatewayTimeout, Code: "timeout", Message: "the remote server did not answer in time"}
+	case url_err != nil:
+		return &policyError{Status: http.StatusBadGateway, Code: "fetch_failed", Message: "the remote file could not be retrieved"}
+	}
+	return &policyError{Status: http.StatusBadRequest, Code: "invalid_url", Message: err.Error()}
+}
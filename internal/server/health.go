@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultHealthTimeout = 2 * time.Second
+
+type componentStatus struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// Drain marks the instance as not ready, so that it's taken out of rotation before shutting down
+func (g *GinServer) Drain() {
+	atomic.StoreInt32(&g.draining, 1)
+}
+
+// The process is up and serving, dependencies are not checked so that an outage of theirs doesn't
+// get every instance restarted
+func (g *GinServer) livezHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		JSON(c, http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// Checks each dependency concurrently, the instance is ready only when all of them respond in time
+func (g *GinServer) readyzHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if atomic.LoadInt32(&g.draining) == 1 {
+			JSON(c, http.StatusServiceUnavailable, gin.H{"status": "shutting_down"})
+			return
+		}
+
+		checks := map[string]func(ctx context.Context) error{}
+		if g.DB != nil {
+			checks["postgres"] = g.DB.Ping
+		}
+		if g.Config.Cache.RedisEnable && g.Cache != nil {
+			checks["redis"] = g.Cache.Ping
+		}
+
+		timeout := g.Config.Health.HealthTimeout
+		if timeout <= 0 {
+			timeout = defaultHealthTimeout
+		}
+
+		mu := sync.Mutex{}
+		wg := sync.WaitGroup{}
+		components := map[string]componentStatus{}
+		for name, check := range checks {
+			wg.Add(1)
+			go func(name string, check func(ctx context.Context) error) {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+				defer cancel()
+
+				start := time.Now()
+				err := check(ctx)
+				status := componentStatus{Status: "ok", DurationMs: time.Since(start).Milliseconds()}
+				if err != nil {
+					status.Status = "unavailable"
+					status.Error = err.Error()
+				}
+
+				mu.Lock()
+				components[name] = status
+				mu.Unlock()
+			}(name, check)
+		}
+		wg.Wait()
+
+		code, overall := http.StatusOK, "ok"
+		for name, status := range components {
+			if status.Status != "ok" {
+				code, overall = http.StatusServiceUnavailable, "unavailable"
+				g.requestLogger(c).Warnw("readiness check", "component", name, "err", status.Error)
+			}
+		}
+		JSON(c, code, gin.H{"status": overall, "components": components})
+	}
+}
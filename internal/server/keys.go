@@ -0,0 +1,172 @@
+package server
+
+import (
+	"errors"
+	"go-cdn/internal/auth"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	"go-cdn/pkg/model"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type keyRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes" binding:"required"`
+	ExpiresIn string   `json:"expires_in"` // e.g. 720h, never expires if empty
+	Bucket    string   `json:"bucket"`     // Restricts the key to a bucket
+}
+
+// Returned only when a key is created, the secret can't be retrieved afterwards
+type keyResponse struct {
+	model.APIKey
+	Key string `json:"key"`
+}
+
+// GET handler to list the API keys, without secrets
+func (g *GinServer) getKeysHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/getKeysHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		keys, err := g.Keys.GetKeys(c.Request.Context())
+		if err != nil {
+			g.requestLogger(c).Errorw("db get keys", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		JSON(c, http.StatusOK, gin.H{
+			"list": keys,
+		})
+	}
+}
+
+// POST handler to create a new API key
+func (g *GinServer) postKeyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/postKeyHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		var req keyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			String(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if _, err := auth.ParseScopes(req.Scopes); err != nil || len(req.Scopes) == 0 {
+			String(c, http.StatusBadRequest, "invalid scopes")
+			return
+		}
+
+		if req.Bucket != "" {
+			_, err := g.bucket(c.Request.Context(), req.Bucket)
+			if errors.Is(err, repository.ErrKeyDoesNotExist) {
+				String(c, http.StatusBadRequest, "unknown bucket")
+				return
+			}
+			if err != nil {
+				g.requestLogger(c).Errorw("db get bucket", "err", err)
+				String(c, http.StatusInternalServerError, "error")
+				return
+			}
+		}
+
+		key := &model.APIKey{Name: req.Name, Scopes: req.Scopes, Bucket: req.Bucket}
+		if req.ExpiresIn != "" {
+			d, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil || d <= 0 {
+				String(c, http.StatusBadRequest, "invalid expires_in")
+				return
+			}
+			expires := time.Now().Add(d)
+			key.ExpiresAt = &expires
+		}
+
+		g.issueKey(c, key)
+	}
+}
+
+// POST handler to replace a key with a new one with the same name and scopes. The old key keeps working
+// for the configured grace period, so that clients can be updated. Expired keys can't be rotated, as the
+// new key would expire along with them
+func (g *GinServer) postRotateKeyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/postRotateKeyHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		old, err := g.Keys.GetKey(c.Request.Context(), c.Param("id"))
+		if errors.Is(err, repository.ErrKeyDoesNotExist) || (err == nil && old.RevokedAt != nil) {
+			String(c, http.StatusNotFound, "")
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db get key", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+		if old.ExpiresAt != nil && !old.ExpiresAt.After(time.Now()) {
+			String(c, http.StatusGone, "the key has expired")
+			return
+		}
+
+		err = g.Keys.ExpireKey(c.Request.Context(), old.KeyID, time.Now().Add(g.Config.Auth.AuthRotationGrace))
+		if err != nil {
+			g.requestLogger(c).Errorw("db expire key", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+		g.APIKeys.Forget(old.KeyID)
+
+		g.issueKey(c, &model.APIKey{Name: old.Name, Scopes: old.Scopes, Bucket: old.Bucket, ExpiresAt: old.ExpiresAt})
+	}
+}
+
+// DELETE handler to revoke a key
+func (g *GinServer) deleteKeyHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/deleteKeyHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		key_id := c.Param("id")
+		err := g.Keys.RevokeKey(c.Request.Context(), key_id)
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			String(c, http.StatusNotFound, "")
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db revoke key", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+		g.APIKeys.Forget(key_id)
+
+		g.requestLogger(c).Infow("revoked api key", "key_id", key_id)
+		String(c, http.StatusOK, "OK")
+	}
+}
+
+// Generates the secret for key, stores it and returns it to the client
+func (g *GinServer) issueKey(c *gin.Context, key *model.APIKey) {
+	key_id, secret, hash, err := auth.GenerateKey()
+	if err != nil {
+		g.requestLogger(c).Errorw("generate key", "err", err)
+		String(c, http.StatusInternalServerError, "error")
+		return
+	}
+	key.KeyID, key.Hash = key_id, hash
+
+	if err := g.Keys.AddKey(c.Request.Context(), key); err != nil {
+		g.requestLogger(c).Errorw("db add key", "err", err)
+		String(c, http.StatusInternalServerError, "error")
+		return
+	}
+
+	g.requestLogger(c).Infow("issued api key", "key_id", key.KeyID, "name", key.Name, "scopes", key.Scopes, "bucket", key.Bucket)
+	JSON(c, http.StatusCreated, keyResponse{APIKey: *key, Key: secret})
+}
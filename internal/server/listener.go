@@ -0,0 +1,40 @@
+package server
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Restricts the admin listener to the configured networks, any network when none is set. The peer address
+// is used rather than X-Forwarded-For, which the client controls. Invalid entries are skipped, and deny
+// everything if none is left
+func (g *GinServer) allowNetworks() gin.HandlerFunc {
+	networks := []*net.IPNet{}
+	for _, cidr := range g.Config.Admin.AdminAllowedNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			g.Sugar.Errorw("invalid admin allowed network", "cidr", cidr, "err", err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+
+	return func(c *gin.Context) {
+		if len(g.Config.Admin.AdminAllowedNetworks) == 0 {
+			c.Next()
+			return
+		}
+		if ip := net.ParseIP(c.RemoteIP()); ip != nil {
+			for _, network := range networks {
+				if network.Contains(ip) {
+					c.Next()
+					return
+				}
+			}
+		}
+		c.Abort()
+		JSON(c, http.StatusForbidden, gin.H{"error": "forbidden", "message": "network not allowed"})
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"go-cdn/internal/metrics"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Records the count, the latency and the sizes of the requests by route. Requests matching no route share
+// a single label, so that scanners can't grow the series
+func (g *GinServer) metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		metrics.RecordRequest(c.Request.Context(), route, metricMethod(c.Request.Method), status, time.Since(start),
+			c.Request.ContentLength, int64(c.Writer.Size()))
+	}
+}
+
+// The method as label, the non-standard ones being counted together since clients can send anything
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+func metricsHandler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+}
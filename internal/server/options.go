@@ -1,6 +1,17 @@
 package server
 
-import "github.com/gin-gonic/gin"
+import (
+	"go-cdn/internal/auth"
+	"go-cdn/internal/database/controller"
+	"go-cdn/internal/fetch"
+	"go-cdn/internal/logger"
+	"go-cdn/internal/ratelimit"
+	"go-cdn/internal/stats"
+	"go-cdn/internal/warmup"
+	"go-cdn/pkg/signedurl"
+
+	"github.com/gin-gonic/gin"
+)
 
 type OptFunc func()
 
@@ -9,3 +20,107 @@ func WithMode(mode string) OptFunc {
 		gin.SetMode(mode)
 	}
 }
+
+// ServerOpt attaches optional components to the GinServer on creation
+type ServerOpt func(*GinServer)
+
+func WithHitCounter(hits *stats.HitCounter) ServerOpt {
+	return func(g *GinServer) {
+		g.Hits = hits
+	}
+}
+
+func WithWarmer(warmer *warmup.Warmer) ServerOpt {
+	return func(g *GinServer) {
+		g.Warmer = warmer
+	}
+}
+
+func WithUploads(uploads *database.UploadController) ServerOpt {
+	return func(g *GinServer) {
+		g.Uploads = uploads
+	}
+}
+
+func WithVersions(versions *database.VersionController) ServerOpt {
+	return func(g *GinServer) {
+		g.Versions = versions
+	}
+}
+
+func WithTrash(trash *database.TrashController) ServerOpt {
+	return func(g *GinServer) {
+		g.Trash = trash
+	}
+}
+
+func WithFetcher(fetcher *fetch.Fetcher) ServerOpt {
+	return func(g *GinServer) {
+		g.Fetcher = fetcher
+	}
+}
+
+// WithAccess enables changing the access settings of files, such as the private flag
+func WithAccess(access *database.AccessController) ServerOpt {
+	return func(g *GinServer) {
+		g.Access = access
+	}
+}
+
+// WithSigner enables signed URLs, needed to download private files without credentials
+func WithSigner(signer *signedurl.Signer) ServerOpt {
+	return func(g *GinServer) {
+		g.Signer = signer
+	}
+}
+
+// WithBearerAuth accepts bearer tokens in the Authorization header, validated through authenticator
+func WithBearerAuth(authenticator auth.Authenticator) ServerOpt {
+	return func(g *GinServer) {
+		g.Bearer = authenticator
+	}
+}
+
+// WithBuckets enables the management of buckets other than the default one, and their settings
+func WithBuckets(buckets *database.BucketController) ServerOpt {
+	return func(g *GinServer) {
+		g.Buckets = buckets
+	}
+}
+
+// WithEgress counts the bytes served by each file, reported from the rollup
+func WithEgress(egress *stats.EgressCounter, traffic *database.EgressController) ServerOpt {
+	return func(g *GinServer) {
+		g.Egress = egress
+		g.Traffic = traffic
+	}
+}
+
+// WithRateLimiter replaces the in-memory budgets, e.g. to share them between the instances
+func WithRateLimiter(limiter ratelimit.Limiter) ServerOpt {
+	return func(g *GinServer) {
+		g.Limiter = limiter
+	}
+}
+
+// WithUsage enables the quotas and the usage reports
+func WithUsage(usage *database.UsageController) ServerOpt {
+	return func(g *GinServer) {
+		g.Usage = usage
+	}
+}
+
+// WithAPIKeys enables the API key management routes, keys are validated through authenticator
+func WithAPIKeys(keys *database.KeyController, authenticator *auth.APIKeyAuthenticator) ServerOpt {
+	return func(g *GinServer) {
+		g.Keys = keys
+		g.APIKeys = authenticator
+	}
+}
+
+// WithLogLevels allows changing the levels of the logger at runtime
+func WithLogLevels(levels *logger.Levels) ServerOpt {
+	return func(g *GinServer) {
+		g.LogLevels = levels
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"fmt"
+	"go-cdn/pkg/model"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Allowance for the multipart boundaries and form fields on top of the file itself
+const multipartOverhead = 64 << 10
+
+const maxFilenameLength = 255
+
+// Bytes considered by http.DetectContentType
+const sniffLength = 512
+
+// policyError is returned to the client as JSON when an upload is rejected
+type policyError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"error"`
+	Message string `json:"message"`
+}
+
+func (e *policyError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func errEmptyFile() *policyError {
+	return &policyError{
+		Status:  http.StatusBadRequest,
+		Code:    "empty_file",
+		Message: "empty files are not accepted",
+	}
+}
+
+func errTooLarge(max int64) *policyError {
+	return &policyError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    "file_too_large",
+		Message: fmt.Sprintf("the maximum allowed size is %d bytes", max),
+	}
+}
+
+// Maximum size accepted for the body of a multipart request, 0 if unlimited
+func (g *GinServer) maxBodySize() int64 {
+	if g.Config.Upload.UploadMaxSize <= 0 {
+		return 0
+	}
+	return g.Config.Upload.UploadMaxSize + multipartOverhead
+}
+
+// Checks the metadata known before the content is received: declared size and filename
+func (g *GinServer) validateUploadHeader(filename string, size int64) *policyError {
+	policy := g.Config.Upload
+
+	if policy.UploadMaxSize > 0 && size > policy.UploadMaxSize {
+		return errTooLarge(policy.UploadMaxSize)
+	}
+	return g.validateFilename(filename)
+}
+
+// Checks the extension of the filename against the allowed and the denied ones
+func (g *GinServer) validateFilename(filename string) *policyError {
+	policy := g.Config.Upload
+
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if matchesExtension(policy.UploadDeniedExtensions, ext) ||
+		(len(policy.UploadAllowedExtensions) > 0 && !matchesExtension(policy.UploadAllowedExtensions, ext)) {
+		return &policyError{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    "extension_not_allowed",
+			Message: fmt.Sprintf("files with extension %q are not accepted", ext),
+		}
+	}
+	return nil
+}
+
+// Validates a received file against the upload policy, whose allowed types can be replaced by the bucket.
+// The MIME type is sniffed from the content, the one declared by the client is not trusted. Returns the
+// detected type
+func (g *GinServer) validateUpload(bucket *model.Bucket, filename string, content []byte) (string, *policyError) {
+	policy := g.Config.Upload
+
+	if len(content) == 0 && !policy.UploadAllowEmpty {
+		return "", errEmptyFile()
+	}
+
+	if perr := g.validateUploadHeader(filename, int64(len(content))); perr != nil {
+		return "", perr
+	}
+	return g.validateType(bucket, content)
+}
+
+// Checks the MIME type sniffed from the start of content against the allowed types of bucket
+func (g *GinServer) validateType(bucket *model.Bucket, content []byte) (string, *policyError) {
+	content_type := http.DetectContentType(content)
+	media_type, _, err := mime.ParseMediaType(content_type)
+	if err != nil {
+		media_type = content_type
+	}
+
+	if !g.allowedType(bucket, media_type) {
+		return "", &policyError{
+			Status:  http.StatusUnsupportedMediaType,
+			Code:    "type_not_allowed",
+			Message: fmt.Sprintf("files of type %q are not accepted", media_type),
+		}
+	}
+	return media_type, nil
+}
+
+// Whether files of media_type can be stored in bucket. The denied types always apply
+func (g *GinServer) allowedType(bucket *model.Bucket, media_type string) bool {
+	policy := g.Config.Upload
+
+	allowed := policy.UploadAllowedTypes
+	if len(bucket.AllowedTypes) > 0 {
+		allowed = bucket.AllowedTypes
+	}
+	return !matchesMediaType(policy.UploadDeniedTypes, media_type) &&
+		(len(allowed) == 0 || matchesMediaType(allowed, media_type))
+}
+
+// Matches a media type against a list of patterns such as image/png or image/*
+func matchesMediaType(patterns []string, media_type string) bool {
+	for _, p := range patterns {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "*/*" || p == media_type {
+			return true
+		}
+		if strings.HasSuffix(p, "/*") && strings.HasPrefix(media_type, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesExtension(extensions []string, ext string) bool {
+	for _, e := range extensions {
+		if strings.ToLower(strings.TrimPrefix(strings.TrimSpace(e), ".")) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Keeps only the base name, removing path separators, control characters and leading dots
+func sanitizeFilename(filename string) string {
+	filename = strings.ReplaceAll(filename, "\\", "/")
+	filename = filepath.Base(filename)
+
+	filename = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '/' {
+			return -1
+		}
+		return r
+	}, filename)
+
+	filename = strings.TrimLeft(strings.TrimSpace(filename), ".")
+	if len(filename) > maxFilenameLength {
+		ext := filepath.Ext(filename)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		filename = strings.ToValidUTF8(filename[:maxFilenameLength-len(ext)], "") + ext
+	}
+	return filename
+}
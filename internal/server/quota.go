@@ -0,0 +1,317 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	"go-cdn/pkg/model"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	quotaExceededSoft = "soft"
+	quotaExceededHard = "hard"
+)
+
+type quotaRequest struct {
+	SoftBytes   int64 `json:"soft_bytes"`
+	HardBytes   int64 `json:"hard_bytes"`
+	SoftObjects int64 `json:"soft_objects"`
+	HardObjects int64 `json:"hard_objects"`
+}
+
+// Usage of an owner along with the limits applying to it
+type usageReport struct {
+	model.Usage
+	Quota    *model.Quota `json:"quota,omitempty"`
+	Exceeded string       `json:"exceeded,omitempty"` // soft or hard
+}
+
+// Limits applying to owner: its explicit quota or, for uploaders, the configured defaults. Buckets are
+// also limited by their quota_bytes setting
+func (g *GinServer) ownerQuota(owner string, explicit *model.Quota) *model.Quota {
+	if explicit != nil {
+		return explicit
+	}
+	if strings.HasPrefix(owner, model.BucketOwner("")) {
+		return &model.Quota{Owner: owner}
+	}
+
+	defaults := g.Config.Quota
+	return &model.Quota{
+		Owner:       owner,
+		SoftBytes:   defaults.QuotaSoftBytes,
+		HardBytes:   defaults.QuotaHardBytes,
+		SoftObjects: defaults.QuotaSoftObjects,
+		HardObjects: defaults.QuotaHardObjects,
+	}
+}
+
+func (g *GinServer) getOwnerQuota(ctx context.Context, owner string) (*model.Quota, error) {
+	explicit, err := g.Usage.GetQuota(ctx, owner)
+	if err != nil && !errors.Is(err, repository.ErrKeyDoesNotExist) {
+		return nil, err
+	}
+	return g.ownerQuota(owner, explicit), nil
+}
+
+// Whether value goes beyond limit, 0 meaning unlimited
+func exceeds(limit int64, value int64) bool {
+	return limit > 0 && value > limit
+}
+
+func quotaExceeded(quota *model.Quota, usage *model.Usage) string {
+	switch {
+	case exceeds(quota.HardBytes, usage.Bytes) || exceeds(quota.HardObjects, usage.Objects):
+		return quotaExceededHard
+	case exceeds(quota.SoftBytes, usage.Bytes) || exceeds(quota.SoftObjects, usage.Objects):
+		return quotaExceededSoft
+	}
+	return ""
+}
+
+// Checks that storing size more bytes in objects more files keeps the bucket and the caller within their
+// quotas. Returns the owners whose soft quota is exceeded
+func (g *GinServer) checkQuota(c *gin.Context, bucket *model.Bucket, size int64, objects int64) ([]string, *policyError, error) {
+	if g.Usage == nil {
+		return nil, nil, nil
+	}
+	ctx := c.Request.Context()
+
+	owners := []string{model.BucketOwner(bucket.Name)}
+	if s := subject(c); s != "" {
+		owners = append(owners, s)
+	}
+
+	warnings := []string{}
+	for i, owner := range owners {
+		quota, err := g.getOwnerQuota(ctx, owner)
+		if err != nil {
+			return nil, nil, err
+		}
+		if i == 0 && bucket.QuotaBytes > 0 && (quota.HardBytes == 0 || bucket.QuotaBytes < quota.HardBytes) {
+			quota.HardBytes = bucket.QuotaBytes
+		}
+		if *quota == (model.Quota{Owner: owner}) {
+			continue
+		}
+
+		usage, err := g.Usage.GetUsage(ctx, owner)
+		if err != nil {
+			return nil, nil, err
+		}
+		after := &model.Usage{Bytes: usage.Bytes + size, Objects: usage.Objects + objects}
+
+		switch {
+		case size > 0 && exceeds(quota.HardBytes, after.Bytes):
+			return nil, &policyError{
+				Status:  http.StatusInsufficientStorage,
+				Code:    "quota_exceeded",
+				Message: fmt.Sprintf("the storage quota of %s is %d bytes", owner, quota.HardBytes),
+			}, nil
+		case objects > 0 && exceeds(quota.HardObjects, after.Objects):
+			return nil, &policyError{
+				Status:  http.StatusForbidden,
+				Code:    "object_quota_exceeded",
+				Message: fmt.Sprintf("the quota of %s is %d files", owner, quota.HardObjects),
+			}, nil
+		case quotaExceeded(quota, after) == quotaExceededSoft:
+			warnings = append(warnings, owner)
+		}
+	}
+	return warnings, nil, nil
+}
+
+// Hard quotas are enforced again when the files are stored, which catches the requests that passed
+// checkQuota concurrently. Returns nil if err isn't about the quotas
+func storedQuotaError(err error) *policyError {
+	switch {
+	case errors.Is(err, repository.ErrQuotaExceeded):
+		return &policyError{Status: http.StatusInsufficientStorage, Code: "quota_exceeded", Message: "the storage quota is exceeded"}
+	case errors.Is(err, repository.ErrObjectQuotaExceeded):
+		return &policyError{Status: http.StatusForbidden, Code: "object_quota_exceeded", Message: "the file quota is exceeded"}
+	}
+	return nil
+}
+
+// Replies to the client if a hard quota would be exceeded, returns false if the request must stop.
+// Exceeded soft quotas are reported in the X-Quota-Warning header
+func (g *GinServer) enforceQuota(c *gin.Context, bucket *model.Bucket, size int64, objects int64) bool {
+	warnings, perr, err := g.checkQuota(c, bucket, size, objects)
+	if err != nil {
+		g.requestLogger(c).Errorw("db get usage", "bucket", bucket.Name, "err", err)
+		String(c, http.StatusInternalServerError, "error")
+		return false
+	}
+	if perr != nil {
+		g.requestLogger(c).Infow("upload rejected", "bucket", bucket.Name, "size", size, "reason", perr.Code)
+		JSON(c, perr.Status, perr)
+		return false
+	}
+	g.warnQuota(c, warnings)
+	return true
+}
+
+// Reports the owners whose soft quota is exceeded, the upload still goes through
+func (g *GinServer) warnQuota(c *gin.Context, owners []string) {
+	if len(owners) == 0 {
+		return
+	}
+	g.requestLogger(c).Warnw("soft quota exceeded", "owners", owners)
+	c.Header("X-Quota-Warning", "soft quota exceeded: "+strings.Join(owners, ", "))
+}
+
+// GET handler reporting the usage of every owner, optionally only the ones starting with ?owner=
+func (g *GinServer) getUsageHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/getUsageHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		usages, err := g.Usage.GetUsages(c.Request.Context())
+		if err != nil {
+			g.requestLogger(c).Errorw("db get usages", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+		quotas, err := g.Usage.GetQuotas(c.Request.Context())
+		if err != nil {
+			g.requestLogger(c).Errorw("db get quotas", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		explicit := map[string]*model.Quota{}
+		for i := range quotas {
+			explicit[quotas[i].Owner] = &quotas[i]
+		}
+
+		prefix := c.Query("owner")
+		reports := []usageReport{}
+		for _, usage := range usages {
+			if strings.HasPrefix(usage.Owner, prefix) {
+				reports = append(reports, g.usageReport(usage, explicit[usage.Owner]))
+			}
+		}
+
+		JSON(c, http.StatusOK, gin.H{
+			"list": reports,
+		})
+	}
+}
+
+// GET handler reporting the usage of a single owner
+func (g *GinServer) getOwnerUsageHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/getOwnerUsageHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		owner := c.Param("owner")
+		usage, err := g.Usage.GetUsage(c.Request.Context(), owner)
+		if err != nil {
+			g.requestLogger(c).Errorw("db get usage", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+		explicit, err := g.Usage.GetQuota(c.Request.Context(), owner)
+		if err != nil && !errors.Is(err, repository.ErrKeyDoesNotExist) {
+			g.requestLogger(c).Errorw("db get quota", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		JSON(c, http.StatusOK, g.usageReport(*usage, explicit))
+	}
+}
+
+func (g *GinServer) usageReport(usage model.Usage, explicit *model.Quota) usageReport {
+	report := usageReport{Usage: usage}
+	if quota := g.ownerQuota(usage.Owner, explicit); *quota != (model.Quota{Owner: usage.Owner}) {
+		report.Quota = quota
+		report.Exceeded = quotaExceeded(quota, &usage)
+	}
+	return report
+}
+
+// GET handler to list the explicit quotas
+func (g *GinServer) getQuotasHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/getQuotasHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		quotas, err := g.Usage.GetQuotas(c.Request.Context())
+		if err != nil {
+			g.requestLogger(c).Errorw("db get quotas", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		JSON(c, http.StatusOK, gin.H{
+			"list": quotas,
+		})
+	}
+}
+
+// PUT handler to set the quota of an owner, e.g. key:<id> or bucket:<name>, replacing the defaults
+func (g *GinServer) putQuotaHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/putQuotaHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		var req quotaRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			String(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if req.SoftBytes < 0 || req.HardBytes < 0 || req.SoftObjects < 0 || req.HardObjects < 0 {
+			String(c, http.StatusBadRequest, "quotas can't be negative")
+			return
+		}
+
+		quota := &model.Quota{
+			Owner:       c.Param("owner"),
+			SoftBytes:   req.SoftBytes,
+			HardBytes:   req.HardBytes,
+			SoftObjects: req.SoftObjects,
+			HardObjects: req.HardObjects,
+		}
+		if err := g.Usage.SetQuota(c.Request.Context(), quota); err != nil {
+			g.requestLogger(c).Errorw("db set quota", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		g.requestLogger(c).Infow("set quota", "owner", quota.Owner, "hard_bytes", quota.HardBytes, "hard_objects", quota.HardObjects)
+		JSON(c, http.StatusOK, quota)
+	}
+}
+
+// DELETE handler to remove the quota of an owner, the defaults apply again
+func (g *GinServer) deleteQuotaHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/deleteQuotaHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		err := g.Usage.RemoveQuota(c.Request.Context(), c.Param("owner"))
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			String(c, http.StatusNotFound, "")
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db remove quota", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		String(c, http.StatusOK, "OK")
+	}
+}
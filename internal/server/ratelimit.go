@@ -0,0 +1,139 @@
+package server
+
+import (
+	"fmt"
+	"go-cdn/internal/config"
+	"go-cdn/internal/metrics"
+	"go-cdn/internal/ratelimit"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Rates applied by rateLimit, resolved from the configs once
+type rateLimits struct {
+	rate     ratelimit.Rate
+	perRoute bool
+	routes   map[string]ratelimit.Rate
+	networks []*net.IPNet
+	subjects map[string]bool
+}
+
+func newRateLimits(cfg config.RateLimit, sugar *zap.SugaredLogger) rateLimits {
+	limits := rateLimits{
+		rate:     ratelimit.Rate{PerSecond: cfg.RateLimitRate, Burst: cfg.RateLimitBurst},
+		perRoute: cfg.RateLimitPerRoute,
+		routes:   map[string]ratelimit.Rate{},
+		subjects: map[string]bool{},
+	}
+	if !limits.rate.Valid() {
+		sugar.Errorw("rate limit without budget, every request is denied", "rate", cfg.RateLimitRate, "burst", cfg.RateLimitBurst)
+	}
+	for _, r := range cfg.RateLimitRoutes {
+		limits.routes[r.Route] = ratelimit.Rate{PerSecond: r.Rate, Burst: r.Burst}
+		if !limits.routes[r.Route].Valid() {
+			sugar.Errorw("rate limit without budget, every request is denied", "route", r.Route, "rate", r.Rate, "burst", r.Burst)
+		}
+	}
+	for _, cidr := range cfg.RateLimitAllowedNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			sugar.Errorw("invalid rate limit allowed network", "cidr", cidr, "err", err)
+			continue
+		}
+		limits.networks = append(limits.networks, network)
+	}
+	for _, s := range cfg.RateLimitAllowedSubjects {
+		limits.subjects[s] = true
+	}
+	return limits
+}
+
+func (l *rateLimits) allowlisted(subject string, ip net.IP) bool {
+	if subject != "" && l.subjects[subject] {
+		return true
+	}
+	for _, network := range l.networks {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Limits the requests of each client, identified by its subject once authenticated or by its IP otherwise.
+// Runs after authorize so that keys don't share the budget of their IP
+func (g *GinServer) rateLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if g.Limiter == nil {
+			c.Next()
+			return
+		}
+
+		ip := c.ClientIP()
+		client := subject(c)
+		if g.limits.allowlisted(client, net.ParseIP(ip)) {
+			c.Next()
+			return
+		}
+		if client == "" {
+			client = "ip:" + ip
+		}
+
+		route := c.Request.Method + " " + c.FullPath()
+		rate, override := g.limits.routes[route]
+		if !override {
+			rate = g.limits.rate
+		}
+		key := client
+		if override || g.limits.perRoute {
+			key += " " + route
+		}
+
+		// Zero or negative rates deny explicitly, there is no point in retrying
+		if !rate.Valid() {
+			metrics.RecordRateLimited(c.Request.Context(), route)
+			c.Abort()
+			JSON(c, http.StatusTooManyRequests, gin.H{"error": "rate_limited", "message": "no request is allowed"})
+			return
+		}
+
+		res, err := g.Limiter.Allow(c.Request.Context(), key, rate)
+		if err != nil {
+			g.requestLogger(c).Errorw("rate limit", "err", err)
+			metrics.RecordRateLimitError(c.Request.Context())
+			if g.Config.RateLimit.RateLimitFailOpen {
+				c.Next()
+				return
+			}
+			c.Header("Retry-After", "1")
+			c.Abort()
+			JSON(c, http.StatusServiceUnavailable, gin.H{"error": "rate_limit_unavailable", "message": "the request can't be accounted for, retry later"})
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", ceilSeconds(res.Reset))
+		if !res.Allowed {
+			metrics.RecordRateLimited(c.Request.Context(), route)
+			c.Header("Retry-After", ceilSeconds(res.RetryAfter))
+			c.Abort()
+			JSON(c, http.StatusTooManyRequests, gin.H{
+				"error":   "rate_limited",
+				"message": fmt.Sprintf("too many requests, retry in %s", res.RetryAfter.Round(time.Millisecond)),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
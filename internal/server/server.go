@@ -4,13 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"go-cdn/internal/auth"
 	"go-cdn/internal/config"
 	"go-cdn/internal/database/controller"
 	"go-cdn/internal/database/repository"
+	"go-cdn/internal/fetch"
+	"go-cdn/internal/logger"
+	"go-cdn/internal/metrics"
+	"go-cdn/internal/ratelimit"
+	"go-cdn/internal/stats"
 	"go-cdn/internal/tracing"
+	"go-cdn/internal/warmup"
 	"go-cdn/pkg/model"
+	"go-cdn/pkg/signedurl"
 	"go-cdn/pkg/utils"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os/signal"
 	"sync"
@@ -21,34 +30,62 @@ import (
 	"github.com/google/uuid"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
-	"go.uber.org/ratelimit"
 	"go.uber.org/zap"
 )
 
 type GinServer struct {
-	Config *config.Config
-	Cache  *database.Controller
-	DB     *database.Controller
-	Sugar  *zap.SugaredLogger
-	limit  ratelimit.Limiter
-	rps    int
+	Config    *config.Config
+	Cache     *database.Controller
+	DB        *database.Controller
+	Sugar     *zap.SugaredLogger
+	Hits      *stats.HitCounter
+	Warmer    *warmup.Warmer
+	Uploads   *database.UploadController
+	Versions  *database.VersionController
+	Trash     *database.TrashController
+	Fetcher   *fetch.Fetcher
+	Keys      *database.KeyController
+	APIKeys   *auth.APIKeyAuthenticator
+	Bearer    auth.Authenticator
+	Access    *database.AccessController
+	Signer    *signedurl.Signer
+	Buckets   *database.BucketController
+	Usage     *database.UsageController
+	Egress    *stats.EgressCounter
+	Traffic   *database.EgressController
+	Limiter   ratelimit.Limiter
+	LogLevels *logger.Levels
+	buckets   bucketCache
+	limits    rateLimits
+	throttle  *throttling
+	draining  int32
 }
 
-func New(cfg *config.Config, db *database.Controller, cache *database.Controller, sugar *zap.SugaredLogger) *GinServer {
+func New(cfg *config.Config, db *database.Controller, cache *database.Controller, sugar *zap.SugaredLogger, opts ...ServerOpt) *GinServer {
 	g := &GinServer{
 		Config: cfg,
 		Cache:  cache,
 		DB:     db,
 		Sugar:  sugar,
 	}
+	g.buckets.entries = map[string]cachedBucket{}
 
-	if g.Config.HTTPServer.RateLimitEnable {
-		g.rps = g.Config.HTTPServer.RateLimit
-		// The rate limiter gets applied on *concurrent* requests, to change the behavior use WithoutSlack
-		g.limit = ratelimit.New(g.rps, ratelimit.WithSlack(10))
-		g.Sugar.Infow("using leakyBucket", "rps", g.rps)
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	if g.Config.RateLimit.RateLimitEnable {
+		if g.Limiter == nil {
+			g.Limiter = ratelimit.NewLocal(g.Config.RateLimit.RateLimitMaxClients)
+		}
+		g.limits = newRateLimits(g.Config.RateLimit, g.Sugar)
+		g.Sugar.Infow("using rate limit", "rate", g.limits.rate.PerSecond, "burst", g.limits.rate.Burst)
+	}
+	if g.Config.Throttle.ThrottleEnable {
+		g.throttle = newThrottling(g.Config.Throttle)
 	}
 
 	return g
@@ -63,20 +100,43 @@ func (g *GinServer) requestMetadataMiddleware() gin.HandlerFunc {
 		wg := sync.WaitGroup{}
 		c.Set("wg", &wg)
 
-		req_id, _ := uuid.NewRandom()
+		req_id := g.requestID(c)
 		req_path := c.Request.URL.Path
-		c.Set("request.id", req_id.String())
+		c.Set("request.id", req_id)
+		c.Header(tracing.RequestIDHeader, req_id)
+		c.Request = c.Request.WithContext(tracing.WithRequestID(c.Request.Context(), req_id))
 
 		// Attaches request.id to the root span
 		span := trace.SpanFromContext(c.Request.Context())
-		span.SetAttributes(attribute.String("request.id", req_id.String()))
+		span.SetAttributes(attribute.String("request.id", req_id))
 		span.SetAttributes(attribute.String("request.path", req_path))
 		span.SetAttributes(attribute.String("service.id", g.Config.Consul.ConsulServiceID))
 
 		c.Next()
+
+		// The principal is only known once authorize has run
+		if p := principal(c); p != nil {
+			span.SetAttributes(attribute.String("enduser.id", p.Subject))
+			span.SetAttributes(attribute.String("auth.method", p.Method))
+		}
 	}
 }
 
+// Keeps the id set by the load balancer or the client, otherwise the one received in the baggage.
+// Invalid ids are replaced, so that they can't forge log lines
+func (g *GinServer) requestID(c *gin.Context) string {
+	if id := c.GetHeader(tracing.RequestIDHeader); id != "" {
+		if tracing.ValidRequestID(id) {
+			return id
+		}
+		g.Sugar.Debugw("invalid request id", "request.id", id)
+	}
+	if id := baggage.FromContext(c.Request.Context()).Member(tracing.RequestIDBaggage).Value(); tracing.ValidRequestID(id) {
+		return id
+	}
+	return uuid.NewString()
+}
+
 func (g *GinServer) errorPropagatorMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		span := trace.SpanFromContext(c.Request.Context()) // Here to attach the error to the root span
@@ -103,44 +163,203 @@ func (g *GinServer) errorPropagatorMiddleware() gin.HandlerFunc {
 	}
 }
 
-func (g *GinServer) leakBucket() gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		g.limit.Take()
-	}
-}
-
-func (g *GinServer) Spawn(opts ...OptFunc) {
-	stop_ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
-
-	// Apply optional values
-	for _, opt := range opts {
-		opt()
+// Builds a gin engine with the middlewares and the health routes, extra middlewares run before the
+// tracing ones
+func (g *GinServer) engine(middlewares ...gin.HandlerFunc) *gin.Engine {
+	// gin's own logger is replaced by the zap access log
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	// X-Forwarded-For is only read from the configured proxies, the client could pick its address otherwise
+	if err := r.SetTrustedProxies(g.Config.HTTPServer.TrustedProxies); err != nil {
+		g.Sugar.Errorw("invalid trusted proxies, using the peer address", "proxies", g.Config.HTTPServer.TrustedProxies, "err", err)
+		r.SetTrustedProxies(nil)
 	}
+	r.Use(middlewares...)
 
-	r := gin.Default()
-
-	if g.Config.HTTPServer.RateLimitEnable {
-		r.Use(g.leakBucket())
+	// The request metrics are also exported over OTLP along with the traces
+	if g.Config.Metrics.MetricsEnable || g.Config.Telemetry.TelemetryEnable {
+		r.Use(g.metricsMiddleware())
 	}
 
 	r.Use(otelgin.Middleware("gin-server"))
 	r.Use(g.requestMetadataMiddleware())
+	if g.Config.AccessLog.AccessLogEnable {
+		r.Use(g.accessLogMiddleware())
+	}
 	r.Use(g.errorPropagatorMiddleware())
 
 	r.GET("/health", func(c *gin.Context) {
 		String(c, http.StatusOK, "OK")
 	})
+	r.GET("/livez", g.livezHandler())
+	r.GET("/readyz", g.readyzHandler())
+	return r
+}
 
-	r.GET("/content/:hash", g.getFileHandler())
-	r.GET("/content/list", g.getFileListHandler())
+// Router builds the gin engine with all the enabled routes. When the admin listener is enabled only the
+// read routes are kept here, the others are served by AdminRouter
+func (g *GinServer) Router() *gin.Engine {
+	r := g.engine()
+	internal := !g.Config.Admin.AdminEnable
+
+	// Files of the default bucket are served both under /content/ and /content/default/
+	g.contentRoutes(r, "/content", false, internal)
+	g.contentRoutes(r, "/content/:bucket", true, internal)
+	if internal {
+		g.internalRoutes(r)
+
+		// Without authentication anyone reaching the public port would be an admin
+		if g.Config.Auth.AuthEnable {
+			g.adminRoutes(r)
+		} else {
+			g.Sugar.Warnw("admin routes disabled, they require auth.enable or admin.enable")
+		}
+	}
+	return r
+}
+
+// AdminRouter serves all the routes, including the writes and the admin ones, to the allowed networks
+func (g *GinServer) AdminRouter() *gin.Engine {
+	r := g.engine(g.allowNetworks())
+	g.contentRoutes(r, "/content", false, true)
+	g.contentRoutes(r, "/content/:bucket", true, true)
+	g.internalRoutes(r)
+	g.adminRoutes(r)
+	g.logLevelRoutes(r.Group("/admin", g.authorize(auth.ScopeAdmin)))
+	return r
+}
+
+// Registers the uploads and the metrics routes
+func (g *GinServer) internalRoutes(r *gin.Engine) {
+	if g.Config.Metrics.MetricsEnable {
+		r.GET(g.Config.Metrics.MetricsPath, metricsHandler())
+	}
+
+	if g.Config.HTTPServer.AllowInsertion && g.Uploads != nil {
+		tus := r.Group(tusPath, g.tusMiddleware())
+		tus.OPTIONS("", g.optionsUploadHandler())
+
+		tus_write := tus.Group("", g.authorize(auth.ScopeWrite), g.rateLimit())
+		tus_write.POST("", g.postUploadHandler())
+		tus_write.HEAD(":id", g.headUploadHandler())
+		tus_write.PATCH(":id", g.patchUploadHandler())
+		tus_write.DELETE(":id", g.deleteUploadHandler())
+	}
+}
+
+// Registers the routes managing the warm-up, the keys, the buckets and the quotas
+func (g *GinServer) adminRoutes(r *gin.Engine) {
+	admin := r.Group("/admin", g.authorize(auth.ScopeAdmin), g.rateLimit())
+	if g.Warmer != nil {
+		admin.POST("/warmup", g.postWarmupHandler())
+		admin.GET("/warmup", g.getWarmupHandler())
+	}
+	if g.Keys != nil {
+		admin.GET("/keys", g.getKeysHandler())
+		admin.POST("/keys", g.postKeyHandler())
+		admin.POST("/keys/:id/rotate", g.postRotateKeyHandler())
+		admin.DELETE("/keys/:id", g.deleteKeyHandler())
+	}
+	if g.Buckets != nil {
+		admin.GET("/buckets", g.getBucketsHandler())
+		admin.POST("/buckets", g.postBucketHandler())
+		admin.GET("/buckets/:name", g.getBucketHandler())
+		admin.PUT("/buckets/:name", g.putBucketHandler())
+		admin.DELETE("/buckets/:name", g.deleteBucketHandler())
+	}
+	if g.Usage != nil {
+		admin.GET("/usage", g.getUsageHandler())
+		admin.GET("/usage/:owner", g.getOwnerUsageHandler())
+		admin.GET("/quotas", g.getQuotasHandler())
+		admin.PUT("/quotas/:owner", g.putQuotaHandler())
+		admin.DELETE("/quotas/:owner", g.deleteQuotaHandler())
+	}
+	if g.Traffic != nil {
+		admin.GET("/egress", g.getEgressHandler())
+	}
+}
+
+// Registers the file routes of a bucket under base. Routes without a bucket segment target the default
+// bucket; their hash is then the first wildcard, named bucket as gin doesn't allow two names for it.
+// The listing, write and delete routes are only registered when writable
+func (g *GinServer) contentRoutes(r *gin.Engine, base string, scoped bool, writable bool) {
+	hash := "/:hash"
+	if !scoped {
+		hash = "/:bucket"
+	}
+
+	// Reads are public unless auth.protect_read is set
+	read := r.Group(base, g.bucketScope(scoped), g.authorize(auth.ScopeRead), g.rateLimit())
+	download := []gin.HandlerFunc{}
+	if g.Egress != nil {
+		download = append(download, g.egressMiddleware())
+	}
+	if g.throttle != nil {
+		download = append(download, g.throttleMiddleware())
+	}
+	read.GET(hash, append(download, g.getFileHandler())...)
+	if g.Versions != nil {
+		read.GET(hash+"/versions", g.getFileVersionsHandler())
+	}
+
+	// Listing enumerates the bucket, it stays off the public listener along with the writes. The route is
+	// still taken there, list would be served as a hash otherwise
+	if !writable {
+		read.GET("/list", func(c *gin.Context) { String(c, http.StatusNotFound, "") })
+		return
+	}
+	read.GET("/list", g.getFileListHandler())
 
 	if g.Config.HTTPServer.AllowInsertion {
-		r.POST("/content/", g.postFileHandler())
+		write := r.Group(base, g.bucketScope(scoped), g.authorize(auth.ScopeWrite), g.rateLimit())
+		write.POST("/", g.postFileHandler())
+		write.POST("/batch", g.postBatchHandler())
+
+		if g.Versions != nil {
+			write.PUT(hash, g.putFileHandler())
+		}
+		if g.Fetcher != nil {
+			write.POST("/fetch", g.postFetchHandler())
+		}
+		if g.Access != nil {
+			write.PATCH(hash, g.patchFileHandler())
+		}
+		if g.Signer != nil {
+			write.POST(hash+"/sign", g.postSignHandler())
+		}
 	}
 
 	if g.Config.HTTPServer.AllowDeletion {
-		r.DELETE("/content/:hash", g.deleteFileHandler())
+		del := r.Group(base, g.bucketScope(scoped), g.authorize(auth.ScopeDelete), g.rateLimit())
+		del.DELETE(hash, g.deleteFileHandler())
+		del.POST("/batch/delete", g.postBatchDeleteHandler())
+
+		if g.Trash != nil {
+			del.GET("/trash", g.getTrashHandler())
+			del.POST(hash+"/restore", g.postRestoreHandler())
+			del.DELETE("/trash/:hash", g.deleteTrashHandler())
+		}
+	}
+}
+
+func (g *GinServer) Spawn(opts ...OptFunc) {
+	stop_ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Apply optional values
+	for _, opt := range opts {
+		opt()
+	}
+
+	r := g.Router()
+
+	// Background jobs, bound to the server lifetime
+	if g.Config.HTTPServer.AllowInsertion && g.Uploads != nil {
+		go g.runUploadExpiration(stop_ctx)
+	}
+	if g.Trash != nil {
+		go g.runTrashPurge(stop_ctx)
 	}
 
 	srv := &http.Server{
@@ -155,6 +374,36 @@ func (g *GinServer) Spawn(opts ...OptFunc) {
 		}
 	}()
 
+	// The writes and the admin routes are kept off the public port
+	var admin_srv *http.Server
+	if g.Config.Admin.AdminEnable {
+		admin_srv = &http.Server{
+			Addr:    g.Config.Admin.AdminAddress,
+			Handler: g.AdminRouter(),
+		}
+		go func() {
+			g.Sugar.Infow("admin listener", "address", admin_srv.Addr)
+			if err := admin_srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				g.Sugar.Panicw("admin listen", "err", err)
+			}
+		}()
+	}
+
+	// pprof and the runtime stats are kept off the public port
+	var debug_srv *http.Server
+	if g.Config.Debug.DebugEnable {
+		debug_srv = &http.Server{
+			Addr:    g.Config.Debug.DebugAddress,
+			Handler: g.DebugRouter(),
+		}
+		go func() {
+			g.Sugar.Infow("debug listener", "address", debug_srv.Addr)
+			if err := debug_srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				g.Sugar.Errorw("debug listen", "err", err)
+			}
+		}()
+	}
+
 	// Listen for the interrupt signal.
 	<-stop_ctx.Done()
 
@@ -162,9 +411,24 @@ func (g *GinServer) Spawn(opts ...OptFunc) {
 	stop()
 	g.Sugar.Info("shutting down gracefully, press Ctrl+C again to force")
 
+	// Keeps serving while the checks notice the instance isn't ready anymore
+	g.Drain()
+	if delay := g.Config.Health.HealthShutdownDelay; delay > 0 {
+		g.Sugar.Infow("draining", "delay", delay)
+		time.Sleep(delay)
+	}
+
 	// The context is used to inform the server it has 5 seconds to finish the request it is currently handling
 	stop_ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+	if debug_srv != nil {
+		debug_srv.Close()
+	}
+	if admin_srv != nil {
+		if err := admin_srv.Shutdown(stop_ctx); err != nil {
+			g.Sugar.Errorw("admin listener forced to shutdown", "err", err)
+		}
+	}
 	if err := srv.Shutdown(stop_ctx); err != nil {
 		g.Sugar.Panicw("server forced to shutdown", "err", err)
 	}
@@ -181,95 +445,144 @@ func (g *GinServer) getFileHandler() gin.HandlerFunc {
 		err_ch := c.MustGet("err_ch").(chan error)
 		wg := c.MustGet("wg").(*sync.WaitGroup)
 
-		hash := c.Param("hash")
+		bucket := currentBucket(c)
+		hash := fileHash(c)
 
-		if g.Config.Cache.RedisEnable {
-			cached_file, err := g.Cache.GetFile(c.Request.Context(), hash)
+		signed, err := g.verifySignature(c)
+		if err != nil {
+			forbidSignature(c, err)
+			return
+		}
+		if bucket.Private && !g.canReadPrivate(c, signed) {
+			forbidPrivate(c)
+			return
+		}
+		if bucket.CacheControl != "" {
+			c.Header("Cache-Control", bucket.CacheControl)
+		}
+
+		if version := c.Query("version"); version != "" && g.Versions != nil {
+			// The signature doesn't cover the query, it would unlock every revision of the file
+			if signed {
+				forbidSignature(c, errSignedVersion)
+				return
+			}
+			g.serveFileVersion(c, bucket.Name, hash, version)
+			return
+		}
+
+		// Private files are never cached, a cache hit is always public
+		cacheable := g.Config.Cache.RedisEnable && !bucket.Private && !bucket.NoCache
+		if !cacheable {
+			setCacheStatus(c, "bypass")
+		}
+		if cacheable {
+			cached_file, err := g.Cache.GetFile(c.Request.Context(), bucket.Name, hash)
 			// Cache miss, the request is still good
 			if err != nil {
-				g.Sugar.Infow("cache miss", "err", err)
+				g.requestLogger(c).Infow("cache miss", "err", err)
+				metrics.RecordCache(c.Request.Context(), "miss")
+				setCacheStatus(c, "miss")
 				err_ch <- err // Only works with a buffered ch
 			} else {
 				bytes := cached_file.Content
 				if bytes != nil {
+					metrics.RecordCache(c.Request.Context(), "hit")
+					setCacheStatus(c, "hit")
+					g.recordHit(bucket.Name, hash)
 					Data(c, http.StatusOK, "image", bytes)
 					return
 				}
 			}
 		}
 
-		stored_file, err := g.DB.GetFile(c.Request.Context(), hash)
+		stored_file, err := g.DB.GetFile(c.Request.Context(), bucket.Name, hash)
 		if err != nil {
-			g.Sugar.Errorw("db file miss", "err", err)
+			g.requestLogger(c).Errorw("db file miss", "err", err)
 			String(c, http.StatusBadRequest, "")
 			return
 		}
+		if stored_file.Private && !g.canReadPrivate(c, signed) {
+			forbidPrivate(c)
+			return
+		}
 
 		// Asynchronously add to Redis cache
-		if g.Config.Cache.RedisEnable {
+		if cacheable && !stored_file.Private {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
 				err := g.Cache.AddFile(c.Request.Context(), stored_file)
+				if err == nil {
+					metrics.RecordCache(c.Request.Context(), "fill")
+				}
 				err_ch <- err
 			}()
 		}
 
+		g.recordHit(bucket.Name, hash)
 		Data(c, http.StatusOK, "image", stored_file.Content)
 	}
 }
 
+func (g *GinServer) recordHit(bucket string, hash string) {
+	if g.Hits != nil {
+		g.Hits.Record(bucket, hash)
+	}
+}
+
 // POST handler to add an image
 func (g *GinServer) postFileHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		_, span := tracing.Tracer.Start(c.Request.Context(), "gin/postFileHandler")
 		defer span.End()
 
-		hash := utils.RandStringBytes(6)
-		stored, err := g.DB.GetFile(c.Request.Context(), hash)
+		bucket := currentBucket(c)
 
-		if err != nil && !errors.Is(err, repository.ErrKeyDoesNotExist) {
-			g.Sugar.Errorw("db get file", "stored", stored, "err", err)
-			String(c, http.StatusInternalServerError, "error")
-			return
+		// Rejects oversized requests before reading the body
+		if max := g.maxBodySize(); max > 0 {
+			if c.Request.ContentLength > max {
+				JSON(c, http.StatusRequestEntityTooLarge, errTooLarge(g.Config.Upload.UploadMaxSize))
+				return
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
 		}
 
-		filename := c.PostForm("filename")
 		file, err := c.FormFile("file")
 		if err != nil {
-			g.Sugar.Errorw("FormFile", "err", err)
+			var max_err *http.MaxBytesError
+			if errors.As(err, &max_err) {
+				JSON(c, http.StatusRequestEntityTooLarge, errTooLarge(g.Config.Upload.UploadMaxSize))
+				return
+			}
+			g.requestLogger(c).Errorw("FormFile", "err", err)
 			String(c, http.StatusBadRequest, "")
 			return
 		}
 
-		stream, err := file.Open()
-		if err != nil {
-			g.Sugar.Errorw("FileOpen", "err", err)
-			String(c, http.StatusBadRequest, "")
+		filename, bytes, err := g.readUpload(bucket, file, c.PostForm("filename"))
+		var perr *policyError
+		if errors.As(err, &perr) {
+			g.requestLogger(c).Infow("upload rejected", "filename", filename, "size", file.Size, "reason", perr.Code)
+			JSON(c, perr.Status, perr)
 			return
 		}
-		defer stream.Close()
-
-		bytes, err := io.ReadAll(stream)
 		if err != nil {
-			g.Sugar.Errorw("ReadAll", "err", err)
+			g.requestLogger(c).Errorw("read upload", "err", err)
 			String(c, http.StatusBadRequest, "")
 			return
 		}
 
-		g.Sugar.Infow("adding an image",
-			"filename", filename,
-			"bytes", string(bytes)[:6],
-			"err", err)
-
-		err = g.DB.AddFile(c.Request.Context(), &model.StoredFile{
-			IDHash:   hash,
-			Filename: filename,
-			Content:  bytes,
-		})
+		if !g.enforceQuota(c, bucket, int64(len(bytes)), 1) {
+			return
+		}
 
+		hash, err := g.addFile(c, filename, bytes, parseBool(c.PostForm("private")))
+		if perr := storedQuotaError(err); perr != nil {
+			JSON(c, perr.Status, perr)
+			return
+		}
 		if err != nil {
-			g.Sugar.Errorw("db add file", "err", err)
 			String(c, http.StatusBadRequest, "")
 			return
 		}
@@ -280,7 +593,69 @@ func (g *GinServer) postFileHandler() gin.HandlerFunc {
 	}
 }
 
-// DELETE handler to remove an image. Doesn't return an HTTP error by design
+// Stores an already validated file in the bucket of the route under a new random hash, on behalf of
+// the authenticated caller
+func (g *GinServer) addFile(c *gin.Context, filename string, bytes []byte, private bool) (string, error) {
+	ctx := c.Request.Context()
+	logger := g.requestLogger(c)
+	bucket := currentBucket(c).Name
+
+	logger.Infow("adding an image",
+		"bucket", bucket,
+		"filename", filename,
+		"size", len(bytes))
+
+	// Trashed files keep their hash until they are purged, so another one is drawn when it's taken
+	for attempt := 1; ; attempt++ {
+		hash := utils.RandStringBytes(6)
+		err := g.DB.AddFile(ctx, &model.StoredFile{
+			Bucket:     bucket,
+			IDHash:     hash,
+			Filename:   filename,
+			Content:    bytes,
+			UploadedBy: subject(c),
+			Private:    private,
+		})
+		if err == nil {
+			return hash, nil
+		}
+		if !errors.Is(err, repository.ErrKeyExists) || attempt == hashAttempts {
+			logger.Errorw("db add file", "err", err)
+			return "", err
+		}
+	}
+}
+
+// Reads a multipart file and validates it against the upload policy of bucket. The filename falls back to
+// the one of the part if not given. Policy violations are returned as *policyError
+func (g *GinServer) readUpload(bucket *model.Bucket, file *multipart.FileHeader, filename string) (string, []byte, error) {
+	if filename == "" {
+		filename = file.Filename
+	}
+	filename = sanitizeFilename(filename)
+
+	if perr := g.validateUploadHeader(filename, file.Size); perr != nil {
+		return filename, nil, perr
+	}
+
+	stream, err := file.Open()
+	if err != nil {
+		return filename, nil, err
+	}
+	defer stream.Close()
+
+	bytes, err := io.ReadAll(stream)
+	if err != nil {
+		return filename, nil, err
+	}
+
+	if _, perr := g.validateUpload(bucket, filename, bytes); perr != nil {
+		return filename, nil, perr
+	}
+	return filename, bytes, nil
+}
+
+// DELETE handler to move an image to the trash, from where it can be restored until it's purged
 func (g *GinServer) deleteFileHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		_, span := tracing.Tracer.Start(c.Request.Context(), "gin/deleteFileHandler")
@@ -289,25 +664,32 @@ func (g *GinServer) deleteFileHandler() gin.HandlerFunc {
 		// Setup error propagation
 		err_ch := c.MustGet("err_ch").(chan error)
 		wg := c.MustGet("wg").(*sync.WaitGroup)
-		hash := c.Param("hash")
+		bucket := currentBucket(c).Name
+		hash := fileHash(c)
 
 		if g.Config.Cache.RedisEnable {
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				err := g.Cache.RemoveFile(c.Request.Context(), hash)
+				err := g.Cache.RemoveFile(c.Request.Context(), bucket, hash)
 				err_ch <- err
 			}()
 		}
 
-		err := g.DB.RemoveFile(c.Request.Context(), hash)
+		err := g.DB.RemoveFile(c.Request.Context(), bucket, hash)
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			String(c, http.StatusNotFound, "")
+			return
+		}
 		if err != nil {
-			g.Sugar.Errorw("db remove file", "err", err)
+			g.requestLogger(c).Errorw("db remove file", "err", err)
 			wg.Add(1)
 			go func(err error) {
 				defer wg.Done()
 				err_ch <- err
 			}(err)
+			String(c, http.StatusInternalServerError, "error")
+			return
 		}
 
 		String(c, http.StatusOK, "OK")
@@ -325,9 +707,15 @@ func (g *GinServer) getFileListHandler() gin.HandlerFunc {
 		err_ch := c.MustGet("err_ch").(chan error)
 		wg := c.MustGet("wg").(*sync.WaitGroup)
 
-		file_list, err := g.DB.GetFileList(c.Request.Context())
+		bucket := currentBucket(c)
+		if bucket.Private && !g.canReadPrivate(c, false) {
+			forbidPrivate(c)
+			return
+		}
+
+		file_list, err := g.DB.GetFileList(c.Request.Context(), bucket.Name)
 		if err != nil {
-			g.Sugar.Errorw("db get file list", "err", err)
+			g.requestLogger(c).Errorw("db get file list", "err", err)
 			wg.Add(1)
 			go func(err error) {
 				defer wg.Done()
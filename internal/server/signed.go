@@ -0,0 +1,154 @@
+package server
+
+import (
+	"errors"
+	"go-cdn/internal/auth"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	"go-cdn/pkg/signedurl"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type signRequest struct {
+	TTL string `json:"ttl"` // e.g. 10m, defaults to signing.default_ttl
+	IP  string `json:"ip"`  // Binds the URL to the address of the final user
+}
+
+type accessRequest struct {
+	Private *bool `json:"private" binding:"required"`
+}
+
+// Checks the signature parameters of the request, if any. A request with a wrong or expired signature is
+// rejected even if the file is public, so that clients notice broken URLs
+func (g *GinServer) verifySignature(c *gin.Context) (bool, error) {
+	if g.Signer == nil || c.Query(signedurl.ParamSig) == "" {
+		return false, nil
+	}
+	// The client address only comes from X-Forwarded-For behind http.trusted_proxies, so that the binding
+	// can't be bypassed with a forged header
+	err := g.Signer.Verify(c.Request.URL.EscapedPath(), c.Request.URL.Query(), c.ClientIP(), time.Now())
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Private files and the files of private buckets need a valid signature, or credentials with the read scope
+func (g *GinServer) canReadPrivate(c *gin.Context, signed bool) bool {
+	if signed {
+		return true
+	}
+	p := principal(c)
+	return p != nil && p.Has(auth.ScopeRead)
+}
+
+func forbidSignature(c *gin.Context, err error) {
+	JSON(c, http.StatusForbidden, gin.H{"error": "invalid_signature", "message": err.Error()})
+}
+
+func forbidPrivate(c *gin.Context) {
+	JSON(c, http.StatusForbidden, gin.H{"error": "private_file", "message": "this file requires a signed url"})
+}
+
+// POST handler minting a signed URL to download a file
+func (g *GinServer) postSignHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/postSignHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		var req signRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			String(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		ttl := g.Config.Signing.SigningDefaultTTL
+		if req.TTL != "" {
+			d, err := time.ParseDuration(req.TTL)
+			if err != nil || d <= 0 {
+				String(c, http.StatusBadRequest, "invalid ttl")
+				return
+			}
+			ttl = d
+		}
+		if max := g.Config.Signing.SigningMaxTTL; max > 0 && ttl > max {
+			String(c, http.StatusBadRequest, "ttl exceeds "+max.String())
+			return
+		}
+
+		// Signs the route the URL was requested for, with or without the bucket segment
+		path := strings.TrimSuffix(c.Request.URL.EscapedPath(), "/sign")
+		expires := time.Now().Add(ttl).Truncate(time.Second) // The signature has second precision
+		query := g.Signer.Sign(path, expires, req.IP)
+
+		g.requestLogger(c).Infow("signed url", "path", path, "expires", expires, "ip", req.IP)
+		JSON(c, http.StatusOK, gin.H{
+			"url":        path + "?" + query.Encode(),
+			"expires_at": expires.UTC(),
+		})
+	}
+}
+
+// PATCH handler to change the access settings of a file
+func (g *GinServer) patchFileHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/patchFileHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		// Setup error propagation
+		err_ch := c.MustGet("err_ch").(chan error)
+		wg := c.MustGet("wg").(*sync.WaitGroup)
+
+		bucket := currentBucket(c).Name
+		hash := fileHash(c)
+
+		var req accessRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			String(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		err := g.Access.SetPrivate(c.Request.Context(), bucket, hash, *req.Private)
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			String(c, http.StatusNotFound, "")
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db set private", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		// A cached copy would keep being served without signature. The purge also keeps a concurrent GET
+		// that read the file while it was public from caching it again
+		if *req.Private && g.Config.Cache.RedisEnable {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := g.Cache.RemoveFile(c.Request.Context(), bucket, hash)
+				err_ch <- err
+			}()
+		}
+
+		g.requestLogger(c).Infow("changed file access", "bucket", bucket, "hash", hash, "private", *req.Private)
+		JSON(c, http.StatusOK, gin.H{
+			"bucket":  bucket,
+			"hash":    hash,
+			"private": *req.Private,
+		})
+	}
+}
+
+// Parses a boolean form field or query parameter, false if missing or invalid
+func parseBool(value string) bool {
+	b, _ := strconv.ParseBool(value)
+	return b
+}
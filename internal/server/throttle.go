@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"go-cdn/internal/config"
+	"go-cdn/internal/metrics"
+	"go-cdn/internal/ratelimit"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Largest write made at once to a throttled response
+const throttleChunkSize = 32 << 10
+
+// Bandwidth shaping of the downloads, the time they were slowed down is exported with the metrics
+type throttling struct {
+	cfg    config.Throttle
+	global *ratelimit.Throttle // nil if the instance has no global rate
+	exempt map[string]bool
+}
+
+func newThrottling(cfg config.Throttle) *throttling {
+	t := &throttling{cfg: cfg, exempt: map[string]bool{}}
+	if cfg.ThrottleGlobalRate > 0 {
+		t.global = ratelimit.NewThrottle(cfg.ThrottleGlobalRate, cfg.ThrottleGlobalBurst)
+	}
+	for _, s := range cfg.ThrottleExemptSubjects {
+		t.exempt[s] = true
+	}
+	return t
+}
+
+// Response writer waiting on the throttles before each chunk it sends
+type throttledWriter struct {
+	gin.ResponseWriter
+	ctx       context.Context
+	throttles []*ratelimit.Throttle
+	chunk     int
+	waited    time.Duration
+}
+
+func (w *throttledWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		n := len(b)
+		if n > w.chunk {
+			n = w.chunk
+		}
+		for _, t := range w.throttles {
+			waited, err := t.Wait(w.ctx, n)
+			if err != nil {
+				return written, err
+			}
+			w.waited += waited
+		}
+
+		m, err := w.ResponseWriter.Write(b[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		b = b[n:]
+	}
+	return written, nil
+}
+
+func (w *throttledWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Slows down the response of a download to the configured rates, unless the caller is exempted
+func (g *GinServer) throttleMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := subject(c)
+		if g.throttle.exempt[s] || (s != "" && g.throttle.cfg.ThrottleExemptAuthenticated) {
+			c.Next()
+			return
+		}
+
+		w := &throttledWriter{ResponseWriter: c.Writer, ctx: c.Request.Context(), chunk: throttleChunkSize}
+		if g.throttle.cfg.ThrottleRate > 0 {
+			w.throttles = append(w.throttles, ratelimit.NewThrottle(g.throttle.cfg.ThrottleRate, g.throttle.cfg.ThrottleBurst))
+		}
+		if g.throttle.global != nil {
+			w.throttles = append(w.throttles, g.throttle.global)
+		}
+		for _, t := range w.throttles {
+			if burst := int(t.Burst()); burst > 0 && burst < w.chunk {
+				w.chunk = burst
+			}
+		}
+		if len(w.throttles) == 0 {
+			c.Next()
+			return
+		}
+
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.waited > 0 {
+			metrics.RecordThrottled(c.Request.Context(), w.waited)
+			trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.Int64("http.throttled_ms", w.waited.Milliseconds()))
+		}
+	}
+}
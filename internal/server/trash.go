@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET handler to list the files in the trash
+func (g *GinServer) getTrashHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/getTrashHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		trash, err := g.Trash.GetTrash(c.Request.Context(), currentBucket(c).Name)
+		if err != nil {
+			g.requestLogger(c).Errorw("db get trash", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		JSON(c, http.StatusOK, gin.H{
+			"list": trash,
+		})
+	}
+}
+
+// POST handler to restore a file from the trash
+func (g *GinServer) postRestoreHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/postRestoreHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		err := g.Trash.RestoreFile(c.Request.Context(), currentBucket(c).Name, fileHash(c))
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			String(c, http.StatusNotFound, "")
+			return
+		}
+		if perr := storedQuotaError(err); perr != nil {
+			JSON(c, perr.Status, perr)
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db restore file", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		String(c, http.StatusOK, "OK")
+	}
+}
+
+// DELETE handler to permanently remove a file that is already in the trash
+func (g *GinServer) deleteTrashHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/deleteTrashHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		err := g.Trash.PurgeFile(c.Request.Context(), currentBucket(c).Name, fileHash(c))
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			String(c, http.StatusNotFound, "")
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db purge file", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		String(c, http.StatusOK, "OK")
+	}
+}
+
+// Permanently removes the files past the trash retention until the server shuts down
+func (g *GinServer) runTrashPurge(ctx context.Context) {
+	ticker := time.NewTicker(g.Config.Trash.TrashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n, err := g.Trash.PurgeExpired(ctx)
+			if err != nil {
+				g.Sugar.Errorw("db purge trash", "err", err)
+			} else if n > 0 {
+				g.Sugar.Infow("purged trashed files", "count", n)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	"go-cdn/pkg/model"
+	"go-cdn/pkg/utils"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Resumable uploads implementing the tus protocol, https://tus.io/protocols/resumable-upload
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+	tusPath       = "/uploads/"
+)
+
+// How many random hashes are drawn before giving up on finding a free one
+const hashAttempts = 3
+
+// Checks the protocol version and sets the headers common to every tus response
+func (g *GinServer) tusMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", tusVersion)
+		c.Header("Cache-Control", "no-store")
+
+		if c.Request.Method != http.MethodOptions && c.GetHeader("Tus-Resumable") != tusVersion {
+			c.Header("Tus-Version", tusVersion)
+			c.AbortWithStatus(http.StatusPreconditionFailed)
+			return
+		}
+		c.Next()
+	}
+}
+
+// OPTIONS handler advertising the server capabilities
+func (g *GinServer) optionsUploadHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Version", tusVersion)
+		c.Header("Tus-Extension", tusExtensions)
+		c.Header("Tus-Max-Size", strconv.FormatInt(g.Config.Tus.TusMaxSize, 10))
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// POST handler to create a new upload, data is sent afterwards via PATCH
+func (g *GinServer) postUploadHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/postUploadHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+		if err != nil || length < 0 {
+			String(c, http.StatusBadRequest, "invalid Upload-Length")
+			return
+		}
+		if length > g.Config.Tus.TusMaxSize {
+			JSON(c, http.StatusRequestEntityTooLarge, errTooLarge(g.Config.Tus.TusMaxSize))
+			return
+		}
+
+		raw_metadata := c.GetHeader("Upload-Metadata")
+		metadata, err := parseUploadMetadata(raw_metadata)
+		if err != nil {
+			String(c, http.StatusBadRequest, "invalid Upload-Metadata")
+			return
+		}
+
+		// The bucket is part of the metadata, as the tus routes are shared by all buckets
+		bucket_name := metadata["bucket"]
+		if bucket_name == "" {
+			bucket_name = model.DefaultBucket
+		}
+		bucket, err := g.bucket(c.Request.Context(), bucket_name)
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			String(c, http.StatusNotFound, "unknown bucket")
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db get bucket", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+		if !bucketAllowed(c, bucket.Name) {
+			forbidBucket(c)
+			return
+		}
+
+		// The size was checked against tus.max_size, upload.max_size only applies to the single requests
+		filename := sanitizeFilename(metadata["filename"])
+		if perr := g.validateFilename(filename); perr != nil {
+			JSON(c, perr.Status, perr)
+			return
+		}
+		if length == 0 && !g.Config.Upload.UploadAllowEmpty {
+			perr := errEmptyFile()
+			JSON(c, perr.Status, perr)
+			return
+		}
+		if !g.enforceQuota(c, bucket, length, 1) {
+			return
+		}
+
+		upload_id, _ := uuid.NewRandom()
+		upload := &model.Upload{
+			ID:         upload_id.String(),
+			Bucket:     bucket.Name,
+			Length:     length,
+			Filename:   filename,
+			Metadata:   raw_metadata,
+			UploadedBy: subject(c),
+			Private:    parseBool(metadata["private"]),
+			ExpiresAt:  time.Now().Add(g.Config.Tus.TusExpiration),
+		}
+		span.SetAttributes(attribute.String("tus.upload_id", upload.ID))
+
+		if err := g.Uploads.CreateUpload(c.Request.Context(), upload); err != nil {
+			g.requestLogger(c).Errorw("db create upload", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		c.Header("Location", tusPath+upload.ID)
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+		c.Status(http.StatusCreated)
+	}
+}
+
+// HEAD handler returning how many bytes were received so far
+func (g *GinServer) headUploadHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/headUploadHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		upload, err := g.Uploads.GetUpload(c.Request.Context(), c.Param("id"))
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db get upload", "err", err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		if !bucketAllowed(c, upload.Bucket) {
+			c.Status(http.StatusForbidden)
+			return
+		}
+
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+		if upload.Metadata != "" {
+			c.Header("Upload-Metadata", upload.Metadata)
+		}
+		c.Status(http.StatusOK)
+	}
+}
+
+// PATCH handler appending a chunk at Upload-Offset. The last chunk turns the upload into a stored file,
+// whose hash is returned in the X-Content-Hash header
+func (g *GinServer) patchUploadHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/patchUploadHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		upload_id := c.Param("id")
+		span.SetAttributes(attribute.String("tus.upload_id", upload_id))
+
+		if c.ContentType() != "application/offset+octet-stream" {
+			String(c, http.StatusUnsupportedMediaType, "")
+			return
+		}
+
+		offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			String(c, http.StatusBadRequest, "invalid Upload-Offset")
+			return
+		}
+
+		upload, err := g.Uploads.GetUpload(c.Request.Context(), upload_id)
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			String(c, http.StatusNotFound, "")
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db get upload", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+		if !bucketAllowed(c, upload.Bucket) {
+			forbidBucket(c)
+			return
+		}
+		if upload.Offset != offset {
+			String(c, http.StatusConflict, "")
+			return
+		}
+
+		// Keeps whatever was received before an interrupted connection, so that the client can resume from there
+		limit := upload.Length - offset
+		if limit > g.Config.Tus.TusMaxChunkSize {
+			limit = g.Config.Tus.TusMaxChunkSize
+		}
+		chunk, read_err := io.ReadAll(io.LimitReader(c.Request.Body, limit))
+		if read_err != nil {
+			g.requestLogger(c).Warnw("tus chunk interrupted", "upload_id", upload_id, "received", len(chunk), "err", read_err)
+		}
+
+		new_offset := offset
+		if len(chunk) > 0 {
+			new_offset, err = g.Uploads.AppendChunk(c.Request.Context(), upload_id, offset, chunk)
+			switch {
+			case errors.Is(err, repository.ErrOffsetMismatch):
+				String(c, http.StatusConflict, "")
+				return
+			case errors.Is(err, repository.ErrKeyDoesNotExist):
+				String(c, http.StatusNotFound, "")
+				return
+			case err != nil:
+				g.requestLogger(c).Errorw("db append chunk", "err", err)
+				String(c, http.StatusInternalServerError, "error")
+				return
+			}
+		}
+		if read_err != nil {
+			return
+		}
+
+		if new_offset == upload.Length {
+			if !g.checkCompletedUpload(c, upload) {
+				return
+			}
+
+			hash, err := g.finalizeUpload(c.Request.Context(), upload_id)
+			if errors.Is(err, repository.ErrKeyExists) {
+				// The upload is kept, resending the last offset finalizes it again
+				g.requestLogger(c).Warnw("no free hash to finalize the upload", "upload_id", upload_id)
+				String(c, http.StatusServiceUnavailable, "retry later")
+				return
+			}
+			if perr := storedQuotaError(err); perr != nil {
+				g.discardUpload(c, upload_id)
+				JSON(c, perr.Status, perr)
+				return
+			}
+			if err != nil {
+				g.requestLogger(c).Errorw("db finalize upload", "err", err)
+				String(c, http.StatusInternalServerError, "error")
+				return
+			}
+			g.requestLogger(c).Infow("upload completed", "upload_id", upload_id, "bucket", upload.Bucket, "hash", hash, "length", upload.Length)
+			c.Header("X-Content-Hash", hash)
+		}
+
+		c.Header("Upload-Offset", strconv.FormatInt(new_offset, 10))
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// Sniffs the type of the received content before it's stored, as for the other uploads, and checks the
+// quotas again as they may have been used up since the upload was created. Rejected uploads are discarded
+func (g *GinServer) checkCompletedUpload(c *gin.Context, upload *model.Upload) bool {
+	bucket, err := g.bucket(c.Request.Context(), upload.Bucket)
+	if err != nil {
+		g.requestLogger(c).Errorw("db get bucket", "err", err)
+		String(c, http.StatusInternalServerError, "error")
+		return false
+	}
+	head, err := g.Uploads.ReadUploadHead(c.Request.Context(), upload.ID, sniffLength)
+	if err != nil {
+		g.requestLogger(c).Errorw("db read upload head", "err", err)
+		String(c, http.StatusInternalServerError, "error")
+		return false
+	}
+
+	_, perr := g.validateType(bucket, head)
+	var warnings []string
+	if perr == nil {
+		warnings, perr, err = g.checkQuota(c, bucket, upload.Length, 1)
+		if err != nil {
+			g.requestLogger(c).Errorw("db get usage", "bucket", bucket.Name, "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return false
+		}
+	}
+	if perr != nil {
+		g.discardUpload(c, upload.ID)
+		JSON(c, perr.Status, perr)
+		return false
+	}
+	g.warnQuota(c, warnings)
+	return true
+}
+
+func (g *GinServer) discardUpload(c *gin.Context, upload_id string) {
+	if err := g.Uploads.RemoveUpload(c.Request.Context(), upload_id); err != nil {
+		g.requestLogger(c).Errorw("db remove upload", "err", err)
+	}
+}
+
+// Stores the upload under a new random hash, drawing another one when it's already taken
+func (g *GinServer) finalizeUpload(ctx context.Context, upload_id string) (string, error) {
+	for attempt := 1; ; attempt++ {
+		hash := utils.RandStringBytes(6)
+		err := g.Uploads.FinalizeUpload(ctx, upload_id, hash)
+		if !errors.Is(err, repository.ErrKeyExists) || attempt == hashAttempts {
+			return hash, err
+		}
+	}
+}
+
+// DELETE handler to abort an upload, discarding the received chunks
+func (g *GinServer) deleteUploadHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/deleteUploadHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		// Uploads can only be aborted from the bucket they were created for
+		if p := principal(c); p != nil && p.Bucket != "" {
+			upload, err := g.Uploads.GetUpload(c.Request.Context(), c.Param("id"))
+			if err == nil && upload.Bucket != p.Bucket {
+				forbidBucket(c)
+				return
+			}
+		}
+
+		if err := g.Uploads.RemoveUpload(c.Request.Context(), c.Param("id")); err != nil {
+			g.requestLogger(c).Errorw("db remove upload", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// Removes expired uploads until the server shuts down
+func (g *GinServer) runUploadExpiration(ctx context.Context) {
+	ticker := time.NewTicker(g.Config.Tus.TusCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n, err := g.Uploads.RemoveExpiredUploads(ctx)
+			if err != nil {
+				g.Sugar.Errorw("db remove expired uploads", "err", err)
+			} else if n > 0 {
+				g.Sugar.Infow("removed expired uploads", "count", n)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Parses the Upload-Metadata header: comma separated pairs of key and base64 encoded value
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			metadata[fields[0]] = string(value)
+		default:
+			return nil, errors.New("malformed metadata pair")
+		}
+	}
+	return metadata, nil
+}
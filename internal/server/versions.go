@@ -0,0 +1,181 @@
+package server
+
+import (
+	"errors"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/tracing"
+	"go-cdn/pkg/model"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// PUT handler to replace the content of an image, keeping its hash. The previous content stays available
+// as an older version and the cached copy is invalidated
+func (g *GinServer) putFileHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/putFileHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		// Setup error propagation
+		err_ch := c.MustGet("err_ch").(chan error)
+		wg := c.MustGet("wg").(*sync.WaitGroup)
+		bucket := currentBucket(c)
+		hash := fileHash(c)
+
+		if max := g.maxBodySize(); max > 0 {
+			if c.Request.ContentLength > max {
+				JSON(c, http.StatusRequestEntityTooLarge, errTooLarge(g.Config.Upload.UploadMaxSize))
+				return
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+		}
+
+		file, err := c.FormFile("file")
+		if err != nil {
+			var max_err *http.MaxBytesError
+			if errors.As(err, &max_err) {
+				JSON(c, http.StatusRequestEntityTooLarge, errTooLarge(g.Config.Upload.UploadMaxSize))
+				return
+			}
+			g.requestLogger(c).Errorw("FormFile", "err", err)
+			String(c, http.StatusBadRequest, "")
+			return
+		}
+
+		filename, bytes, err := g.readUpload(bucket, file, c.PostForm("filename"))
+		var perr *policyError
+		if errors.As(err, &perr) {
+			JSON(c, perr.Status, perr)
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("read upload", "err", err)
+			String(c, http.StatusBadRequest, "")
+			return
+		}
+
+		versions, err := g.Versions.GetFileVersions(c.Request.Context(), bucket.Name, hash)
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			String(c, http.StatusNotFound, "")
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db get file versions", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		// Only the current content is accounted, so the quotas are checked against the growth of the file.
+		// Taken over from someone else, the file counts as a whole for the caller
+		size := int64(len(bytes))
+		if current := versions[0]; current.UploadedBy == subject(c) {
+			size -= current.Size
+		}
+		if !g.enforceQuota(c, bucket, size, 0) {
+			return
+		}
+
+		version, err := g.Versions.ReplaceFile(c.Request.Context(), &model.StoredFile{
+			Bucket:     bucket.Name,
+			IDHash:     hash,
+			Filename:   filename,
+			Content:    bytes,
+			UploadedBy: subject(c),
+		})
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			String(c, http.StatusNotFound, "")
+			return
+		}
+		if perr := storedQuotaError(err); perr != nil {
+			JSON(c, perr.Status, perr)
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db replace file", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+		span.SetAttributes(attribute.Int("file.version", version))
+
+		// Purged after the update. The purge also keeps a concurrent GET that read the old content from
+		// caching it again
+		if g.Config.Cache.RedisEnable {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := g.Cache.RemoveFile(c.Request.Context(), bucket.Name, hash)
+				err_ch <- err
+			}()
+		}
+
+		g.requestLogger(c).Infow("replaced an image", "hash", hash, "filename", filename, "version", version)
+		JSON(c, http.StatusOK, gin.H{
+			"hash":    hash,
+			"version": version,
+		})
+	}
+}
+
+var errSignedVersion = errors.New("signed urls only grant access to the current version")
+
+// Serves a specific version of a file, requested via ?version=. Older versions are never cached, and private
+// ones need credentials
+func (g *GinServer) serveFileVersion(c *gin.Context, bucket string, hash string, raw_version string) {
+	version, err := strconv.Atoi(raw_version)
+	if err != nil || version < 1 {
+		String(c, http.StatusBadRequest, "invalid version")
+		return
+	}
+
+	stored_file, err := g.Versions.GetFileVersion(c.Request.Context(), bucket, hash, version)
+	if errors.Is(err, repository.ErrKeyDoesNotExist) {
+		String(c, http.StatusNotFound, "")
+		return
+	}
+	if err != nil {
+		g.requestLogger(c).Errorw("db get file version", "err", err)
+		String(c, http.StatusInternalServerError, "error")
+		return
+	}
+	if stored_file.Private && !g.canReadPrivate(c, false) {
+		forbidPrivate(c)
+		return
+	}
+
+	Data(c, http.StatusOK, "image", stored_file.Content)
+}
+
+// GET handler to list the versions of a file
+func (g *GinServer) getFileVersionsHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rq_ctx, span := tracing.Tracer.Start(c.Request.Context(), "gin/getFileVersionsHandler")
+		c.Request = c.Request.WithContext(rq_ctx)
+		defer span.End()
+
+		bucket := currentBucket(c)
+		if bucket.Private && !g.canReadPrivate(c, false) {
+			forbidPrivate(c)
+			return
+		}
+
+		versions, err := g.Versions.GetFileVersions(c.Request.Context(), bucket.Name, fileHash(c))
+		if errors.Is(err, repository.ErrKeyDoesNotExist) {
+			String(c, http.StatusNotFound, "")
+			return
+		}
+		if err != nil {
+			g.requestLogger(c).Errorw("db get file versions", "err", err)
+			String(c, http.StatusInternalServerError, "error")
+			return
+		}
+
+		JSON(c, http.StatusOK, gin.H{
+			"versions": versions,
+		})
+	}
+}
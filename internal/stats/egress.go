@@ -0,0 +1,106 @@
+package stats
+
+import (
+	"context"
+	"go-cdn/internal/database/controller"
+	"go-cdn/pkg/model"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EgressCounter accumulates the bytes served per file and period. Counts are flushed to the buffer shared
+// by all the instances, then moved from it to the database rollup. Without a buffer they are written to
+// the rollup directly.
+type EgressCounter struct {
+	rollup *database.EgressController
+	buffer *database.EgressBuffer
+	period time.Duration
+	sugar  *zap.SugaredLogger
+	mu     sync.Mutex
+	counts map[model.EgressKey]model.EgressCount
+}
+
+func NewEgressCounter(rollup *database.EgressController, buffer *database.EgressBuffer, period time.Duration, sugar *zap.SugaredLogger) *EgressCounter {
+	return &EgressCounter{
+		rollup: rollup,
+		buffer: buffer,
+		period: period,
+		sugar:  sugar,
+		counts: map[model.EgressKey]model.EgressCount{},
+	}
+}
+
+func (e *EgressCounter) Record(bucket string, id_hash string, bytes int64) {
+	key := model.EgressKey{Bucket: bucket, Hash: id_hash, Period: time.Now().UTC().Truncate(e.period)}
+
+	e.mu.Lock()
+	count := e.counts[key]
+	count.Bytes += bytes
+	count.Requests++
+	e.counts[key] = count
+	e.mu.Unlock()
+}
+
+// Flush writes the pending counts and rolls up the buffer. On failure the counts are merged back to be
+// retried on the next flush.
+func (e *EgressCounter) Flush(ctx context.Context) error {
+	e.mu.Lock()
+	pending := e.counts
+	e.counts = map[model.EgressKey]model.EgressCount{}
+	e.mu.Unlock()
+
+	if len(pending) > 0 {
+		var err error
+		if e.buffer != nil {
+			err = e.buffer.AddEgress(ctx, pending)
+		} else {
+			err = e.rollup.RecordEgress(ctx, pending)
+		}
+		if err != nil {
+			e.merge(pending)
+			return err
+		}
+	}
+
+	if e.buffer == nil {
+		return nil
+	}
+	taken, err := e.buffer.TakeEgress(ctx)
+	if len(taken) > 0 {
+		if err := e.rollup.RecordEgress(ctx, taken); err != nil {
+			e.merge(taken)
+			return err
+		}
+	}
+	return err
+}
+
+func (e *EgressCounter) merge(counts map[model.EgressKey]model.EgressCount) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, count := range counts {
+		c := e.counts[key]
+		c.Bytes += count.Bytes
+		c.Requests += count.Requests
+		e.counts[key] = c
+	}
+}
+
+// Run flushes every interval until ctx is done. Pending counts should then be written with a last Flush.
+func (e *EgressCounter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := e.Flush(ctx); err != nil {
+				e.sugar.Errorw("egress flush", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
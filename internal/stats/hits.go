@@ -0,0 +1,73 @@
+package stats
+
+import (
+	"context"
+	"go-cdn/internal/database/controller"
+	"go-cdn/pkg/model"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// HitCounter accumulates file accesses in memory and periodically flushes them to the database,
+// so that serving a file from the cache doesn't cost a write on Postgres.
+type HitCounter struct {
+	stats *database.StatsController
+	sugar *zap.SugaredLogger
+	mu    sync.Mutex
+	hits  map[model.FileRef]int64
+}
+
+func NewHitCounter(stats *database.StatsController, sugar *zap.SugaredLogger) *HitCounter {
+	return &HitCounter{
+		stats: stats,
+		sugar: sugar,
+		hits:  map[model.FileRef]int64{},
+	}
+}
+
+func (h *HitCounter) Record(bucket string, id_hash string) {
+	h.mu.Lock()
+	h.hits[model.FileRef{Bucket: bucket, Hash: id_hash}]++
+	h.mu.Unlock()
+}
+
+// Flush writes the pending counts. On failure they are merged back to be retried on the next flush.
+func (h *HitCounter) Flush(ctx context.Context) error {
+	h.mu.Lock()
+	pending := h.hits
+	h.hits = map[model.FileRef]int64{}
+	h.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := h.stats.RecordHits(ctx, pending)
+	if err != nil {
+		h.mu.Lock()
+		for ref, count := range pending {
+			h.hits[ref] += count
+		}
+		h.mu.Unlock()
+	}
+	return err
+}
+
+// Run flushes every interval until ctx is done. Pending hits should then be written with a last Flush.
+func (h *HitCounter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := h.Flush(ctx); err != nil {
+				h.sugar.Errorw("hits flush", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
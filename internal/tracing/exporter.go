@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"go-cdn/internal/config"
+	"os"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"google.golang.org/grpc/credentials"
+)
+
+// TLS towards the collector, trusting the CA of ca_file on top of the system ones
+func collectorTLS(tcfg config.Telemetry) (*tls.Config, error) {
+	if tcfg.CAFile == "" {
+		return &tls.Config{MinVersion: tls.VersionTLS12}, nil
+	}
+
+	pem, err := os.ReadFile(tcfg.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading the collector CA: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", tcfg.CAFile)
+	}
+	return &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pool}, nil
+}
+
+// Creates the trace exporter for the configured protocol, http unless grpc is asked for
+func newTraceExporter(ctx context.Context, address string, tcfg config.Telemetry) (*otlptrace.Exporter, error) {
+	var tls_cfg *tls.Config
+	if !tcfg.Insecure {
+		var err error
+		if tls_cfg, err = collectorTLS(tcfg); err != nil {
+			return nil, err
+		}
+	}
+
+	switch tcfg.Protocol {
+	case "grpc":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(address), otlptracegrpc.WithHeaders(tcfg.Headers)}
+		if tls_cfg == nil {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		} else {
+			opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tls_cfg)))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case "", "http":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(address), otlptracehttp.WithHeaders(tcfg.Headers)}
+		if tls_cfg == nil {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		} else {
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(tls_cfg))
+		}
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown telemetry protocol %q", tcfg.Protocol)
+	}
+}
+
+// Creates the metric exporter for the configured protocol, towards the same collector as the traces
+func newMetricExporter(ctx context.Context, address string, tcfg config.Telemetry) (sdkmetric.Exporter, error) {
+	var tls_cfg *tls.Config
+	if !tcfg.Insecure {
+		var err error
+		if tls_cfg, err = collectorTLS(tcfg); err != nil {
+			return nil, err
+		}
+	}
+
+	switch tcfg.Protocol {
+	case "grpc":
+		opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(address), otlpmetricgrpc.WithHeaders(tcfg.Headers)}
+		if tls_cfg == nil {
+			opts = append(opts, otlpmetricgrpc.WithInsecure())
+		} else {
+			opts = append(opts, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(tls_cfg)))
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	case "", "http":
+		opts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(address), otlpmetrichttp.WithHeaders(tcfg.Headers)}
+		if tls_cfg == nil {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		} else {
+			opts = append(opts, otlpmetrichttp.WithTLSClientConfig(tls_cfg))
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown telemetry protocol %q", tcfg.Protocol)
+	}
+}
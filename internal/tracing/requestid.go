@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// RequestIDHeader carries the id correlating a request across the load balancer, the instances and the clients
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDBaggage is the baggage member forwarding the request id along with the trace context
+const RequestIDBaggage = "request.id"
+
+// Ids are echoed back and written to the logs, so only short printable ones are accepted
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:+/=-]{1,128}$`)
+
+type requestIDKey struct{}
+
+func init() {
+	// Reads and writes traceparent, tracestate and baggage, used by otelgin and by Transport
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// ValidRequestID reports whether an id received from a client can be kept
+func ValidRequestID(id string) bool {
+	return requestIDPattern.MatchString(id)
+}
+
+// WithRequestID stores the id in the context and in its baggage
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+	if member, err := baggage.NewMember(RequestIDBaggage, id); err == nil {
+		if bag, err := baggage.FromContext(ctx).SetMember(member); err == nil {
+			ctx = baggage.ContextWithBaggage(ctx, bag)
+		}
+	}
+	return ctx
+}
+
+// RequestID retrieves the id of the request being served, empty when there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// Transport forwards the request id and the trace context on the outbound calls. Only meant for the
+// services we trust, they could be used to correlate the requests otherwise
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// RoundTrippers must not modify the request
+	req = req.Clone(req.Context())
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	if id := RequestID(req.Context()); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	return base.RoundTrip(req)
+}
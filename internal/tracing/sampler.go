@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"fmt"
+	"go-cdn/internal/config"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Samples the spans by the route they serve, the others at the default ratio
+type routeSampler struct {
+	rules    map[string]sdktrace.Sampler
+	fallback sdktrace.Sampler
+}
+
+func (s routeSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	// otelgin names the server spans after the route, and sets it as attribute
+	route := p.Name
+	for _, attr := range p.Attributes {
+		if attr.Key == semconv.HTTPRouteKey {
+			route = attr.Value.AsString()
+		}
+	}
+	if sampler, ok := s.rules[route]; ok {
+		return sampler.ShouldSample(p)
+	}
+	return s.fallback.ShouldSample(p)
+}
+
+func (s routeSampler) Description() string {
+	return fmt.Sprintf("RouteSampler{rules:%d,fallback:%s}", len(s.rules), s.fallback.Description())
+}
+
+// Records the spans that won't be sampled instead of dropping them, so that the hint processor can still
+// export the ones that turn out to fail or to be slow
+type recordingSampler struct {
+	sdktrace.Sampler
+}
+
+func (s recordingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	res := s.Sampler.ShouldSample(p)
+	if res.Decision == sdktrace.Drop {
+		res.Decision = sdktrace.RecordOnly
+	}
+	return res
+}
+
+// NewSampler samples the root spans by route, and follows the decision of the parent if parent_based is set
+func NewSampler(cfg *config.Config) sdktrace.Sampler {
+	tcfg := cfg.Telemetry
+	root := routeSampler{
+		rules:    map[string]sdktrace.Sampler{},
+		fallback: sdktrace.TraceIDRatioBased(tcfg.Sampling),
+	}
+	for _, rule := range tcfg.SamplingRules {
+		root.rules[rule.Route] = sdktrace.TraceIDRatioBased(rule.Ratio)
+	}
+
+	var sampler sdktrace.Sampler = root
+	if tcfg.SamplingParent {
+		sampler = sdktrace.ParentBased(root)
+	}
+	if tcfg.SamplingErrors || tcfg.SamplingSlow > 0 {
+		sampler = recordingSampler{sampler}
+	}
+	return sampler
+}
+
+// Marks a span as sampled, the batcher drops the others
+type sampledSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (s sampledSpan) SpanContext() trace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
+
+// Exports the spans left out by the sampler when they failed or took too long, a tail-style hint that
+// only needs the spans recorded by recordingSampler
+type hintProcessor struct {
+	sdktrace.SpanProcessor
+	errors bool
+	slow   time.Duration
+}
+
+// NewHintProcessor wraps next so that it also receives the failed and the slow spans that weren't sampled
+func NewHintProcessor(next sdktrace.SpanProcessor, cfg *config.Config) sdktrace.SpanProcessor {
+	tcfg := cfg.Telemetry
+	if !tcfg.SamplingErrors && tcfg.SamplingSlow <= 0 {
+		return next
+	}
+	return hintProcessor{SpanProcessor: next, errors: tcfg.SamplingErrors, slow: tcfg.SamplingSlow}
+}
+
+func (p hintProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if !s.SpanContext().IsSampled() && p.hinted(s) {
+		s = sampledSpan{s}
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+func (p hintProcessor) hinted(s sdktrace.ReadOnlySpan) bool {
+	if p.errors && s.Status().Code == codes.Error {
+		return true
+	}
+	return p.slow > 0 && s.EndTime().Sub(s.StartTime()) >= p.slow
+}
@@ -7,7 +7,8 @@ import (
 	"go-cdn/internal/discovery/controller"
 
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
@@ -30,6 +31,13 @@ var Tracer = otel.GetTracerProvider().Tracer(
 	trace.WithSchemaURL(semconv.SchemaURL),
 )
 
+// Retrieves the global Meter Provider, the instruments start exporting once the pipeline is installed
+var Meter = otel.GetMeterProvider().Meter(
+	instrumentationName,
+	metric.WithInstrumentationVersion(instrumentationVersion),
+	metric.WithSchemaURL(semconv.SchemaURL),
+)
+
 func newResource() *resource.Resource {
 	return resource.NewWithAttributes(
 		semconv.SchemaURL,
@@ -38,27 +46,50 @@ func newResource() *resource.Resource {
 	)
 }
 
+// Installs the trace and the metric exporters, both sending to the same collector with the same resource
 func InstallExportPipeline(ctx context.Context, dc *discovery.Controller, cfg *config.Config) (func(context.Context) error, error) {
 	address, err := dc.DiscoverService(cfg.Telemetry.JaegerAddress)
 	if err != nil {
 		return nil, err
 	}
 
-	exporter, err := otlptracehttp.New(ctx,
-		otlptracehttp.WithInsecure(),
-		otlptracehttp.WithEndpoint(address))
-
+	exporter, err := newTraceExporter(ctx, address, cfg.Telemetry)
 	if err != nil {
 		return nil, fmt.Errorf("creating OTLP trace exporter: %w", err)
 	}
 
+	res := newResource()
 	tracerProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(newResource()),
-		sdktrace.WithSampler(sdktrace.TraceIDRatioBased(cfg.Telemetry.Sampling)),
+		sdktrace.WithSpanProcessor(NewHintProcessor(sdktrace.NewBatchSpanProcessor(exporter), cfg)),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(NewSampler(cfg)),
 	)
 
 	// Registers a tracer Provider globally.
 	otel.SetTracerProvider(tracerProvider)
-	return tracerProvider.Shutdown, nil
+
+	metricExporter, err := newMetricExporter(ctx, address, cfg.Telemetry)
+	if err != nil {
+		tracerProvider.Shutdown(ctx)
+		return nil, fmt.Errorf("creating OTLP metric exporter: %w", err)
+	}
+
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter,
+			sdkmetric.WithInterval(cfg.Telemetry.MetricsInterval))),
+		sdkmetric.WithResource(res),
+	)
+
+	// Registers a meter Provider globally, Meter delegates to it from now on
+	otel.SetMeterProvider(meterProvider)
+
+	return func(ctx context.Context) error {
+		// Flushes the pending metrics even if the traces fail to. An unreachable collector only loses the last
+		// ones, which is reported to the otel error handler rather than failing the shutdown
+		err := tracerProvider.Shutdown(ctx)
+		if merr := meterProvider.Shutdown(ctx); merr != nil {
+			otel.Handle(merr)
+		}
+		return err
+	}, nil
 }
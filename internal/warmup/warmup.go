@@ -0,0 +1,185 @@
+package warmup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-cdn/internal/database/controller"
+	"go-cdn/internal/tracing"
+	"go-cdn/pkg/model"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/ratelimit"
+	"go.uber.org/zap"
+)
+
+const (
+	StrategyPopular = "popular"
+	StrategyRecent  = "recent"
+)
+
+var ErrWarmupRunning = errors.New("a warm-up job is already running")
+var ErrUnknownStrategy = errors.New("unknown warm-up strategy")
+var ErrInvalidCount = fmt.Errorf("the count of files must be between 1 and %d", MaxCount)
+
+// Most files a job can load, the strategies query the database with it as limit
+const MaxCount = 10000
+
+// Request describes which files to load. An explicit list of hashes, looked up in Bucket, takes precedence
+// over the strategy, which picks files across all buckets.
+type Request struct {
+	Strategy string   `json:"strategy"`
+	Count    int      `json:"count"`
+	Bucket   string   `json:"bucket"` // Defaults to the default bucket
+	Hashes   []string `json:"hashes"`
+}
+
+type Progress struct {
+	Running    bool      `json:"running"`
+	Strategy   string    `json:"strategy"`
+	Total      int       `json:"total"`
+	Loaded     int       `json:"loaded"`
+	Failed     int       `json:"failed"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+// Warmer copies files from the database into the cache at a limited rate, one job at a time
+type Warmer struct {
+	db       *database.Controller
+	cache    *database.Controller
+	stats    *database.StatsController
+	sugar    *zap.SugaredLogger
+	rate     int
+	mu       sync.Mutex
+	progress Progress
+}
+
+func New(db *database.Controller, cache *database.Controller, stats *database.StatsController, rate int, sugar *zap.SugaredLogger) *Warmer {
+	return &Warmer{
+		db:    db,
+		cache: cache,
+		stats: stats,
+		sugar: sugar,
+		rate:  rate,
+	}
+}
+
+func (w *Warmer) Progress() Progress {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.progress
+}
+
+// Start resolves the hashes to load and runs the job in background. Returns ErrWarmupRunning if another job is in progress.
+func (w *Warmer) Start(ctx context.Context, req Request) error {
+	if len(req.Hashes) > MaxCount || (len(req.Hashes) == 0 && (req.Count <= 0 || req.Count > MaxCount)) {
+		return ErrInvalidCount
+	}
+
+	w.mu.Lock()
+	if w.progress.Running {
+		w.mu.Unlock()
+		return ErrWarmupRunning
+	}
+	w.progress = Progress{Running: true, Strategy: req.Strategy, StartedAt: time.Now()}
+	w.mu.Unlock()
+
+	refs, err := w.resolve(ctx, req)
+	if err != nil {
+		w.finish(err)
+		return err
+	}
+
+	w.mu.Lock()
+	w.progress.Total = len(refs)
+	w.mu.Unlock()
+
+	go w.run(ctx, refs)
+	return nil
+}
+
+func (w *Warmer) resolve(ctx context.Context, req Request) ([]model.FileRef, error) {
+	if len(req.Hashes) > 0 {
+		bucket := req.Bucket
+		if bucket == "" {
+			bucket = model.DefaultBucket
+		}
+		refs := []model.FileRef{}
+		for _, hash := range req.Hashes {
+			refs = append(refs, model.FileRef{Bucket: bucket, Hash: hash})
+		}
+		return refs, nil
+	}
+
+	switch req.Strategy {
+	case StrategyPopular:
+		return w.stats.GetPopularFiles(ctx, req.Count)
+	case StrategyRecent:
+		return w.stats.GetRecentFiles(ctx, req.Count)
+	}
+	return nil, fmt.Errorf("strategy=%s: %w", req.Strategy, ErrUnknownStrategy)
+}
+
+func (w *Warmer) run(ctx context.Context, refs []model.FileRef) {
+	ctx, span := tracing.Tracer.Start(ctx, "warmup/run")
+	span.SetAttributes(attribute.Int("warmup.total", len(refs)))
+	defer span.End()
+
+	var limit ratelimit.Limiter = ratelimit.NewUnlimited()
+	if w.rate > 0 {
+		limit = ratelimit.New(w.rate)
+	}
+
+	for _, ref := range refs {
+		if ctx.Err() != nil {
+			w.finish(ctx.Err())
+			return
+		}
+		limit.Take()
+
+		err := w.load(ctx, ref)
+
+		w.mu.Lock()
+		if err != nil {
+			w.progress.Failed++
+			w.progress.LastError = err.Error()
+		} else {
+			w.progress.Loaded++
+		}
+		w.mu.Unlock()
+
+		if err != nil {
+			w.sugar.Warnw("warmup load", "bucket", ref.Bucket, "hash", ref.Hash, "err", err)
+		}
+	}
+
+	p := w.finish(nil)
+	w.sugar.Infow("warmup done", "loaded", p.Loaded, "failed", p.Failed, "elapsed", p.FinishedAt.Sub(p.StartedAt))
+}
+
+func (w *Warmer) load(ctx context.Context, ref model.FileRef) error {
+	file, err := w.db.GetFile(ctx, ref.Bucket, ref.Hash)
+	if err != nil {
+		return err
+	}
+	if file.Private {
+		return nil // Cached files are served without checking the signature
+	}
+	return w.cache.AddFile(ctx, file)
+}
+
+func (w *Warmer) finish(err error) Progress {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.progress.Running = false
+	w.progress.FinishedAt = time.Now()
+	if err != nil {
+		w.progress.LastError = err.Error()
+	}
+	return w.progress
+}
@@ -0,0 +1,8 @@
+ALTER TABLE fs_entities
+    ADD COLUMN hits bigint NOT NULL DEFAULT 0,
+    ADD COLUMN last_access timestamp with time zone,
+    ADD COLUMN created_at timestamp with time zone NOT NULL DEFAULT now();
+
+CREATE INDEX idx_hits
+    ON fs_entities USING btree
+    (hits DESC);
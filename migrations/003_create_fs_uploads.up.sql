@@ -0,0 +1,26 @@
+CREATE TABLE fs_uploads
+(
+    id serial,
+    upload_id character varying NOT NULL,
+    length bigint NOT NULL,
+    upload_offset bigint NOT NULL DEFAULT 0,
+    filename character varying,
+    metadata character varying,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    expires_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE (upload_id)
+);
+
+CREATE TABLE fs_upload_chunks
+(
+    id serial,
+    upload_id character varying NOT NULL REFERENCES fs_uploads (upload_id) ON DELETE CASCADE,
+    chunk_offset bigint NOT NULL,
+    content bytea,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX idx_upload_chunks
+    ON fs_upload_chunks USING btree
+    (upload_id, chunk_offset ASC);
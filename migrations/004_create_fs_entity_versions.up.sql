@@ -0,0 +1,15 @@
+ALTER TABLE fs_entities
+    ADD COLUMN version integer NOT NULL DEFAULT 1,
+    ADD COLUMN updated_at timestamp with time zone;
+
+CREATE TABLE fs_entity_versions
+(
+    id serial,
+    entity_id integer NOT NULL REFERENCES fs_entities (id) ON DELETE CASCADE,
+    version integer NOT NULL,
+    filename character varying,
+    content bytea,
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (id),
+    UNIQUE (entity_id, version)
+);
@@ -0,0 +1,7 @@
+ALTER TABLE fs_entities
+    ADD COLUMN deleted_at timestamp with time zone;
+
+CREATE INDEX idx_deleted_at
+    ON fs_entities USING btree
+    (deleted_at)
+    WHERE deleted_at IS NOT NULL;
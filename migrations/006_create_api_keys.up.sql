@@ -0,0 +1,13 @@
+CREATE TABLE api_keys
+(
+    id serial,
+    key_id character varying NOT NULL,
+    key_hash character varying NOT NULL,
+    name character varying,
+    scopes text[] NOT NULL DEFAULT '{}',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    expires_at timestamp with time zone,
+    revoked_at timestamp with time zone,
+    PRIMARY KEY (id),
+    UNIQUE (key_id)
+);
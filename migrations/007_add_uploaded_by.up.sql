@@ -0,0 +1,8 @@
+ALTER TABLE fs_entities
+    ADD COLUMN uploaded_by text;
+
+ALTER TABLE fs_entity_versions
+    ADD COLUMN uploaded_by text;
+
+ALTER TABLE fs_uploads
+    ADD COLUMN uploaded_by text;
@@ -0,0 +1,5 @@
+ALTER TABLE fs_entities
+    ADD COLUMN private boolean NOT NULL DEFAULT false;
+
+ALTER TABLE fs_uploads
+    ADD COLUMN private boolean NOT NULL DEFAULT false;
@@ -0,0 +1,28 @@
+CREATE TABLE buckets
+(
+    name character varying NOT NULL,
+    private boolean NOT NULL DEFAULT false,
+    quota_bytes bigint NOT NULL DEFAULT 0,
+    allowed_types text[] NOT NULL DEFAULT '{}',
+    no_cache boolean NOT NULL DEFAULT false,
+    cache_control character varying NOT NULL DEFAULT '',
+    created_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (name)
+);
+
+INSERT INTO buckets (name) VALUES ('default');
+
+ALTER TABLE fs_entities
+    ADD COLUMN bucket character varying NOT NULL DEFAULT 'default' REFERENCES buckets (name);
+
+-- Hashes are unique within a bucket
+DROP INDEX idx_id_hash;
+CREATE UNIQUE INDEX idx_bucket_id_hash
+    ON fs_entities USING btree
+    (bucket, id_hash);
+
+ALTER TABLE fs_uploads
+    ADD COLUMN bucket character varying NOT NULL DEFAULT 'default' REFERENCES buckets (name);
+
+ALTER TABLE api_keys
+    ADD COLUMN bucket character varying REFERENCES buckets (name);
@@ -0,0 +1,26 @@
+-- Bytes and number of the current files of each owner: uploaders (e.g. key:<id>) and buckets (bucket:<name>)
+CREATE TABLE storage_usage
+(
+    owner character varying NOT NULL,
+    bytes bigint NOT NULL DEFAULT 0,
+    objects bigint NOT NULL DEFAULT 0,
+    updated_at timestamp with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (owner)
+);
+
+INSERT INTO storage_usage (owner, bytes, objects)
+SELECT 'bucket:' || bucket, SUM(octet_length(content)), COUNT(*) FROM fs_entities WHERE deleted_at IS NULL GROUP BY bucket;
+
+INSERT INTO storage_usage (owner, bytes, objects)
+SELECT uploaded_by, SUM(octet_length(content)), COUNT(*) FROM fs_entities WHERE deleted_at IS NULL AND uploaded_by IS NOT NULL GROUP BY uploaded_by;
+
+-- 0 means unlimited
+CREATE TABLE storage_quotas
+(
+    owner character varying NOT NULL,
+    soft_bytes bigint NOT NULL DEFAULT 0,
+    hard_bytes bigint NOT NULL DEFAULT 0,
+    soft_objects bigint NOT NULL DEFAULT 0,
+    hard_objects bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (owner)
+);
@@ -0,0 +1,14 @@
+-- Bytes served per file, aggregated over periods of egress.period
+CREATE TABLE egress_rollup
+(
+    bucket character varying NOT NULL,
+    id_hash character varying NOT NULL,
+    period timestamp with time zone NOT NULL,
+    bytes bigint NOT NULL DEFAULT 0,
+    requests bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, id_hash, period)
+);
+
+CREATE INDEX idx_egress_period
+    ON egress_rollup USING btree
+    (period);
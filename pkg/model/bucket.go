@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Files uploaded without naming a bucket, and served by the routes without one, belong to the default bucket
+const DefaultBucket = "default"
+
+// Bucket is a namespace of files with its own settings
+type Bucket struct {
+	Name         string    `json:"name"`
+	Private      bool      `json:"private"`       // All the files need a signed URL or credentials
+	QuotaBytes   int64     `json:"quota_bytes"`   // 0 means unlimited
+	AllowedTypes []string  `json:"allowed_types"` // Replaces upload.allowed_types if not empty
+	NoCache      bool      `json:"no_cache"`      // Files are never stored in Redis
+	CacheControl string    `json:"cache_control"` // Cache-Control header sent with the files
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// FileRef identifies a file across buckets
+type FileRef struct {
+	Bucket string `json:"bucket"`
+	Hash   string `json:"hash"`
+}
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type DatabaseType string
 
 const (
@@ -7,7 +9,30 @@ const (
 )
 
 type StoredFile struct {
-	IDHash   string `json:"id_hash"`
-	Filename string `json:"filename"`
-	Content  []byte `json:"content,omitempty"`
+	Bucket     string `json:"bucket,omitempty"`
+	IDHash     string `json:"id_hash"`
+	Filename   string `json:"filename"`
+	Content    []byte `json:"content,omitempty"`
+	Version    int    `json:"version,omitempty"`
+	UploadedBy string `json:"uploaded_by,omitempty"` // Subject of the authenticated uploader, if any
+	Private    bool   `json:"private,omitempty"`     // Only served through signed URLs
+}
+
+// FileVersion describes a revision of a stored file, without its content
+type FileVersion struct {
+	Version    int       `json:"version"`
+	Filename   string    `json:"filename"`
+	Size       int64     `json:"size"`
+	UploadedBy string    `json:"uploaded_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	Current    bool      `json:"current"`
+}
+
+// TrashedFile is a soft-deleted file, restorable until PurgeAt
+type TrashedFile struct {
+	Bucket    string    `json:"bucket"`
+	IDHash    string    `json:"id_hash"`
+	Filename  string    `json:"filename"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
 }
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// EgressKey identifies the traffic of a file during a period, the start of an aggregation interval
+type EgressKey struct {
+	Bucket string
+	Hash   string
+	Period time.Time
+}
+
+type EgressCount struct {
+	Bytes    int64 `json:"bytes"`
+	Requests int64 `json:"requests"`
+}
+
+// EgressFilter selects the traffic reported. Empty fields don't filter, GroupBy is one of bucket, file or period
+type EgressFilter struct {
+	From    time.Time
+	To      time.Time
+	Bucket  string
+	Hash    string
+	GroupBy string
+}
+
+// EgressReport is the traffic of a group, the fields not part of the grouping are left empty
+type EgressReport struct {
+	Bucket string     `json:"bucket,omitempty"`
+	Hash   string     `json:"hash,omitempty"`
+	Period *time.Time `json:"period,omitempty"`
+	EgressCount
+}
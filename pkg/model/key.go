@@ -0,0 +1,15 @@
+package model
+
+import "time"
+
+// APIKey is the stored part of an API key: the secret itself is only known by the client, Hash is its digest
+type APIKey struct {
+	KeyID     string     `json:"key_id"`
+	Name      string     `json:"name"`
+	Hash      string     `json:"-"`
+	Scopes    []string   `json:"scopes"`
+	Bucket    string     `json:"bucket,omitempty"` // Restricts the key to a single bucket, empty for all
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
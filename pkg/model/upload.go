@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// Upload is a resumable upload in progress, received in chunks until Offset reaches Length
+type Upload struct {
+	ID         string    `json:"id"`
+	Bucket     string    `json:"bucket"`
+	Length     int64     `json:"length"`
+	Offset     int64     `json:"offset"`
+	Filename   string    `json:"filename"`
+	Metadata   string    `json:"metadata"` // Raw Upload-Metadata header, returned as is
+	UploadedBy string    `json:"uploaded_by,omitempty"`
+	Private    bool      `json:"private,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// Usage is the storage taken by the current files of an owner, trashed files and older versions excluded
+type Usage struct {
+	Owner     string    `json:"owner"`
+	Bytes     int64     `json:"bytes"`
+	Objects   int64     `json:"objects"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Quota caps the usage of an owner. Exceeding a soft limit is only reported, 0 means unlimited
+type Quota struct {
+	Owner       string `json:"owner"`
+	SoftBytes   int64  `json:"soft_bytes"`
+	HardBytes   int64  `json:"hard_bytes"`
+	SoftObjects int64  `json:"soft_objects"`
+	HardObjects int64  `json:"hard_objects"`
+}
+
+// Files are accounted to the bucket they belong to, as BucketOwner, and to their uploader, by subject
+func BucketOwner(bucket string) string {
+	return "bucket:" + bucket
+}
@@ -0,0 +1,124 @@
+// Package signedurl mints and verifies HMAC-signed, expiring URLs. It has no dependency on the server,
+// so that applications can mint URLs themselves with a shared key
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query parameters carrying the signature
+const (
+	ParamExpires = "expires"
+	ParamKeyID   = "kid"
+	ParamIP      = "ip"
+	ParamSig     = "sig"
+)
+
+var ErrMissingSignature = errors.New("missing signature")
+var ErrMalformed = errors.New("malformed signature parameters")
+var ErrExpired = errors.New("signature expired")
+var ErrUnknownKey = errors.New("signed with an unknown key")
+var ErrInvalidSignature = errors.New("invalid signature")
+var ErrIPMismatch = errors.New("signature bound to another address")
+
+// Key is a shared secret, identified by ID so that keys can be rotated
+type Key struct {
+	ID     string
+	Secret string
+}
+
+// Signer signs with the active key and verifies with any key of the set. Rotating means adding a new key,
+// making it active and removing the previous one once the URLs it signed have expired
+type Signer struct {
+	keys   map[string][]byte
+	active string
+}
+
+func New(keys []Key, active string) (*Signer, error) {
+	s := &Signer{keys: map[string][]byte{}, active: active}
+	for _, k := range keys {
+		if k.ID == "" || k.Secret == "" {
+			return nil, errors.New("signing keys need an id and a secret")
+		}
+		s.keys[k.ID] = []byte(k.Secret)
+	}
+	if _, ok := s.keys[active]; !ok {
+		return nil, errors.New("the active signing key is not in the key set")
+	}
+	return s, nil
+}
+
+// Sign returns the query parameters granting access to path until expires. If ip is not empty the
+// signature is only valid for requests coming from that address
+func (s *Signer) Sign(path string, expires time.Time, ip string) url.Values {
+	return sign(s.active, s.keys[s.active], path, expires, ip)
+}
+
+// Verify checks the signature parameters in query for a request to path from client_ip
+func (s *Signer) Verify(path string, query url.Values, client_ip string, now time.Time) error {
+	sig := query.Get(ParamSig)
+	if sig == "" {
+		return ErrMissingSignature
+	}
+
+	expires, err := strconv.ParseInt(query.Get(ParamExpires), 10, 64)
+	if err != nil {
+		return ErrMalformed
+	}
+	if now.Unix() > expires {
+		return ErrExpired
+	}
+
+	secret, ok := s.keys[query.Get(ParamKeyID)]
+	if !ok {
+		return ErrUnknownKey
+	}
+
+	ip := query.Get(ParamIP)
+	expected := sign(query.Get(ParamKeyID), secret, path, time.Unix(expires, 0), ip).Get(ParamSig)
+	if !hmac.Equal([]byte(sig), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	if ip != "" && ip != client_ip {
+		return ErrIPMismatch
+	}
+	return nil
+}
+
+// SignURL adds the signature parameters to raw_url, keeping its existing query
+func SignURL(raw_url string, key Key, expires time.Time, ip string) (string, error) {
+	u, err := url.Parse(raw_url)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	for k, v := range sign(key.ID, []byte(key.Secret), u.EscapedPath(), expires, ip) {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+func sign(key_id string, secret []byte, path string, expires time.Time, ip string) url.Values {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{key_id, path, exp, ip}, "\n")))
+
+	values := url.Values{}
+	values.Set(ParamExpires, exp)
+	values.Set(ParamKeyID, key_id)
+	if ip != "" {
+		values.Set(ParamIP, ip)
+	}
+	values.Set(ParamSig, base64.RawURLEncoding.EncodeToString(mac.Sum(nil)))
+	return values
+}
@@ -0,0 +1,60 @@
+package config_test
+
+import (
+	"go-cdn/internal/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Loads content as configs.yaml, from a working directory of its own
+func loadConfig(t *testing.T, content string) *config.Config {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "configs.yaml"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	cfg, err := config.New()
+	assert.Nil(t, err)
+	return cfg
+}
+
+func TestIntervals(t *testing.T) {
+	cfg := loadConfig(t, `
+warmup:
+  stats_flush_interval: "-1s"
+`)
+	assert.Equal(t, 30*time.Second, cfg.Warmup.WarmupFlushInterval)
+
+	t.Run("TestTus", func(t *testing.T) {
+		cfg := loadConfig(t, `
+tus:
+  cleanup_interval: "0s"
+`)
+		assert.Equal(t, time.Hour, cfg.Tus.TusCleanupInterval)
+	})
+
+	t.Run("TestTrash", func(t *testing.T) {
+		cfg := loadConfig(t, `
+trash:
+  purge_interval: "0s"
+`)
+		assert.Equal(t, time.Hour, cfg.Trash.TrashPurgeInterval)
+	})
+
+	t.Run("TestEgress", func(t *testing.T) {
+		cfg := loadConfig(t, `
+egress:
+  flush_interval: "0s"
+`)
+		assert.Equal(t, 30*time.Second, cfg.Egress.EgressFlushInterval)
+	})
+}
@@ -107,6 +107,7 @@ func (suite *PostgresRepoTestSuite) TestAddFile() {
 
 	t.Run("TestAddFile", func(t *testing.T) {
 		test_file := &model.StoredFile{
+			Bucket:   model.DefaultBucket,
 			IDHash:   "0001",
 			Filename: "test",
 			Content:  []byte{00, 10, 20},
@@ -116,7 +117,7 @@ func (suite *PostgresRepoTestSuite) TestAddFile() {
 	})
 
 	t.Run("TestGetFile", func(t *testing.T) {
-		stored_test_file, err := suite.repository.GetFile(suite.ctx, "0001")
+		stored_test_file, err := suite.repository.GetFile(suite.ctx, model.DefaultBucket, "0001")
 		assert.Nil(t, err)
 		assert.Equal(t, "0001", stored_test_file.IDHash)
 		assert.Equal(t, "test", stored_test_file.Filename)
@@ -125,16 +126,44 @@ func (suite *PostgresRepoTestSuite) TestAddFile() {
 
 	// Fetch a nonexistent file
 	t.Run("TestGetFileNotFound", func(t *testing.T) {
-		_, err = suite.repository.GetFile(suite.ctx, "0002")
+		_, err = suite.repository.GetFile(suite.ctx, model.DefaultBucket, "0002")
 		assert.ErrorIs(t, err, repository.ErrKeyDoesNotExist)
 	})
 
 	t.Run("TestRemoveFile", func(t *testing.T) {
-		err = suite.repository.RemoveFile(suite.ctx, "0001")
+		err = suite.repository.RemoveFile(suite.ctx, model.DefaultBucket, "0001")
 		assert.Nil(t, err)
 	})
 }
 
+// Hard quotas are enforced when storing, along with the usage update
+func (suite *PostgresRepoTestSuite) TestHardQuota() {
+	t := suite.T()
+	owner := model.BucketOwner(model.DefaultBucket)
+	assert.Nil(t, suite.repository.SetQuota(suite.ctx, &model.Quota{Owner: owner, HardBytes: 4}))
+	defer suite.repository.RemoveQuota(suite.ctx, owner)
+
+	file := &model.StoredFile{Bucket: model.DefaultBucket, IDHash: "q001", Filename: "test", Content: []byte{1, 2, 3}}
+	assert.Nil(t, suite.repository.AddFile(suite.ctx, file))
+	defer suite.repository.RemoveFile(suite.ctx, model.DefaultBucket, "q001")
+
+	// Rejected as a whole, the usage is left untouched
+	err := suite.repository.AddFile(suite.ctx, &model.StoredFile{Bucket: model.DefaultBucket, IDHash: "q002", Filename: "test", Content: []byte{1, 2}})
+	assert.ErrorIs(t, err, repository.ErrQuotaExceeded)
+	usage, err := suite.repository.GetUsage(suite.ctx, owner)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), usage.Bytes)
+}
+
+// Cancellations reach the database instead of being dropped by the repository
+func (suite *PostgresRepoTestSuite) TestCanceledContext() {
+	ctx, cancel := context.WithCancel(suite.ctx)
+	cancel()
+
+	_, err := suite.repository.GetFile(ctx, model.DefaultBucket, "0001")
+	assert.ErrorIs(suite.T(), err, context.Canceled)
+}
+
 func TestPostgresRepoTestSuite(t *testing.T) {
 	suite.Run(t, new(PostgresRepoTestSuite))
 }
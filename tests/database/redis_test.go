@@ -7,10 +7,12 @@ import (
 	"go-cdn/internal/database/repository"
 	"go-cdn/internal/database/repository/redis"
 	discovery "go-cdn/internal/discovery/controller"
+	"go-cdn/internal/ratelimit"
 	"go-cdn/pkg/model"
 	"log"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
@@ -92,6 +94,7 @@ func (suite *RedisRepoTestSuite) TestAddFile() {
 
 	t.Run("TestAddFile", func(t *testing.T) {
 		test_file := &model.StoredFile{
+			Bucket:   model.DefaultBucket,
 			IDHash:   "0001",
 			Filename: "test",
 			Content:  []byte{00, 10, 20},
@@ -101,7 +104,7 @@ func (suite *RedisRepoTestSuite) TestAddFile() {
 	})
 
 	t.Run("TestGetFile", func(t *testing.T) {
-		stored_test_file, err := suite.repository.GetFile(suite.ctx, "0001")
+		stored_test_file, err := suite.repository.GetFile(suite.ctx, model.DefaultBucket, "0001")
 		assert.Nil(t, err)
 		assert.Equal(t, "0001", stored_test_file.IDHash)
 		// filename is not stored
@@ -110,16 +113,46 @@ func (suite *RedisRepoTestSuite) TestAddFile() {
 
 	// Fetch a nonexistent file
 	t.Run("TestGetFileNotFound", func(t *testing.T) {
-		_, err := suite.repository.GetFile(suite.ctx, "0002")
+		_, err := suite.repository.GetFile(suite.ctx, model.DefaultBucket, "0002")
 		assert.ErrorIs(t, err, repository.ErrKeyDoesNotExist)
 	})
 
 	t.Run("TestRemoveFile", func(t *testing.T) {
-		err = suite.repository.RemoveFile(suite.ctx, "0001")
+		err = suite.repository.RemoveFile(suite.ctx, model.DefaultBucket, "0001")
 		assert.Nil(t, err)
 	})
 }
 
+func (suite *RedisRepoTestSuite) TestRateLimit() {
+	t := suite.T()
+	rate := ratelimit.Rate{PerSecond: 1, Burst: 2}
+
+	res, err := suite.repository.Allow(suite.ctx, "test", rate)
+	assert.Nil(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+
+	res, _ = suite.repository.Allow(suite.ctx, "test", rate)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	res, _ = suite.repository.Allow(suite.ctx, "test", rate)
+	assert.False(t, res.Allowed)
+	assert.Greater(t, res.RetryAfter, time.Duration(0))
+
+	res, _ = suite.repository.Allow(suite.ctx, "other", rate)
+	assert.True(t, res.Allowed)
+}
+
+// Cancellations reach the database instead of being dropped by the repository
+func (suite *RedisRepoTestSuite) TestCanceledContext() {
+	ctx, cancel := context.WithCancel(suite.ctx)
+	cancel()
+
+	_, err := suite.repository.GetFile(ctx, model.DefaultBucket, "0001")
+	assert.ErrorIs(suite.T(), err, context.Canceled)
+}
+
 func TestRedisRepoTestSuite(t *testing.T) {
 	suite.Run(t, new(RedisRepoTestSuite))
 }
@@ -0,0 +1,77 @@
+package ratelimit_test
+
+import (
+	"context"
+	"go-cdn/internal/ratelimit"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	rate := ratelimit.Rate{PerSecond: 1, Burst: 2}
+
+	t.Run("TestBurst", func(t *testing.T) {
+		l := ratelimit.NewLocal(10)
+
+		res, _ := l.Allow(ctx, "a", rate)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 2, res.Limit)
+		assert.Equal(t, 1, res.Remaining)
+
+		res, _ = l.Allow(ctx, "a", rate)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 0, res.Remaining)
+
+		res, _ = l.Allow(ctx, "a", rate)
+		assert.False(t, res.Allowed)
+		assert.InDelta(t, time.Second, res.RetryAfter, float64(50*time.Millisecond))
+		assert.InDelta(t, 2*time.Second, res.Reset, float64(50*time.Millisecond))
+
+		// Clients don't share their budget
+		res, _ = l.Allow(ctx, "b", rate)
+		assert.True(t, res.Allowed)
+	})
+
+	t.Run("TestRefill", func(t *testing.T) {
+		l := ratelimit.NewLocal(10)
+		fast := ratelimit.Rate{PerSecond: 100, Burst: 1}
+
+		res, _ := l.Allow(ctx, "a", fast)
+		assert.True(t, res.Allowed)
+		res, _ = l.Allow(ctx, "a", fast)
+		assert.False(t, res.Allowed)
+
+		time.Sleep(20 * time.Millisecond)
+		res, _ = l.Allow(ctx, "a", fast)
+		assert.True(t, res.Allowed)
+	})
+
+	t.Run("TestNoBudget", func(t *testing.T) {
+		l := ratelimit.NewLocal(10)
+
+		for _, r := range []ratelimit.Rate{{PerSecond: 0, Burst: 2}, {PerSecond: 1, Burst: 0}, {PerSecond: -1, Burst: 2}} {
+			res, err := l.Allow(ctx, "a", r)
+			assert.Nil(t, err)
+			assert.False(t, res.Allowed)
+			assert.Zero(t, res.Remaining)
+		}
+	})
+
+	t.Run("TestEviction", func(t *testing.T) {
+		l := ratelimit.NewLocal(1)
+		single := ratelimit.Rate{PerSecond: 0.001, Burst: 1}
+
+		res, _ := l.Allow(ctx, "a", single)
+		assert.True(t, res.Allowed)
+		res, _ = l.Allow(ctx, "a", single)
+		assert.False(t, res.Allowed)
+
+		// b pushes a out, which starts again with a full budget
+		l.Allow(ctx, "b", single)
+		res, _ = l.Allow(ctx, "a", single)
+		assert.True(t, res.Allowed)
+	})
+}
@@ -0,0 +1,50 @@
+package ratelimit_test
+
+import (
+	"context"
+	"go-cdn/internal/ratelimit"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottle(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("TestBurst", func(t *testing.T) {
+		th := ratelimit.NewThrottle(1000, 100)
+
+		waited, err := th.Wait(ctx, 100)
+		assert.Nil(t, err)
+		assert.Zero(t, waited)
+
+		waited, _ = th.Wait(ctx, 50)
+		assert.InDelta(t, 50*time.Millisecond, waited, float64(10*time.Millisecond))
+		assert.Equal(t, waited, th.Waited())
+	})
+
+	t.Run("TestCancel", func(t *testing.T) {
+		th := ratelimit.NewThrottle(1, 1)
+		th.Wait(ctx, 1)
+
+		cancelled, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err := th.Wait(cancelled, 1)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("TestCancelRefund", func(t *testing.T) {
+		th := ratelimit.NewThrottle(1000, 100)
+		th.Wait(ctx, 100)
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := th.Wait(cancelled, 50)
+		assert.ErrorIs(t, err, context.Canceled)
+
+		// The cancelled bytes were given back, only the new ones are waited for
+		waited, _ := th.Wait(ctx, 10)
+		assert.InDelta(t, 10*time.Millisecond, waited, float64(8*time.Millisecond))
+	})
+}
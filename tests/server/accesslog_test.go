@@ -0,0 +1,81 @@
+package server_test
+
+import (
+	"go-cdn/internal/config"
+	"go-cdn/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newAccessLogRouter(t *testing.T, repo *memoryRepository, access_log config.AccessLog) (*gin.Engine, *observer.ObservedLogs) {
+	g := newServer(t, repo, func(cfg *config.Config) {
+		cfg.AccessLog = access_log
+		cfg.AccessLog.AccessLogEnable = true
+	})
+
+	core, logs := observer.New(zap.InfoLevel)
+	g.Sugar = zap.New(core).Sugar()
+	return g.Router(), logs
+}
+
+func accessEntries(logs *observer.ObservedLogs) []observer.LoggedEntry {
+	return logs.Filter(func(e observer.LoggedEntry) bool { return e.LoggerName == "access" }).All()
+}
+
+func TestAccessLog(t *testing.T) {
+	repo := newMemoryRepository()
+	repo.files["abcdef"] = &model.StoredFile{IDHash: "abcdef", Content: []byte("0123456789")}
+
+	t.Run("TestFields", func(t *testing.T) {
+		r, logs := newAccessLogRouter(t, repo, config.AccessLog{AccessLogSampleRate: 1})
+		authRequest(r, http.MethodGet, "/content/abcdef", "", nil)
+
+		entries := accessEntries(logs)
+		assert.Len(t, entries, 1)
+		fields := entries[0].ContextMap()
+		assert.Equal(t, "GET", fields["method"])
+		assert.Equal(t, "/content/abcdef", fields["path"])
+		assert.Equal(t, "/content/:bucket", fields["route"])
+		assert.Equal(t, int64(200), fields["status"])
+		assert.Equal(t, int64(10), fields["bytes"])
+		assert.Equal(t, "bypass", fields["cache"])
+		assert.NotEmpty(t, fields["request.id"])
+	})
+
+	t.Run("TestSelectedFields", func(t *testing.T) {
+		r, logs := newAccessLogRouter(t, repo, config.AccessLog{AccessLogSampleRate: 1, AccessLogFields: []string{"status", "path"}})
+		authRequest(r, http.MethodGet, "/content/abcdef", "", nil)
+		assert.Equal(t, map[string]any{"status": int64(200), "path": "/content/abcdef"}, accessEntries(logs)[0].ContextMap())
+	})
+
+	t.Run("TestSampling", func(t *testing.T) {
+		r, logs := newAccessLogRouter(t, repo, config.AccessLog{AccessLogSampleRate: 0, AccessLogSkipPaths: []string{"/livez"}})
+		authRequest(r, http.MethodGet, "/content/abcdef", "", nil)
+		authRequest(r, http.MethodGet, "/livez", "", nil)
+		assert.Empty(t, accessEntries(logs))
+
+		// Errors are always logged
+		authRequest(r, http.MethodGet, "/not/a/route", "", nil)
+		assert.Len(t, accessEntries(logs), 1)
+	})
+
+	t.Run("TestCombined", func(t *testing.T) {
+		r, logs := newAccessLogRouter(t, repo, config.AccessLog{AccessLogSampleRate: 1, AccessLogFormat: "combined"})
+		req := httptest.NewRequest(http.MethodGet, "/content/abcdef?v=1", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("User-Agent", "curl/8.0")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Regexp(t, `^192\.0\.2\.1 - - \[.+\] "GET /content/abcdef\?v=1 HTTP/1\.1" 200 10 "-" "curl/8\.0"$`, accessEntries(logs)[0].Message)
+
+		// The signature would grant access to the file
+		authRequest(r, http.MethodGet, "/content/abcdef?v=1&expires=1&kid=k1&sig=secret", "", nil)
+		assert.Contains(t, accessEntries(logs)[1].Message, `"GET /content/abcdef?v=1 HTTP/1.1"`)
+	})
+}
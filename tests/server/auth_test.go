@@ -0,0 +1,132 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-cdn/internal/auth"
+	"go-cdn/internal/config"
+	"go-cdn/internal/database/controller"
+	"go-cdn/internal/server"
+	"go-cdn/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminKey = "bootstrap-admin-key"
+
+// Enables the authentication with testAdminKey as bootstrap key
+func enableAuth(cfg *config.Config) {
+	cfg.Auth.AuthEnable = true
+	cfg.Auth.AuthAdminKey = testAdminKey
+}
+
+// API keys stored in repo, along with the bootstrap key
+func withAPIKeys(repo *memoryRepository) server.ServerOpt {
+	keys := database.NewKeyController(repo)
+	return server.WithAPIKeys(keys, auth.NewAPIKeyAuthenticator(keys, testAdminKey, time.Minute))
+}
+
+func newAuthRouter(t *testing.T, repo *memoryRepository, grace time.Duration) *gin.Engine {
+	return newRouter(t, repo, func(cfg *config.Config) {
+		enableAuth(cfg)
+		cfg.Auth.AuthRotationGrace = grace
+	}, withAPIKeys(repo))
+}
+
+func authRequest(r *gin.Engine, method string, path string, key string, payload any) *httptest.ResponseRecorder {
+	var body []byte
+	if payload != nil {
+		body, _ = json.Marshal(payload)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func createKey(t *testing.T, r *gin.Engine, scopes ...string) (string, string) {
+	w := authRequest(r, http.MethodPost, "/admin/keys", testAdminKey, map[string]any{"name": "test", "scopes": scopes})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var res map[string]any
+	json.Unmarshal(w.Body.Bytes(), &res)
+	return res["key_id"].(string), res["key"].(string)
+}
+
+func TestAPIKeys(t *testing.T) {
+	repo := newMemoryRepository()
+	repo.files["abcdef"] = &model.StoredFile{IDHash: "abcdef", Content: []byte("a")}
+	r := newAuthRouter(t, repo, time.Hour)
+
+	t.Run("TestPublicRead", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, authRequest(r, http.MethodGet, "/content/abcdef", "", nil).Code)
+	})
+
+	t.Run("TestMissingKey", func(t *testing.T) {
+		w := authRequest(r, http.MethodDelete, "/content/abcdef", "", nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+		assert.Equal(t, http.StatusUnauthorized, authRequest(r, http.MethodGet, "/admin/keys", "wrong.key", nil).Code)
+	})
+
+	t.Run("TestInvalidScopes", func(t *testing.T) {
+		w := authRequest(r, http.MethodPost, "/admin/keys", testAdminKey, map[string]any{"scopes": []string{"root"}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("TestScopes", func(t *testing.T) {
+		_, write_key := createKey(t, r, "write")
+		_, delete_key := createKey(t, r, "delete")
+
+		assert.Equal(t, http.StatusForbidden, authRequest(r, http.MethodDelete, "/content/abcdef", write_key, nil).Code)
+		assert.Equal(t, http.StatusForbidden, authRequest(r, http.MethodGet, "/admin/keys", delete_key, nil).Code)
+		assert.Equal(t, http.StatusOK, authRequest(r, http.MethodDelete, "/content/abcdef", delete_key, nil).Code)
+
+		// Tampered secret
+		assert.Equal(t, http.StatusUnauthorized, authRequest(r, http.MethodDelete, "/content/abcdef", delete_key+"x", nil).Code)
+	})
+
+	t.Run("TestRevoke", func(t *testing.T) {
+		key_id, key := createKey(t, r, "delete")
+		assert.Equal(t, http.StatusNotFound, authRequest(r, http.MethodDelete, "/content/zzzzzz", key, nil).Code)
+
+		assert.Equal(t, http.StatusOK, authRequest(r, http.MethodDelete, "/admin/keys/"+key_id, testAdminKey, nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, authRequest(r, http.MethodDelete, "/content/zzzzzz", key, nil).Code)
+		assert.Equal(t, http.StatusNotFound, authRequest(r, http.MethodDelete, "/admin/keys/"+key_id, testAdminKey, nil).Code)
+	})
+
+	t.Run("TestRotate", func(t *testing.T) {
+		key_id, old_key := createKey(t, r, "delete")
+
+		w := authRequest(r, http.MethodPost, "/admin/keys/"+key_id+"/rotate", testAdminKey, nil)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var res map[string]any
+		json.Unmarshal(w.Body.Bytes(), &res)
+		assert.NotEqual(t, key_id, res["key_id"])
+		assert.Equal(t, []any{"delete"}, res["scopes"])
+
+		// Both keys work during the grace period
+		assert.Equal(t, http.StatusNotFound, authRequest(r, http.MethodDelete, "/content/zzzzzz", old_key, nil).Code)
+		assert.Equal(t, http.StatusNotFound, authRequest(r, http.MethodDelete, "/content/zzzzzz", res["key"].(string), nil).Code)
+		assert.NotNil(t, repo.keys[key_id].ExpiresAt)
+	})
+
+	t.Run("TestRotateWithoutGrace", func(t *testing.T) {
+		r := newAuthRouter(t, repo, 0)
+		key_id, old_key := createKey(t, r, "delete")
+		assert.Equal(t, http.StatusCreated, authRequest(r, http.MethodPost, "/admin/keys/"+key_id+"/rotate", testAdminKey, nil).Code)
+		assert.Equal(t, http.StatusUnauthorized, authRequest(r, http.MethodDelete, "/content/zzzzzz", old_key, nil).Code)
+
+		// Expired, the old key can't be rotated again
+		assert.Equal(t, http.StatusGone, authRequest(r, http.MethodPost, "/admin/keys/"+key_id+"/rotate", testAdminKey, nil).Code)
+	})
+}
@@ -0,0 +1,114 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-cdn/internal/config"
+	"go-cdn/pkg/model"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type batchResults struct {
+	Results []struct {
+		Filename string `json:"filename"`
+		Hash     string `json:"hash"`
+		Status   int    `json:"status"`
+		Error    string `json:"error"`
+		Message  string `json:"message"`
+	} `json:"results"`
+	Message string `json:"message"`
+}
+
+// Sends content once for each of names in a single batch
+func batchUpload(r *gin.Engine, names []string, content []byte) (*httptest.ResponseRecorder, batchResults) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	for _, name := range names {
+		fw, _ := mw.CreateFormFile("file", name)
+		fw.Write(content)
+	}
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/content/batch", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var res batchResults
+	json.Unmarshal(w.Body.Bytes(), &res)
+	return w, res
+}
+
+func TestBatch(t *testing.T) {
+	repo := newMemoryRepository()
+	r := newUploadRouter(t, repo)
+	hashes := []string{}
+
+	t.Run("TestBatchUpload", func(t *testing.T) {
+		w, res := batchUpload(r, []string{"a.png", "b.exe", "c.png"}, pngHeader)
+		assert.Equal(t, http.StatusMultiStatus, w.Code)
+		assert.Len(t, res.Results, 3)
+		assert.Equal(t, http.StatusCreated, res.Results[0].Status)
+		assert.Equal(t, "extension_not_allowed", res.Results[1].Error)
+		assert.Empty(t, res.Results[1].Hash)
+		assert.Equal(t, http.StatusCreated, res.Results[2].Status)
+		assert.Len(t, repo.files, 2)
+
+		hashes = append(hashes, res.Results[0].Hash, res.Results[2].Hash)
+	})
+
+	t.Run("TestBatchDelete", func(t *testing.T) {
+		payload, _ := json.Marshal(map[string][]string{"hashes": append(hashes, "missing")})
+		req := httptest.NewRequest(http.MethodPost, "/content/batch/delete", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var res map[string][]string
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &res))
+		assert.ElementsMatch(t, hashes, res["removed"])
+		assert.Equal(t, []string{"missing"}, res["not_found"])
+		assert.Empty(t, repo.files)
+	})
+
+	t.Run("TestHashTaken", func(t *testing.T) {
+		// The batch is stored again under new hashes
+		repo.taken = 2
+		w, res := batchUpload(r, []string{"a.png", "b.png"}, pngHeader)
+		assert.Equal(t, http.StatusOK, w.Code)
+		for _, result := range res.Results {
+			assert.Equal(t, http.StatusCreated, result.Status)
+			assert.Contains(t, repo.files, result.Hash)
+		}
+		assert.Len(t, repo.files, 2)
+		repo.files = map[string]*model.StoredFile{}
+	})
+
+	t.Run("TestBatchDeleteInvalid", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/content/batch/delete", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestBatchTooLarge(t *testing.T) {
+	r := newRouter(t, newMemoryRepository(), func(cfg *config.Config) {
+		cfg.Upload.UploadMaxSize = 1024
+		cfg.Upload.UploadMaxBatchFiles = 2
+	})
+
+	// The limit reported is the one of each file, as for the single uploads
+	w, res := batchUpload(r, []string{"a.png"}, bytes.Repeat(pngHeader, 5<<10))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Equal(t, "the maximum allowed size is 1024 bytes", res.Message)
+}
@@ -0,0 +1,155 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-cdn/internal/config"
+	"go-cdn/internal/database/controller"
+	"go-cdn/internal/server"
+	"go-cdn/pkg/model"
+	"go-cdn/pkg/signedurl"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newBucketRouter(t *testing.T, repo *memoryRepository) *gin.Engine {
+	signer, err := signedurl.New([]signedurl.Key{newSigningKey}, newSigningKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configure := func(cfg *config.Config) {
+		enableAuth(cfg)
+		cfg.Signing.SigningDefaultTTL = time.Minute
+	}
+	return newRouter(t, repo, configure,
+		server.WithBuckets(database.NewBucketController(repo)),
+		server.WithUsage(database.NewUsageController(repo)),
+		withAPIKeys(repo),
+		server.WithSigner(signer))
+}
+
+func bucketUpload(r *gin.Engine, path string, key string, content []byte) (*httptest.ResponseRecorder, map[string]string) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "image.png")
+	fw.Write(content)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, path, body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	res := map[string]string{}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	return w, res
+}
+
+func TestBuckets(t *testing.T) {
+	repo := newMemoryRepository()
+	repo.files["abcdef"] = &model.StoredFile{IDHash: "abcdef", Content: []byte("a")}
+	r := newBucketRouter(t, repo)
+
+	create := func(payload map[string]any) int {
+		return authRequest(r, http.MethodPost, "/admin/buckets", testAdminKey, payload).Code
+	}
+	assert.Equal(t, http.StatusCreated, create(map[string]any{"name": "photos", "cache_control": "public, max-age=60"}))
+	assert.Equal(t, http.StatusCreated, create(map[string]any{"name": "docs", "allowed_types": []string{"text/plain"}, "quota_bytes": 20}))
+	assert.Equal(t, http.StatusCreated, create(map[string]any{"name": "secret", "private": true}))
+
+	t.Run("TestCreate", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, create(map[string]any{"name": "photos"}))
+		assert.Equal(t, http.StatusBadRequest, create(map[string]any{"name": "list"}))
+		assert.Equal(t, http.StatusBadRequest, create(map[string]any{"name": "egress"}))
+		assert.Equal(t, http.StatusBadRequest, create(map[string]any{"name": "ratelimit"}))
+		assert.Equal(t, http.StatusBadRequest, create(map[string]any{"name": "Not_Valid"}))
+
+		w := authRequest(r, http.MethodGet, "/admin/buckets", testAdminKey, nil)
+		var res map[string][]model.Bucket
+		json.Unmarshal(w.Body.Bytes(), &res)
+		assert.Len(t, res["list"], 4)
+	})
+
+	t.Run("TestIsolation", func(t *testing.T) {
+		w, res := bucketUpload(r, "/content/photos/", testAdminKey, pngHeader)
+		assert.Equal(t, http.StatusOK, w.Code)
+		hash := res["hash"]
+
+		w = authRequest(r, http.MethodGet, "/content/photos/"+hash, "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+		assert.Equal(t, http.StatusBadRequest, authRequest(r, http.MethodGet, "/content/"+hash, "", nil).Code)
+
+		// The default bucket is reachable with and without the bucket segment
+		assert.Equal(t, http.StatusOK, authRequest(r, http.MethodGet, "/content/abcdef", "", nil).Code)
+		assert.Equal(t, http.StatusOK, authRequest(r, http.MethodGet, "/content/default/abcdef", "", nil).Code)
+		assert.Equal(t, http.StatusBadRequest, authRequest(r, http.MethodGet, "/content/photos/abcdef", "", nil).Code)
+
+		var list map[string][]model.StoredFile
+		json.Unmarshal(authRequest(r, http.MethodGet, "/content/photos/list", "", nil).Body.Bytes(), &list)
+		assert.Len(t, list["list"], 1)
+
+		assert.Equal(t, http.StatusNotFound, authRequest(r, http.MethodGet, "/content/missing/abcdef", "", nil).Code)
+	})
+
+	t.Run("TestSettings", func(t *testing.T) {
+		w, _ := bucketUpload(r, "/content/docs/", testAdminKey, pngHeader)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+		w, _ = bucketUpload(r, "/content/docs/", testAdminKey, []byte("some text"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		w, res := bucketUpload(r, "/content/docs/", testAdminKey, []byte("more text, over quota"))
+		assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+		assert.Equal(t, "quota_exceeded", res["error"])
+	})
+
+	t.Run("TestPrivate", func(t *testing.T) {
+		_, res := bucketUpload(r, "/content/secret/", testAdminKey, pngHeader)
+		path := "/content/secret/" + res["hash"]
+
+		assert.Equal(t, http.StatusForbidden, authRequest(r, http.MethodGet, path, "", nil).Code)
+		assert.Equal(t, http.StatusForbidden, authRequest(r, http.MethodGet, "/content/secret/list", "", nil).Code)
+		assert.Equal(t, http.StatusOK, authRequest(r, http.MethodGet, path, testAdminKey, nil).Code)
+
+		var signed map[string]string
+		json.Unmarshal(authRequest(r, http.MethodPost, path+"/sign", testAdminKey, map[string]any{}).Body.Bytes(), &signed)
+		assert.Equal(t, http.StatusOK, authRequest(r, http.MethodGet, signed["url"], "", nil).Code)
+	})
+
+	t.Run("TestBucketKeys", func(t *testing.T) {
+		w := authRequest(r, http.MethodPost, "/admin/keys", testAdminKey, map[string]any{"scopes": []string{"write", "delete"}, "bucket": "photos"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var res map[string]any
+		json.Unmarshal(w.Body.Bytes(), &res)
+		key := res["key"].(string)
+
+		w, _ = bucketUpload(r, "/content/photos/", key, pngHeader)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w, _ = bucketUpload(r, "/content/", key, pngHeader)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, http.StatusForbidden, authRequest(r, http.MethodDelete, "/content/abcdef", key, nil).Code)
+
+		w = authRequest(r, http.MethodPost, "/admin/keys", testAdminKey, map[string]any{"scopes": []string{"read"}, "bucket": "missing"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("TestUpdateAndRemove", func(t *testing.T) {
+		w := authRequest(r, http.MethodPut, "/admin/buckets/photos", testAdminKey, map[string]any{"private": true})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusForbidden, authRequest(r, http.MethodGet, "/content/photos/list", "", nil).Code)
+
+		assert.Equal(t, http.StatusConflict, authRequest(r, http.MethodDelete, "/admin/buckets/photos", testAdminKey, nil).Code)
+		assert.Equal(t, http.StatusBadRequest, authRequest(r, http.MethodDelete, "/admin/buckets/default", testAdminKey, nil).Code)
+
+		create(map[string]any{"name": "empty"})
+		assert.Equal(t, http.StatusOK, authRequest(r, http.MethodDelete, "/admin/buckets/empty", testAdminKey, nil).Code)
+		assert.Equal(t, http.StatusNotFound, authRequest(r, http.MethodGet, "/content/empty/list", "", nil).Code)
+	})
+}
@@ -0,0 +1,65 @@
+package server_test
+
+import (
+	"encoding/json"
+	"go-cdn/internal/logger"
+	"go-cdn/internal/server"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDebug(t *testing.T) {
+	repo := newMemoryRepository()
+	levels := &logger.Levels{File: zap.NewAtomicLevelAt(zap.InfoLevel), Console: zap.NewAtomicLevelAt(zap.DebugLevel)}
+	g := newServer(t, repo, enableAuth, withAPIKeys(repo), server.WithLogLevels(levels))
+	r, admin := g.Router(), g.AdminRouter()
+
+	t.Run("TestLogLevel", func(t *testing.T) {
+		var res map[string]string
+		json.Unmarshal(authRequest(admin, http.MethodGet, "/admin/log/level", testAdminKey, nil).Body.Bytes(), &res)
+		assert.Equal(t, map[string]string{"file": "info", "console": "debug"}, res)
+
+		assert.Equal(t, http.StatusOK, authRequest(admin, http.MethodPut, "/admin/log/level", testAdminKey, map[string]string{"file": "debug"}).Code)
+		assert.Equal(t, zap.DebugLevel, levels.File.Level())
+
+		assert.Equal(t, http.StatusOK, authRequest(admin, http.MethodPut, "/admin/log/level", testAdminKey, map[string]string{"level": "warn"}).Code)
+		assert.Equal(t, zap.WarnLevel, levels.File.Level())
+		assert.Equal(t, zap.WarnLevel, levels.Console.Level())
+	})
+
+	t.Run("TestInvalidLevel", func(t *testing.T) {
+		// Nothing is applied when one of the levels is invalid
+		w := authRequest(admin, http.MethodPut, "/admin/log/level", testAdminKey, map[string]string{"file": "error", "console": "loud"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, zap.WarnLevel, levels.File.Level())
+
+		assert.Equal(t, http.StatusBadRequest, authRequest(admin, http.MethodPut, "/admin/log/level", testAdminKey, map[string]string{}).Code)
+		assert.Equal(t, http.StatusUnauthorized, authRequest(admin, http.MethodPut, "/admin/log/level", "", map[string]string{"level": "debug"}).Code)
+	})
+
+	t.Run("TestPublicLogLevel", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, authRequest(r, http.MethodPut, "/admin/log/level", testAdminKey, map[string]string{"level": "debug"}).Code)
+		assert.Equal(t, zap.WarnLevel, levels.File.Level())
+	})
+
+	t.Run("TestDebugRouter", func(t *testing.T) {
+		d := g.DebugRouter()
+		assert.Equal(t, http.StatusUnauthorized, authRequest(d, http.MethodGet, "/debug/runtime", "", nil).Code)
+
+		w := authRequest(d, http.MethodGet, "/debug/runtime", testAdminKey, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var res map[string]any
+		json.Unmarshal(w.Body.Bytes(), &res)
+		assert.Greater(t, res["goroutines"], float64(0))
+
+		assert.Equal(t, http.StatusOK, authRequest(d, http.MethodGet, "/debug/pprof/", testAdminKey, nil).Code)
+		assert.Equal(t, http.StatusOK, authRequest(d, http.MethodGet, "/debug/pprof/goroutine?debug=1", testAdminKey, nil).Code)
+		assert.Equal(t, http.StatusOK, authRequest(d, http.MethodGet, "/debug/log/level", testAdminKey, nil).Code)
+
+		// Not reachable from the public router
+		assert.Equal(t, http.StatusNotFound, authRequest(r, http.MethodGet, "/debug/runtime", testAdminKey, nil).Code)
+	})
+}
@@ -0,0 +1,75 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"go-cdn/internal/database/controller"
+	"go-cdn/internal/server"
+	"go-cdn/internal/stats"
+	"go-cdn/pkg/model"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type egressResponse struct {
+	List  []model.EgressReport `json:"list"`
+	Total model.EgressCount    `json:"total"`
+}
+
+func TestEgress(t *testing.T) {
+	repo := newMemoryRepository()
+	repo.files["abcdef"] = &model.StoredFile{IDHash: "abcdef", Content: []byte("0123456789")}
+	repo.files["ghijkl"] = &model.StoredFile{IDHash: "ghijkl", Content: []byte("01234")}
+
+	buffer := &memoryEgressBuffer{counts: map[model.EgressKey]model.EgressCount{}}
+	traffic := database.NewEgressController(repo)
+	egress := stats.NewEgressCounter(traffic, database.NewEgressBuffer(buffer), time.Hour, zap.NewNop().Sugar())
+	r := newRouter(t, repo, enableAuth, withAPIKeys(repo), server.WithEgress(egress, traffic))
+
+	report := func(query string) (int, egressResponse) {
+		w := authRequest(r, http.MethodGet, "/admin/egress"+query, testAdminKey, nil)
+		var res egressResponse
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res
+	}
+
+	t.Run("TestCount", func(t *testing.T) {
+		for _, path := range []string{"/content/abcdef", "/content/abcdef", "/content/default/ghijkl", "/content/missing"} {
+			authRequest(r, http.MethodGet, path, "", nil)
+		}
+
+		// Nothing is reported before the counts are flushed
+		_, res := report("")
+		assert.Empty(t, res.List)
+
+		assert.NoError(t, egress.Flush(context.Background()))
+		assert.Empty(t, buffer.counts)
+
+		code, res := report("?group_by=file")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, []model.EgressReport{
+			{Bucket: model.DefaultBucket, Hash: "abcdef", EgressCount: model.EgressCount{Bytes: 20, Requests: 2}},
+			{Bucket: model.DefaultBucket, Hash: "ghijkl", EgressCount: model.EgressCount{Bytes: 5, Requests: 1}},
+		}, res.List)
+		assert.Equal(t, model.EgressCount{Bytes: 25, Requests: 3}, res.Total)
+	})
+
+	t.Run("TestRange", func(t *testing.T) {
+		_, res := report("?from=" + time.Now().Add(2*time.Hour).Format(time.RFC3339))
+		assert.Empty(t, res.List)
+
+		_, res = report("?from=" + time.Now().Add(-2*time.Hour).Format(time.RFC3339))
+		assert.Equal(t, int64(25), res.Total.Bytes)
+	})
+
+	t.Run("TestInvalid", func(t *testing.T) {
+		code, _ := report("?group_by=owner")
+		assert.Equal(t, http.StatusBadRequest, code)
+		code, _ = report("?from=yesterday")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
@@ -0,0 +1,105 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-cdn/internal/config"
+	"go-cdn/internal/fetch"
+	"go-cdn/internal/server"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFetchRouter(t *testing.T, repo *memoryRepository, allowed []string) *gin.Engine {
+	configure := func(cfg *config.Config) {
+		cfg.Upload.UploadMaxSize = 1024
+		cfg.Upload.UploadAllowedTypes = []string{"image/*"}
+		cfg.Fetch = config.Fetch{FetchEnable: true, FetchTimeout: time.Second, FetchMaxRedirects: 2, FetchAllowedNetworks: allowed}
+	}
+
+	cfg := newTestConfig()
+	configure(cfg)
+	fetcher, err := fetch.New(cfg)
+	assert.Nil(t, err)
+	return newRouter(t, repo, configure, server.WithFetcher(fetcher))
+}
+
+func postFetch(r *gin.Engine, url string) (*httptest.ResponseRecorder, map[string]string) {
+	payload, _ := json.Marshal(map[string]string{"url": url})
+	req := httptest.NewRequest(http.MethodPost, "/content/fetch", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	res := map[string]string{}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	return w, res
+}
+
+func TestFetch(t *testing.T) {
+	var received http.Header
+	mux := http.NewServeMux()
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngHeader)
+	})
+	mux.HandleFunc("/large.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(append(pngHeader, make([]byte, 2048)...))
+	})
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write(pngHeader)
+	})
+	mux.HandleFunc("/missing.png", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	origin := httptest.NewServer(mux)
+	defer origin.Close()
+
+	repo := newMemoryRepository()
+
+	t.Run("TestPrivateDenied", func(t *testing.T) {
+		w, res := postFetch(newFetchRouter(t, repo, nil), origin.URL+"/image.png")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "forbidden_address", res["error"])
+		assert.Empty(t, repo.files)
+	})
+
+	r := newFetchRouter(t, repo, []string{"127.0.0.0/8"})
+
+	t.Run("TestFetch", func(t *testing.T) {
+		w, res := postFetch(r, origin.URL+"/image.png")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image.png", repo.files[res["hash"]].Filename)
+		assert.Equal(t, pngHeader, repo.files[res["hash"]].Content)
+
+		// The origin is picked by the client, nothing internal is forwarded to it
+		assert.Empty(t, received.Get("X-Request-ID"))
+		assert.Empty(t, received.Get("Traceparent"))
+	})
+
+	t.Run("TestErrors", func(t *testing.T) {
+		cases := map[string]int{
+			origin.URL + "/large.png":   http.StatusRequestEntityTooLarge,
+			origin.URL + "/page.html":   http.StatusUnsupportedMediaType,
+			origin.URL + "/missing.png": http.StatusBadGateway,
+			origin.URL + "/loop":        http.StatusBadGateway,
+			"ftp://localhost/image.png": http.StatusBadRequest,
+		}
+		for url, code := range cases {
+			w, _ := postFetch(r, url)
+			assert.Equal(t, code, w.Code, url)
+		}
+		assert.Len(t, repo.files, 1)
+	})
+}
@@ -0,0 +1,58 @@
+package server_test
+
+import (
+	"encoding/json"
+	"go-cdn/internal/config"
+	"go-cdn/internal/database/controller"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	repo := newMemoryRepository()
+	cache := newMemoryRepository()
+	g := newServer(t, repo, func(cfg *config.Config) { cfg.Cache.RedisEnable = true })
+	g.Cache = database.New(cache)
+	r := g.Router()
+
+	readyz := func() (int, map[string]any) {
+		w := authRequest(r, http.MethodGet, "/readyz", "", nil)
+		var res map[string]any
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res
+	}
+
+	t.Run("TestReady", func(t *testing.T) {
+		code, res := readyz()
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "ok", res["status"])
+		components := res["components"].(map[string]any)
+		assert.Equal(t, "ok", components["postgres"].(map[string]any)["status"])
+		assert.Equal(t, "ok", components["redis"].(map[string]any)["status"])
+	})
+
+	t.Run("TestDependencyDown", func(t *testing.T) {
+		cache.down = true
+		defer func() { cache.down = false }()
+
+		code, res := readyz()
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		components := res["components"].(map[string]any)
+		assert.Equal(t, "ok", components["postgres"].(map[string]any)["status"])
+		assert.Equal(t, "unavailable", components["redis"].(map[string]any)["status"])
+		assert.Equal(t, "connection refused", components["redis"].(map[string]any)["error"])
+
+		// Liveness doesn't depend on the databases
+		assert.Equal(t, http.StatusOK, authRequest(r, http.MethodGet, "/livez", "", nil).Code)
+	})
+
+	t.Run("TestDraining", func(t *testing.T) {
+		g.Drain()
+		code, res := readyz()
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "shutting_down", res["status"])
+		assert.Equal(t, http.StatusOK, authRequest(r, http.MethodGet, "/livez", "", nil).Code)
+	})
+}
@@ -0,0 +1,180 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"go-cdn/internal/auth"
+	"go-cdn/internal/config"
+	"go-cdn/internal/server"
+	"go.uber.org/zap"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const testIssuer = "https://issuer.test/"
+
+// Keys published by identity providers along with the signing ones, which can't be used here
+var unsupportedJWKs = []map[string]string{
+	{"kid": "ed", "kty": "OKP", "crv": "Ed25519", "x": "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+	{"kid": "hs", "kty": "oct", "k": "c2VjcmV0"},
+}
+
+// Writes a key set with the public part of key to a temporary file
+func writeJWKS(t *testing.T, kid string, key *rsa.PrivateKey) string {
+	return writeJWKSFile(t, append([]map[string]string{{
+		"kid": kid,
+		"kty": "RSA",
+		"use": "sig",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}, unsupportedJWKs...))
+}
+
+func writeJWKSFile(t *testing.T, keys []map[string]string) string {
+	raw, _ := json.Marshal(map[string]any{"keys": keys})
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func signToken(t *testing.T, kid string, key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func newJWTRouter(t *testing.T, repo *memoryRepository, jwks string) *gin.Engine {
+	configure := func(cfg *config.Config) {
+		cfg.Auth.AuthEnable = true
+		cfg.Auth.JWT.JWTJWKS = jwks
+		cfg.Auth.JWT.JWTIssuer = testIssuer
+		cfg.Auth.JWT.JWTAudience = "go-cdn"
+		cfg.Auth.JWT.JWTSubjectClaim = "sub"
+		cfg.Auth.JWT.JWTScopeClaim = "scope"
+		cfg.Auth.JWT.JWTScopeMapping = map[string][]string{
+			"cdn.read":   {"read"},
+			"cdn.editor": {"read", "write"},
+		}
+	}
+
+	cfg := newTestConfig()
+	configure(cfg)
+	bearer, err := auth.NewJWTAuthenticator(context.Background(), cfg, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newRouter(t, repo, configure, server.WithBearerAuth(bearer))
+}
+
+func bearerUpload(r *gin.Engine, token string) (*httptest.ResponseRecorder, map[string]string) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "a.png")
+	fw.Write(pngHeader)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/content/", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	res := map[string]string{}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	return w, res
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	repo := newMemoryRepository()
+	r := newJWTRouter(t, repo, writeJWKS(t, "k1", key))
+
+	claims := func(sub string, scope string, exp time.Duration) jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":   sub,
+			"scope": scope,
+			"iss":   testIssuer,
+			"aud":   "go-cdn",
+			"exp":   time.Now().Add(exp).Unix(),
+		}
+	}
+
+	t.Run("TestMissingToken", func(t *testing.T) {
+		w, _ := bearerUpload(r, "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+	})
+
+	t.Run("TestUploadedBy", func(t *testing.T) {
+		w, res := bearerUpload(r, signToken(t, "k1", key, claims("service-a", "openid cdn.editor", time.Hour)))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "service-a", repo.files[res["hash"]].UploadedBy)
+	})
+
+	t.Run("TestScopeMapping", func(t *testing.T) {
+		w, _ := bearerUpload(r, signToken(t, "k1", key, claims("service-b", "cdn.read", time.Hour)))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		// Scope names not in the mapping are ignored
+		w, _ = bearerUpload(r, signToken(t, "k1", key, claims("service-b", "write", time.Hour)))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("TestScopeList", func(t *testing.T) {
+		c := claims("service-c", "", time.Hour)
+		c["scope"] = []string{"cdn.editor"}
+		w, _ := bearerUpload(r, signToken(t, "k1", key, c))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("TestExpired", func(t *testing.T) {
+		w, _ := bearerUpload(r, signToken(t, "k1", key, claims("service-a", "cdn.editor", -time.Hour)))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("TestWrongAudience", func(t *testing.T) {
+		c := claims("service-a", "cdn.editor", time.Hour)
+		c["aud"] = "another-service"
+		w, _ := bearerUpload(r, signToken(t, "k1", key, c))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("TestUnknownKey", func(t *testing.T) {
+		other, _ := rsa.GenerateKey(rand.Reader, 2048)
+		w, _ := bearerUpload(r, signToken(t, "k1", other, claims("service-a", "cdn.editor", time.Hour)))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w, _ = bearerUpload(r, signToken(t, "k2", other, claims("service-a", "cdn.editor", time.Hour)))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestJWKSWithoutUsableKeys(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Auth.JWT.JWTJWKS = writeJWKSFile(t, unsupportedJWKs)
+	_, err := auth.NewJWTAuthenticator(context.Background(), cfg, zap.NewNop().Sugar())
+	assert.Error(t, err)
+}
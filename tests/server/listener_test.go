@@ -0,0 +1,80 @@
+package server_test
+
+import (
+	"go-cdn/internal/config"
+	"go-cdn/internal/database/controller"
+	"go-cdn/internal/server"
+	"go-cdn/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminListener(t *testing.T) {
+	repo := newMemoryRepository()
+	repo.files["abcdef"] = &model.StoredFile{IDHash: "abcdef", Content: []byte("a")}
+	repo.files["ghijkl"] = &model.StoredFile{IDHash: "ghijkl", Content: []byte("b")}
+
+	g := newServer(t, repo, func(cfg *config.Config) {
+		cfg.Metrics.MetricsEnable = true
+		cfg.Metrics.MetricsPath = "/metrics"
+		cfg.Admin.AdminEnable = true
+		cfg.Admin.AdminAllowedNetworks = []string{"10.0.0.0/8"}
+	})
+	public, admin := g.Router(), g.AdminRouter()
+
+	t.Run("TestPublicReadOnly", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, requestFrom(public, "192.0.2.1", "/content/abcdef", "").Code)
+		assert.Equal(t, http.StatusOK, requestFrom(public, "192.0.2.1", "/readyz", "").Code)
+		assert.Equal(t, http.StatusNotFound, requestFrom(public, "192.0.2.1", "/metrics", "").Code)
+		assert.Equal(t, http.StatusNotFound, requestFrom(public, "192.0.2.1", "/admin/warmup", "").Code)
+		assert.Equal(t, http.StatusNotFound, requestFrom(public, "192.0.2.1", "/content/list", "").Code)
+
+		assert.Equal(t, http.StatusNotFound, authRequest(public, http.MethodDelete, "/content/abcdef", "", nil).Code)
+		assert.Equal(t, http.StatusNotFound, authRequest(public, http.MethodPost, "/content/batch/delete", "", map[string]any{"hashes": []string{"abcdef"}}).Code)
+		assert.NotNil(t, repo.files["abcdef"])
+	})
+
+	t.Run("TestAdminNetworks", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, requestFrom(admin, "192.0.2.1", "/content/abcdef", "").Code)
+		assert.Equal(t, http.StatusOK, requestFrom(admin, "10.1.2.3", "/content/abcdef", "").Code)
+		assert.Equal(t, http.StatusOK, requestFrom(admin, "10.1.2.3", "/metrics", "").Code)
+		assert.Equal(t, http.StatusOK, requestFrom(admin, "10.1.2.3", "/content/list", "").Code)
+
+		// Forwarded addresses are ignored
+		req := httptest.NewRequest(http.MethodGet, "/content/abcdef", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("TestInvalidNetworks", func(t *testing.T) {
+		admin := newServer(t, repo, func(cfg *config.Config) {
+			cfg.Admin.AdminEnable = true
+			cfg.Admin.AdminAllowedNetworks = []string{"10.0.0.0/33"}
+		}).AdminRouter()
+		assert.Equal(t, http.StatusForbidden, requestFrom(admin, "192.0.2.1", "/content/abcdef", "").Code)
+	})
+
+	t.Run("TestAdminWrites", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/content/ghijkl", nil)
+		req.RemoteAddr = "10.1.2.3:1234"
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Nil(t, repo.files["ghijkl"])
+	})
+
+	t.Run("TestSingleListener", func(t *testing.T) {
+		r := newRouter(t, repo, nil, server.WithBuckets(database.NewBucketController(repo)))
+		assert.Equal(t, http.StatusOK, authRequest(r, http.MethodDelete, "/content/abcdef", "", nil).Code)
+
+		// The admin routes would be open to anyone without authentication
+		assert.Equal(t, http.StatusNotFound, authRequest(r, http.MethodGet, "/admin/buckets", "", nil).Code)
+		assert.Equal(t, http.StatusNotFound, authRequest(r, http.MethodPost, "/admin/buckets", "", map[string]any{"name": "photos"}).Code)
+	})
+}
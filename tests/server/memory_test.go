@@ -0,0 +1,647 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"go-cdn/internal/config"
+	"go-cdn/internal/database/controller"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/server"
+	"go-cdn/pkg/model"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// Configs used by the server tests, everything that requires external services is disabled
+func newTestConfig() *config.Config {
+	return &config.Config{
+		HTTPServer: config.HTTPServer{AllowInsertion: true, AllowDeletion: true},
+	}
+}
+
+// Builds a server on top of repo, configure tweaks the test configs before the server is created
+func newServer(t *testing.T, repo *memoryRepository, configure func(cfg *config.Config), opts ...server.ServerOpt) *server.GinServer {
+	t.Helper()
+	cfg := newTestConfig()
+	if configure != nil {
+		configure(cfg)
+	}
+	return server.New(cfg, database.New(repo), nil, zap.NewNop().Sugar(), opts...)
+}
+
+// Same as newServer, returning the public router
+func newRouter(t *testing.T, repo *memoryRepository, configure func(cfg *config.Config), opts ...server.ServerOpt) *gin.Engine {
+	t.Helper()
+	return newServer(t, repo, configure, opts...).Router()
+}
+
+// In-memory repository standing in for Postgres
+type memoryRepository struct {
+	mu      sync.Mutex
+	files   map[string]*model.StoredFile
+	uploads map[string]*memoryUpload
+	history map[string][]model.StoredFile
+	trash   map[string]*model.StoredFile
+	keys    map[string]*model.APIKey
+	buckets map[string]*model.Bucket
+	quotas  map[string]*model.Quota
+	egress  map[model.EgressKey]model.EgressCount
+	down    bool
+	taken   int  // how many of the next generated hashes are reported as taken
+	full    bool // storing reports the hard quota as exceeded, as when a concurrent upload got there first
+}
+
+type memoryUpload struct {
+	upload model.Upload
+	chunks []byte
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		files:   map[string]*model.StoredFile{},
+		uploads: map[string]*memoryUpload{},
+		history: map[string][]model.StoredFile{},
+		trash:   map[string]*model.StoredFile{},
+		keys:    map[string]*model.APIKey{},
+		buckets: map[string]*model.Bucket{model.DefaultBucket: {Name: model.DefaultBucket}},
+		quotas:  map[string]*model.Quota{},
+		egress:  map[model.EgressKey]model.EgressCount{},
+	}
+}
+
+// Files of the default bucket are keyed by hash alone, so that tests can reach them directly
+func fileKey(bucket string, id_hash string) string {
+	if bucket == "" || bucket == model.DefaultBucket {
+		return id_hash
+	}
+	return bucket + ":" + id_hash
+}
+
+func inBucket(f *model.StoredFile, bucket string) bool {
+	return f.Bucket == bucket || (f.Bucket == "" && bucket == model.DefaultBucket)
+}
+
+func (m *memoryRepository) GetFile(ctx context.Context, bucket string, id_hash string) (*model.StoredFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[fileKey(bucket, id_hash)]
+	if !ok {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	return f, nil
+}
+
+func (m *memoryRepository) GetFileList(ctx context.Context, bucket string) (*[]model.StoredFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := []model.StoredFile{}
+	for _, f := range m.files {
+		if inBucket(f, bucket) {
+			l = append(l, model.StoredFile{Bucket: bucket, IDHash: f.IDHash, Filename: f.Filename})
+		}
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].IDHash < l[j].IDHash })
+	return &l, nil
+}
+
+func (m *memoryRepository) AddFile(ctx context.Context, file *model.StoredFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.full {
+		return repository.ErrQuotaExceeded
+	}
+	key := fileKey(file.Bucket, file.IDHash)
+	if m.taken > 0 {
+		m.taken--
+		return repository.ErrKeyExists
+	}
+	if m.files[key] != nil || m.trash[key] != nil {
+		return repository.ErrKeyExists
+	}
+	m.files[key] = file
+	return nil
+}
+
+func (m *memoryRepository) RemoveFile(ctx context.Context, bucket string, id_hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := fileKey(bucket, id_hash)
+	f, ok := m.files[key]
+	if !ok {
+		return repository.ErrKeyDoesNotExist
+	}
+	m.trash[key] = f
+	delete(m.files, key)
+	return nil
+}
+
+func (m *memoryRepository) Ping(ctx context.Context) error {
+	if m.down {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (m *memoryRepository) CloseConnection() error { return nil }
+
+func (m *memoryRepository) AddFiles(ctx context.Context, files []*model.StoredFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.full {
+		return repository.ErrQuotaExceeded
+	}
+	if m.taken > 0 {
+		m.taken--
+		return repository.ErrKeyExists
+	}
+	for _, f := range files {
+		m.files[fileKey(f.Bucket, f.IDHash)] = f
+	}
+	return nil
+}
+
+func (m *memoryRepository) RemoveFiles(ctx context.Context, bucket string, id_hashes []string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := []string{}
+	for _, id_hash := range id_hashes {
+		key := fileKey(bucket, id_hash)
+		if f, ok := m.files[key]; ok {
+			m.trash[key] = f
+			delete(m.files, key)
+			removed = append(removed, id_hash)
+		}
+	}
+	return removed, nil
+}
+
+func (m *memoryRepository) CreateUpload(ctx context.Context, upload *model.Upload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uploads[upload.ID] = &memoryUpload{upload: *upload}
+	return nil
+}
+
+func (m *memoryRepository) GetUpload(ctx context.Context, upload_id string) (*model.Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.uploads[upload_id]
+	if !ok {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	upload := u.upload
+	return &upload, nil
+}
+
+func (m *memoryRepository) AppendChunk(ctx context.Context, upload_id string, offset int64, chunk []byte) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.uploads[upload_id]
+	if !ok {
+		return 0, repository.ErrKeyDoesNotExist
+	}
+	if u.upload.Offset != offset {
+		return u.upload.Offset, repository.ErrOffsetMismatch
+	}
+	u.chunks = append(u.chunks, chunk...)
+	u.upload.Offset += int64(len(chunk))
+	return u.upload.Offset, nil
+}
+
+func (m *memoryRepository) ReadUploadHead(ctx context.Context, upload_id string, n int) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.uploads[upload_id]
+	if !ok {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	if len(u.chunks) > n {
+		return u.chunks[:n], nil
+	}
+	return u.chunks, nil
+}
+
+func (m *memoryRepository) FinalizeUpload(ctx context.Context, upload_id string, id_hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.uploads[upload_id]
+	if !ok {
+		return repository.ErrKeyDoesNotExist
+	}
+	if m.taken > 0 {
+		m.taken--
+		return repository.ErrKeyExists
+	}
+	m.files[fileKey(u.upload.Bucket, id_hash)] = &model.StoredFile{Bucket: u.upload.Bucket, IDHash: id_hash, Filename: u.upload.Filename, Content: u.chunks, UploadedBy: u.upload.UploadedBy, Private: u.upload.Private}
+	delete(m.uploads, upload_id)
+	return nil
+}
+
+func (m *memoryRepository) RemoveUpload(ctx context.Context, upload_id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.uploads, upload_id)
+	return nil
+}
+
+func (m *memoryRepository) RemoveExpiredUploads(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (m *memoryRepository) ReplaceFile(ctx context.Context, file *model.StoredFile, keep int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := fileKey(file.Bucket, file.IDHash)
+	current, ok := m.files[key]
+	if !ok {
+		return 0, repository.ErrKeyDoesNotExist
+	}
+	if current.Version == 0 {
+		current.Version = 1
+	}
+	m.history[key] = append(m.history[key], *current)
+	if len(m.history[key]) > keep {
+		m.history[key] = m.history[key][len(m.history[key])-keep:]
+	}
+	m.files[key] = &model.StoredFile{Bucket: file.Bucket, IDHash: file.IDHash, Filename: file.Filename, Content: file.Content, Version: current.Version + 1, UploadedBy: file.UploadedBy}
+	return current.Version + 1, nil
+}
+
+func (m *memoryRepository) GetFileVersion(ctx context.Context, bucket string, id_hash string, version int) (*model.StoredFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := fileKey(bucket, id_hash)
+	if f, ok := m.files[key]; ok && f.Version == version {
+		return f, nil
+	}
+	for _, f := range m.history[key] {
+		if f.Version == version {
+			if current, ok := m.files[key]; ok {
+				f.Private = current.Private
+			}
+			return &f, nil
+		}
+	}
+	return nil, repository.ErrKeyDoesNotExist
+}
+
+func (m *memoryRepository) GetFileVersions(ctx context.Context, bucket string, id_hash string) ([]model.FileVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := fileKey(bucket, id_hash)
+	f, ok := m.files[key]
+	if !ok {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	versions := []model.FileVersion{{Version: f.Version, Filename: f.Filename, Size: int64(len(f.Content)), Current: true}}
+	for i := len(m.history[key]) - 1; i >= 0; i-- {
+		h := m.history[key][i]
+		versions = append(versions, model.FileVersion{Version: h.Version, Filename: h.Filename, Size: int64(len(h.Content))})
+	}
+	return versions, nil
+}
+
+func (m *memoryRepository) GetTrash(ctx context.Context, bucket string) ([]model.TrashedFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := []model.TrashedFile{}
+	for _, f := range m.trash {
+		if inBucket(f, bucket) {
+			l = append(l, model.TrashedFile{Bucket: bucket, IDHash: f.IDHash, Filename: f.Filename, DeletedAt: time.Now()})
+		}
+	}
+	return l, nil
+}
+
+func (m *memoryRepository) RestoreFile(ctx context.Context, bucket string, id_hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := fileKey(bucket, id_hash)
+	f, ok := m.trash[key]
+	if !ok {
+		return repository.ErrKeyDoesNotExist
+	}
+	if m.full {
+		return repository.ErrQuotaExceeded
+	}
+	m.files[key] = f
+	delete(m.trash, key)
+	return nil
+}
+
+func (m *memoryRepository) PurgeFile(ctx context.Context, bucket string, id_hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := fileKey(bucket, id_hash)
+	if _, ok := m.trash[key]; !ok {
+		return repository.ErrKeyDoesNotExist
+	}
+	delete(m.trash, key)
+	return nil
+}
+
+func (m *memoryRepository) PurgeDeletedBefore(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *memoryRepository) AddKey(ctx context.Context, key *model.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := *key
+	k.CreatedAt = time.Now()
+	m.keys[key.KeyID] = &k
+	return nil
+}
+
+func (m *memoryRepository) GetKey(ctx context.Context, key_id string) (*model.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.keys[key_id]
+	if !ok {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	key := *k
+	return &key, nil
+}
+
+func (m *memoryRepository) GetKeys(ctx context.Context) ([]model.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := []model.APIKey{}
+	for _, k := range m.keys {
+		l = append(l, *k)
+	}
+	return l, nil
+}
+
+func (m *memoryRepository) RevokeKey(ctx context.Context, key_id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.keys[key_id]
+	if !ok || k.RevokedAt != nil {
+		return repository.ErrKeyDoesNotExist
+	}
+	now := time.Now()
+	k.RevokedAt = &now
+	return nil
+}
+
+func (m *memoryRepository) ExpireKey(ctx context.Context, key_id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.keys[key_id]
+	if !ok {
+		return repository.ErrKeyDoesNotExist
+	}
+	if k.ExpiresAt == nil || k.ExpiresAt.After(at) {
+		k.ExpiresAt = &at
+	}
+	return nil
+}
+
+func (m *memoryRepository) SetPrivate(ctx context.Context, bucket string, id_hash string, private bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[fileKey(bucket, id_hash)]
+	if !ok {
+		return repository.ErrKeyDoesNotExist
+	}
+	f.Private = private
+	return nil
+}
+
+func (m *memoryRepository) AddBucket(ctx context.Context, bucket *model.Bucket) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.buckets[bucket.Name]; ok {
+		return repository.ErrKeyExists
+	}
+	b := *bucket
+	b.CreatedAt = time.Now()
+	m.buckets[b.Name] = &b
+	return nil
+}
+
+func (m *memoryRepository) GetBucket(ctx context.Context, name string) (*model.Bucket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[name]
+	if !ok {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	bucket := *b
+	return &bucket, nil
+}
+
+func (m *memoryRepository) GetBuckets(ctx context.Context) ([]model.Bucket, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := []model.Bucket{}
+	for _, b := range m.buckets {
+		l = append(l, *b)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Name < l[j].Name })
+	return l, nil
+}
+
+func (m *memoryRepository) UpdateBucket(ctx context.Context, bucket *model.Bucket) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.buckets[bucket.Name]; !ok {
+		return repository.ErrKeyDoesNotExist
+	}
+	b := *bucket
+	m.buckets[b.Name] = &b
+	return nil
+}
+
+func (m *memoryRepository) RemoveBucket(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.buckets[name]; !ok {
+		return repository.ErrKeyDoesNotExist
+	}
+	for _, f := range m.files {
+		if inBucket(f, name) {
+			return repository.ErrBucketNotEmpty
+		}
+	}
+	delete(m.buckets, name)
+	delete(m.quotas, model.BucketOwner(name))
+	return nil
+}
+
+func (m *memoryRepository) GetBucketUsage(ctx context.Context, name string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var usage int64
+	for _, f := range m.files {
+		if inBucket(f, name) {
+			usage += int64(len(f.Content))
+		}
+	}
+	return usage, nil
+}
+
+// Usage is computed from the current files rather than maintained like in Postgres
+func (m *memoryRepository) usages() map[string]*model.Usage {
+	usages := map[string]*model.Usage{}
+	add := func(owner string, size int64) {
+		u, ok := usages[owner]
+		if !ok {
+			u = &model.Usage{Owner: owner}
+			usages[owner] = u
+		}
+		u.Bytes += size
+		u.Objects++
+	}
+	for _, f := range m.files {
+		bucket := f.Bucket
+		if bucket == "" {
+			bucket = model.DefaultBucket
+		}
+		add(model.BucketOwner(bucket), int64(len(f.Content)))
+		if f.UploadedBy != "" {
+			add(f.UploadedBy, int64(len(f.Content)))
+		}
+	}
+	return usages
+}
+
+func (m *memoryRepository) GetUsage(ctx context.Context, owner string) (*model.Usage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if u, ok := m.usages()[owner]; ok {
+		return u, nil
+	}
+	return &model.Usage{Owner: owner}, nil
+}
+
+func (m *memoryRepository) GetUsages(ctx context.Context) ([]model.Usage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := []model.Usage{}
+	for _, u := range m.usages() {
+		l = append(l, *u)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Bytes > l[j].Bytes })
+	return l, nil
+}
+
+func (m *memoryRepository) GetQuota(ctx context.Context, owner string) (*model.Quota, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q, ok := m.quotas[owner]
+	if !ok {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	quota := *q
+	return &quota, nil
+}
+
+func (m *memoryRepository) GetQuotas(ctx context.Context) ([]model.Quota, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := []model.Quota{}
+	for _, q := range m.quotas {
+		l = append(l, *q)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Owner < l[j].Owner })
+	return l, nil
+}
+
+func (m *memoryRepository) SetQuota(ctx context.Context, quota *model.Quota) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q := *quota
+	m.quotas[q.Owner] = &q
+	return nil
+}
+
+func (m *memoryRepository) RemoveQuota(ctx context.Context, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.quotas[owner]; !ok {
+		return repository.ErrKeyDoesNotExist
+	}
+	delete(m.quotas, owner)
+	return nil
+}
+
+func (m *memoryRepository) RecordEgress(ctx context.Context, counts map[model.EgressKey]model.EgressCount) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	addEgress(m.egress, counts)
+	return nil
+}
+
+// Only the filters and the groupings used by the tests are supported
+func (m *memoryRepository) GetEgress(ctx context.Context, filter model.EgressFilter) ([]model.EgressReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	groups := map[string]*model.EgressReport{}
+	for key, count := range m.egress {
+		if filter.Bucket != "" && key.Bucket != filter.Bucket || !filter.From.IsZero() && key.Period.Before(filter.From) {
+			continue
+		}
+		group := key.Bucket
+		if filter.GroupBy == "file" {
+			group += "/" + key.Hash
+		}
+		r, ok := groups[group]
+		if !ok {
+			r = &model.EgressReport{Bucket: key.Bucket}
+			if filter.GroupBy == "file" {
+				r.Hash = key.Hash
+			}
+			groups[group] = r
+		}
+		r.Bytes += count.Bytes
+		r.Requests += count.Requests
+	}
+	l := []model.EgressReport{}
+	for _, r := range groups {
+		l = append(l, *r)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].Bytes > l[j].Bytes })
+	return l, nil
+}
+
+// In-memory buffer standing in for Redis
+type memoryEgressBuffer struct {
+	mu     sync.Mutex
+	counts map[model.EgressKey]model.EgressCount
+}
+
+func (b *memoryEgressBuffer) AddEgress(ctx context.Context, counts map[model.EgressKey]model.EgressCount) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	addEgress(b.counts, counts)
+	return nil
+}
+
+func (b *memoryEgressBuffer) TakeEgress(ctx context.Context) (map[model.EgressKey]model.EgressCount, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	taken := b.counts
+	b.counts = map[model.EgressKey]model.EgressCount{}
+	return taken, nil
+}
+
+func addEgress(to map[model.EgressKey]model.EgressCount, counts map[model.EgressKey]model.EgressCount) {
+	for key, count := range counts {
+		c := to[key]
+		c.Bytes += count.Bytes
+		c.Requests += count.Requests
+		to[key] = c
+	}
+}
@@ -0,0 +1,67 @@
+package server_test
+
+import (
+	"context"
+	"go-cdn/internal/config"
+	"go-cdn/pkg/model"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetrics(t *testing.T) {
+	repo := newMemoryRepository()
+	repo.files["abcdef"] = &model.StoredFile{IDHash: "abcdef", Content: []byte("0123456789")}
+
+	r := newRouter(t, repo, func(cfg *config.Config) {
+		cfg.Metrics.MetricsEnable = true
+		cfg.Metrics.MetricsPath = "/metrics"
+	})
+
+	authRequest(r, http.MethodGet, "/content/abcdef", "", nil)
+	authRequest(r, http.MethodGet, "/not/a/route", "", nil)
+	authRequest(r, "FOOBAR", "/content/abcdef", "", nil)
+
+	w := authRequest(r, http.MethodGet, "/metrics", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `gocdn_http_requests_total{method="GET",route="/content/:bucket",status="200"}`)
+	assert.Contains(t, body, `gocdn_http_requests_total{method="GET",route="unmatched",status="404"}`)
+	assert.Contains(t, body, `gocdn_http_request_duration_seconds_bucket{method="GET",route="/content/:bucket",status="200"`)
+	assert.Contains(t, body, `gocdn_http_response_bytes_total{route="/content/:bucket"}`)
+	assert.Contains(t, body, `gocdn_http_requests_total{method="other",`)
+	assert.NotContains(t, body, "FOOBAR")
+	assert.Contains(t, body, "go_goroutines")
+
+	t.Run("TestDisabled", func(t *testing.T) {
+		r := newRouter(t, repo, nil)
+		assert.Equal(t, http.StatusNotFound, authRequest(r, http.MethodGet, "/metrics", "", nil).Code)
+	})
+
+	t.Run("TestOTLP", func(t *testing.T) {
+		// Stands in for the OTLP exporter
+		reader := sdkmetric.NewManualReader()
+		otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+		r := newRouter(t, repo, func(cfg *config.Config) { cfg.Telemetry.TelemetryEnable = true })
+		authRequest(r, http.MethodGet, "/content/abcdef", "", nil)
+		assert.Equal(t, http.StatusNotFound, authRequest(r, http.MethodGet, "/metrics", "", nil).Code)
+
+		var rm metricdata.ResourceMetrics
+		assert.Nil(t, reader.Collect(context.Background(), &rm))
+		names := map[string]bool{}
+		for _, sm := range rm.ScopeMetrics {
+			assert.Equal(t, "go-cdn", sm.Scope.Name)
+			for _, m := range sm.Metrics {
+				names[m.Name] = true
+			}
+		}
+		assert.True(t, names["http.server.requests"])
+		assert.True(t, names["http.server.duration"])
+		assert.True(t, names["http.server.response.size"])
+	})
+}
@@ -0,0 +1,107 @@
+package server_test
+
+import (
+	"encoding/json"
+	"go-cdn/pkg/model"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotas(t *testing.T) {
+	repo := newMemoryRepository()
+	r := newBucketRouter(t, repo)
+
+	setQuota := func(owner string, payload map[string]any) int {
+		return authRequest(r, http.MethodPut, "/admin/quotas/"+owner, testAdminKey, payload).Code
+	}
+	assert.Equal(t, http.StatusCreated, authRequest(r, http.MethodPost, "/admin/buckets", testAdminKey, map[string]any{"name": "photos"}).Code)
+
+	t.Run("TestSetQuota", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, setQuota("bucket:photos", map[string]any{"soft_bytes": 20, "hard_bytes": 60, "hard_objects": 2}))
+		assert.Equal(t, http.StatusBadRequest, setQuota("admin", map[string]any{"hard_bytes": -1}))
+
+		var res map[string][]model.Quota
+		json.Unmarshal(authRequest(r, http.MethodGet, "/admin/quotas", testAdminKey, nil).Body.Bytes(), &res)
+		assert.Len(t, res["list"], 1)
+		assert.Equal(t, int64(60), res["list"][0].HardBytes)
+	})
+
+	t.Run("TestEnforce", func(t *testing.T) {
+		w, _ := bucketUpload(r, "/content/photos/", testAdminKey, pngHeader)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-Quota-Warning"))
+
+		w, _ = bucketUpload(r, "/content/photos/", testAdminKey, append(pngHeader, 1))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("X-Quota-Warning"), "bucket:photos")
+
+		// Hard object limit reached
+		w, res := bucketUpload(r, "/content/photos/", testAdminKey, append(pngHeader, 2))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "object_quota_exceeded", res["error"])
+
+		// Hard byte limit reached
+		assert.Equal(t, http.StatusOK, setQuota("bucket:photos", map[string]any{"hard_bytes": 40}))
+		w, res = bucketUpload(r, "/content/photos/", testAdminKey, append(pngHeader, 2))
+		assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+		assert.Equal(t, "quota_exceeded", res["error"])
+
+		// Other buckets are not affected
+		w, _ = bucketUpload(r, "/content/", testAdminKey, pngHeader)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("TestUploaderQuota", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, setQuota("admin", map[string]any{"hard_objects": 2}))
+		w, res := bucketUpload(r, "/content/", testAdminKey, append(pngHeader, 3))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, res["message"], "admin")
+	})
+
+	t.Run("TestUsage", func(t *testing.T) {
+		var report map[string]any
+		json.Unmarshal(authRequest(r, http.MethodGet, "/admin/usage/bucket:photos", testAdminKey, nil).Body.Bytes(), &report)
+		assert.Equal(t, float64(2), report["objects"])
+		assert.Equal(t, float64(2*len(pngHeader)+1), report["bytes"])
+		assert.NotNil(t, report["quota"])
+
+		var res map[string][]map[string]any
+		json.Unmarshal(authRequest(r, http.MethodGet, "/admin/usage?owner=bucket:", testAdminKey, nil).Body.Bytes(), &res)
+		assert.Len(t, res["list"], 2)
+
+		json.Unmarshal(authRequest(r, http.MethodGet, "/admin/usage/admin", testAdminKey, nil).Body.Bytes(), &report)
+		assert.Equal(t, float64(3), report["objects"])
+		assert.Equal(t, "hard", report["exceeded"])
+	})
+
+	t.Run("TestRemoveQuota", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, authRequest(r, http.MethodDelete, "/admin/quotas/admin", testAdminKey, nil).Code)
+		assert.Equal(t, http.StatusNotFound, authRequest(r, http.MethodDelete, "/admin/quotas/admin", testAdminKey, nil).Code)
+
+		w, _ := bucketUpload(r, "/content/", testAdminKey, append(pngHeader, 3))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusUnauthorized, authRequest(r, http.MethodGet, "/admin/quotas", "", nil).Code)
+	})
+
+	t.Run("TestStoredQuota", func(t *testing.T) {
+		// Exceeded by a concurrent upload, the quota is only found out when storing
+		repo.full = true
+		defer func() { repo.full = false }()
+		w, res := bucketUpload(r, "/content/", testAdminKey, append(pngHeader, 5))
+		assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+		assert.Equal(t, "quota_exceeded", res["error"])
+	})
+
+	t.Run("TestRemoveBucket", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, authRequest(r, http.MethodPost, "/admin/buckets", testAdminKey, map[string]any{"name": "drafts"}).Code)
+		assert.Equal(t, http.StatusOK, setQuota("bucket:drafts", map[string]any{"hard_bytes": 1}))
+		assert.Equal(t, http.StatusOK, authRequest(r, http.MethodDelete, "/admin/buckets/drafts", testAdminKey, nil).Code)
+
+		// Created again, the bucket doesn't inherit the quota
+		assert.Equal(t, http.StatusCreated, authRequest(r, http.MethodPost, "/admin/buckets", testAdminKey, map[string]any{"name": "drafts"}).Code)
+		w, _ := bucketUpload(r, "/content/drafts/", testAdminKey, append(pngHeader, 4))
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
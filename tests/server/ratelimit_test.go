@@ -0,0 +1,156 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"go-cdn/internal/config"
+	"go-cdn/internal/ratelimit"
+	"go-cdn/internal/server"
+	"go-cdn/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Limiter standing in for an unreachable Redis
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, rate ratelimit.Rate) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func newRateLimitRouter(t *testing.T, repo *memoryRepository, limits config.RateLimit, opts ...server.ServerOpt) *gin.Engine {
+	return newRouter(t, repo, func(cfg *config.Config) {
+		enableAuth(cfg)
+		cfg.RateLimit = limits
+		cfg.RateLimit.RateLimitEnable = true
+	}, append(opts, withAPIKeys(repo))...)
+}
+
+func requestFrom(r *gin.Engine, ip string, path string, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = ip + ":1234"
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	repo := newMemoryRepository()
+	repo.files["abcdef"] = &model.StoredFile{IDHash: "abcdef", Content: []byte("a")}
+
+	t.Run("TestPerClient", func(t *testing.T) {
+		r := newRateLimitRouter(t, repo, config.RateLimit{RateLimitRate: 0.001, RateLimitBurst: 2, RateLimitMaxClients: 10})
+
+		w := requestFrom(r, "192.0.2.1", "/content/abcdef", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+
+		assert.Equal(t, http.StatusOK, requestFrom(r, "192.0.2.1", "/content/abcdef", "").Code)
+		w = requestFrom(r, "192.0.2.1", "/content/abcdef", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		var res map[string]string
+		json.Unmarshal(w.Body.Bytes(), &res)
+		assert.Equal(t, "rate_limited", res["error"])
+
+		// Another IP, or the same one with credentials, has its own budget
+		assert.Equal(t, http.StatusOK, requestFrom(r, "192.0.2.2", "/content/abcdef", "").Code)
+		assert.Equal(t, http.StatusOK, requestFrom(r, "192.0.2.1", "/content/abcdef", testAdminKey).Code)
+
+		// Health checks are never limited
+		assert.Equal(t, http.StatusOK, requestFrom(r, "192.0.2.1", "/health", "").Code)
+	})
+
+	t.Run("TestRoutes", func(t *testing.T) {
+		r := newRateLimitRouter(t, repo, config.RateLimit{
+			RateLimitRate:       0.001,
+			RateLimitBurst:      5,
+			RateLimitMaxClients: 10,
+			RateLimitRoutes:     []config.RateLimitRoute{{Route: "GET /content/list", Rate: 0.001, Burst: 1}},
+		})
+
+		assert.Equal(t, http.StatusOK, requestFrom(r, "192.0.2.1", "/content/list", "").Code)
+		assert.Equal(t, http.StatusTooManyRequests, requestFrom(r, "192.0.2.1", "/content/list", "").Code)
+		assert.Equal(t, http.StatusOK, requestFrom(r, "192.0.2.1", "/content/abcdef", "").Code)
+	})
+
+	t.Run("TestNoBudget", func(t *testing.T) {
+		r := newRateLimitRouter(t, repo, config.RateLimit{
+			RateLimitRate:       0.001,
+			RateLimitBurst:      5,
+			RateLimitMaxClients: 10,
+			RateLimitRoutes:     []config.RateLimitRoute{{Route: "GET /content/list", Rate: 0, Burst: 1}},
+		})
+
+		w := requestFrom(r, "192.0.2.1", "/content/list", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Empty(t, w.Header().Get("Retry-After"))
+		assert.Equal(t, http.StatusOK, requestFrom(r, "192.0.2.1", "/content/abcdef", "").Code)
+	})
+
+	t.Run("TestAllowlist", func(t *testing.T) {
+		r := newRateLimitRouter(t, repo, config.RateLimit{
+			RateLimitRate:            0.001,
+			RateLimitBurst:           1,
+			RateLimitMaxClients:      10,
+			RateLimitAllowedNetworks: []string{"10.0.0.0/8"},
+			RateLimitAllowedSubjects: []string{"admin"},
+		})
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, requestFrom(r, "10.1.2.3", "/content/abcdef", "").Code)
+			assert.Equal(t, http.StatusOK, requestFrom(r, "192.0.2.1", "/content/abcdef", testAdminKey).Code)
+		}
+		assert.Equal(t, http.StatusOK, requestFrom(r, "192.0.2.1", "/content/abcdef", "").Code)
+		assert.Equal(t, http.StatusTooManyRequests, requestFrom(r, "192.0.2.1", "/content/abcdef", "").Code)
+	})
+
+	t.Run("TestForwardedFor", func(t *testing.T) {
+		limits := config.RateLimit{RateLimitRate: 0.001, RateLimitBurst: 1, RateLimitMaxClients: 10, RateLimitAllowedNetworks: []string{"10.0.0.0/8"}}
+		forwarded := func(r *gin.Engine, peer string, client string) int {
+			req := httptest.NewRequest(http.MethodGet, "/content/abcdef", nil)
+			req.RemoteAddr = peer + ":1234"
+			req.Header.Set("X-Forwarded-For", client)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		// Clients can't pick a fresh or an allowlisted address
+		r := newRateLimitRouter(t, repo, limits)
+		assert.Equal(t, http.StatusOK, forwarded(r, "192.0.2.1", "198.51.100.1"))
+		assert.Equal(t, http.StatusTooManyRequests, forwarded(r, "192.0.2.1", "198.51.100.2"))
+		assert.Equal(t, http.StatusTooManyRequests, forwarded(r, "192.0.2.1", "10.1.2.3"))
+
+		// The address forwarded by a trusted proxy is used
+		r = newRouter(t, repo, func(cfg *config.Config) {
+			cfg.RateLimit = limits
+			cfg.RateLimit.RateLimitEnable = true
+			cfg.HTTPServer.TrustedProxies = []string{"192.0.2.0/24"}
+		})
+		assert.Equal(t, http.StatusOK, forwarded(r, "192.0.2.1", "198.51.100.1"))
+		assert.Equal(t, http.StatusOK, forwarded(r, "192.0.2.1", "198.51.100.2"))
+		assert.Equal(t, http.StatusTooManyRequests, forwarded(r, "192.0.2.1", "198.51.100.2"))
+	})
+
+	t.Run("TestFailOpen", func(t *testing.T) {
+		limits := config.RateLimit{RateLimitRate: 1, RateLimitBurst: 1, RateLimitFailOpen: true}
+		r := newRateLimitRouter(t, repo, limits, server.WithRateLimiter(failingLimiter{}))
+		assert.Equal(t, http.StatusOK, requestFrom(r, "192.0.2.1", "/content/abcdef", "").Code)
+
+		limits.RateLimitFailOpen = false
+		r = newRateLimitRouter(t, repo, limits, server.WithRateLimiter(failingLimiter{}))
+		w := requestFrom(r, "192.0.2.1", "/content/abcdef", "")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	})
+}
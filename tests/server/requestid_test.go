@@ -0,0 +1,86 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"go-cdn/internal/tracing"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func requestWithID(r *gin.Engine, method string, path string, headers map[string]string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRequestID(t *testing.T) {
+	var forwarded http.Header
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Clone()
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngHeader)
+	}))
+	defer origin.Close()
+
+	r := newFetchRouter(t, newMemoryRepository(), []string{"127.0.0.0/8"})
+
+	t.Run("TestEcho", func(t *testing.T) {
+		w := requestWithID(r, http.MethodGet, "/health", map[string]string{"X-Request-ID": "haproxy-0001"}, nil)
+		assert.Equal(t, "haproxy-0001", w.Header().Get("X-Request-ID"))
+
+		// Also on unmatched routes
+		w = requestWithID(r, http.MethodGet, "/not/a/route", map[string]string{"X-Request-ID": "haproxy-0002"}, nil)
+		assert.Equal(t, "haproxy-0002", w.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("TestGenerated", func(t *testing.T) {
+		w := requestWithID(r, http.MethodGet, "/health", nil, nil)
+		_, err := uuid.Parse(w.Header().Get("X-Request-ID"))
+		assert.Nil(t, err)
+	})
+
+	t.Run("TestInvalid", func(t *testing.T) {
+		for _, id := range []string{"bad id", "a\"b", strings.Repeat("a", 129)} {
+			w := requestWithID(r, http.MethodGet, "/health", map[string]string{"X-Request-ID": id}, nil)
+			assert.NotEqual(t, id, w.Header().Get("X-Request-ID"))
+			assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+		}
+	})
+
+	t.Run("TestBaggage", func(t *testing.T) {
+		w := requestWithID(r, http.MethodGet, "/health", map[string]string{"baggage": "request.id=upstream-42"}, nil)
+		assert.Equal(t, "upstream-42", w.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("TestNotForwarded", func(t *testing.T) {
+		// The origins of the fetches are picked by the clients
+		payload, _ := json.Marshal(map[string]string{"url": origin.URL + "/image.png"})
+		w := requestWithID(r, http.MethodPost, "/content/fetch", map[string]string{"X-Request-ID": "client-7"}, payload)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, forwarded.Get("X-Request-ID"))
+		assert.Empty(t, forwarded.Get("baggage"))
+	})
+
+	t.Run("TestTransport", func(t *testing.T) {
+		client := &http.Client{Transport: &tracing.Transport{}}
+		req, _ := http.NewRequestWithContext(tracing.WithRequestID(context.Background(), "client-8"), http.MethodGet, origin.URL, nil)
+		res, err := client.Do(req)
+		assert.Nil(t, err)
+		res.Body.Close()
+		assert.Equal(t, "client-8", forwarded.Get("X-Request-ID"))
+		assert.Contains(t, forwarded.Get("baggage"), "request.id=client-8")
+	})
+}
@@ -0,0 +1,134 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-cdn/internal/config"
+	"go-cdn/internal/database/controller"
+	"go-cdn/internal/server"
+	"go-cdn/pkg/model"
+	"go-cdn/pkg/signedurl"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	oldSigningKey = signedurl.Key{ID: "k1", Secret: "old-secret"}
+	newSigningKey = signedurl.Key{ID: "k2", Secret: "new-secret"}
+)
+
+func newSignedRouter(t *testing.T, repo *memoryRepository) *gin.Engine {
+	// k2 was rotated in, URLs signed with k1 are still accepted
+	signer, err := signedurl.New([]signedurl.Key{oldSigningKey, newSigningKey}, newSigningKey.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newRouter(t, repo, func(cfg *config.Config) {
+		cfg.Signing.SigningDefaultTTL = time.Minute
+		cfg.Signing.SigningMaxTTL = time.Hour
+	}, server.WithSigner(signer),
+		server.WithAccess(database.NewAccessController(repo)),
+		server.WithVersions(database.NewVersionController(repo, 1)))
+}
+
+func signedRequest(r *gin.Engine, method string, path string, payload any) *httptest.ResponseRecorder {
+	var body []byte
+	if payload != nil {
+		body, _ = json.Marshal(payload)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = "192.0.2.1:1234"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSignedURLs(t *testing.T) {
+	repo := newMemoryRepository()
+	repo.files["public"] = &model.StoredFile{IDHash: "public", Content: []byte("a")}
+	repo.files["secret"] = &model.StoredFile{IDHash: "secret", Content: []byte("b"), Private: true, Version: 1}
+	r := newSignedRouter(t, repo)
+
+	mint := func(payload map[string]any) string {
+		w := signedRequest(r, http.MethodPost, "/content/secret/sign", payload)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var res map[string]string
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return res["url"]
+	}
+
+	t.Run("TestUnsigned", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, signedRequest(r, http.MethodGet, "/content/public", nil).Code)
+		assert.Equal(t, http.StatusForbidden, signedRequest(r, http.MethodGet, "/content/secret", nil).Code)
+		assert.Equal(t, http.StatusForbidden, signedRequest(r, http.MethodGet, "/content/secret?version=1", nil).Code)
+	})
+
+	t.Run("TestSigned", func(t *testing.T) {
+		w := signedRequest(r, http.MethodGet, mint(map[string]any{}), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "b", w.Body.String())
+	})
+
+	t.Run("TestVersion", func(t *testing.T) {
+		// The signature doesn't cover the version, it only grants the current one
+		w := signedRequest(r, http.MethodGet, mint(map[string]any{})+"&version=1", nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "invalid_signature")
+	})
+
+	t.Run("TestOtherPath", func(t *testing.T) {
+		url := mint(map[string]any{})
+		query := url[len("/content/secret"):]
+		assert.Equal(t, http.StatusForbidden, signedRequest(r, http.MethodGet, "/content/public"+query, nil).Code)
+	})
+
+	t.Run("TestTampered", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, signedRequest(r, http.MethodGet, mint(map[string]any{})+"x", nil).Code)
+	})
+
+	t.Run("TestIPBinding", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, signedRequest(r, http.MethodGet, mint(map[string]any{"ip": "192.0.2.1"}), nil).Code)
+		assert.Equal(t, http.StatusForbidden, signedRequest(r, http.MethodGet, mint(map[string]any{"ip": "192.0.2.2"}), nil).Code)
+
+		// The peer isn't a trusted proxy, its X-Forwarded-For is ignored
+		req := httptest.NewRequest(http.MethodGet, mint(map[string]any{"ip": "198.51.100.1"}), nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("TestTTL", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, signedRequest(r, http.MethodPost, "/content/secret/sign", map[string]any{"ttl": "48h"}).Code)
+
+		expired, _ := signedurl.SignURL("/content/secret", newSigningKey, time.Now().Add(-time.Minute), "")
+		assert.Equal(t, http.StatusForbidden, signedRequest(r, http.MethodGet, expired, nil).Code)
+	})
+
+	t.Run("TestRotation", func(t *testing.T) {
+		url, _ := signedurl.SignURL("/content/secret", oldSigningKey, time.Now().Add(time.Minute), "")
+		assert.Equal(t, http.StatusOK, signedRequest(r, http.MethodGet, url, nil).Code)
+
+		url, _ = signedurl.SignURL("/content/secret", signedurl.Key{ID: "k3", Secret: "unknown"}, time.Now().Add(time.Minute), "")
+		assert.Equal(t, http.StatusForbidden, signedRequest(r, http.MethodGet, url, nil).Code)
+	})
+
+	t.Run("TestPrivateFlag", func(t *testing.T) {
+		w := signedRequest(r, http.MethodPatch, "/content/public", map[string]any{"private": true})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusForbidden, signedRequest(r, http.MethodGet, "/content/public", nil).Code)
+
+		signedRequest(r, http.MethodPatch, "/content/public", map[string]any{"private": false})
+		assert.Equal(t, http.StatusOK, signedRequest(r, http.MethodGet, "/content/public", nil).Code)
+
+		assert.Equal(t, http.StatusNotFound, signedRequest(r, http.MethodPatch, "/content/missing", map[string]any{"private": true}).Code)
+	})
+}
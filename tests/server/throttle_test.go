@@ -0,0 +1,57 @@
+package server_test
+
+import (
+	"bytes"
+	"go-cdn/internal/config"
+	"go-cdn/pkg/model"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottle(t *testing.T) {
+	repo := newMemoryRepository()
+	content := bytes.Repeat([]byte("a"), 3000)
+	repo.files["abcdef"] = &model.StoredFile{IDHash: "abcdef", Content: content}
+
+	r := newRouter(t, repo, func(cfg *config.Config) {
+		enableAuth(cfg)
+		cfg.Metrics.MetricsEnable = true
+		cfg.Metrics.MetricsPath = "/metrics"
+		cfg.Throttle = config.Throttle{
+			ThrottleEnable:         true,
+			ThrottleRate:           10000,
+			ThrottleBurst:          1000,
+			ThrottleExemptSubjects: []string{"admin"},
+		}
+	}, withAPIKeys(repo))
+	throttled := func() string {
+		body := authRequest(r, http.MethodGet, "/metrics", testAdminKey, nil).Body.String()
+		return regexp.MustCompile(`(?m)^gocdn_throttled_responses_total (\d+)$`).FindStringSubmatch(body)[1]
+	}
+
+	t.Run("TestThrottled", func(t *testing.T) {
+		start := time.Now()
+		w := authRequest(r, http.MethodGet, "/content/abcdef", "", nil)
+		elapsed := time.Since(start)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, content, w.Body.Bytes())
+		// The first 1000 bytes are a burst, the other 2000 take 200ms
+		assert.GreaterOrEqual(t, elapsed, 180*time.Millisecond)
+
+		assert.Equal(t, "1", throttled())
+	})
+
+	t.Run("TestExempt", func(t *testing.T) {
+		start := time.Now()
+		w := authRequest(r, http.MethodGet, "/content/abcdef", testAdminKey, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+
+		assert.Equal(t, "1", throttled())
+	})
+}
@@ -0,0 +1,75 @@
+package server_test
+
+import (
+	"encoding/json"
+	"go-cdn/internal/database/controller"
+	"go-cdn/internal/server"
+	"go-cdn/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrash(t *testing.T) {
+	repo := newMemoryRepository()
+	repo.files["abcdef"] = &model.StoredFile{IDHash: "abcdef", Filename: "a.png", Content: []byte("a")}
+
+	r := newRouter(t, repo, nil, server.WithTrash(database.NewTrashController(repo, time.Hour)))
+
+	do := func(method string, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	t.Run("TestSoftDelete", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/content/abcdef").Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/content/abcdef").Code)
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodGet, "/content/abcdef").Code)
+	})
+
+	t.Run("TestListTrash", func(t *testing.T) {
+		w := do(http.MethodGet, "/content/trash")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var res struct {
+			List []model.TrashedFile `json:"list"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		assert.Len(t, res.List, 1)
+		assert.Equal(t, "abcdef", res.List[0].IDHash)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), res.List[0].PurgeAt, time.Minute)
+	})
+
+	t.Run("TestRestoreOverQuota", func(t *testing.T) {
+		repo.full = true
+		defer func() { repo.full = false }()
+		assert.Equal(t, http.StatusInsufficientStorage, do(http.MethodPost, "/content/abcdef/restore").Code)
+		assert.Contains(t, repo.trash, "abcdef")
+	})
+
+	t.Run("TestHashReuse", func(t *testing.T) {
+		// The first hash drawn is taken, e.g. by a trashed file, so the upload draws another one
+		repo.taken = 1
+		w, res := bucketUpload(r, "/content/", "", pngHeader)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, "abcdef", res["hash"])
+		delete(repo.files, res["hash"])
+	})
+
+	t.Run("TestRestore", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do(http.MethodPost, "/content/abcdef/restore").Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/content/abcdef/restore").Code)
+		assert.Equal(t, "a", do(http.MethodGet, "/content/abcdef").Body.String())
+	})
+
+	t.Run("TestPurge", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/content/trash/abcdef").Code)
+		do(http.MethodDelete, "/content/abcdef")
+		assert.Equal(t, http.StatusOK, do(http.MethodDelete, "/content/trash/abcdef").Code)
+		assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/content/abcdef/restore").Code)
+	})
+}
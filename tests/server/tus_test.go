@@ -0,0 +1,206 @@
+package server_test
+
+import (
+	"bytes"
+	"go-cdn/internal/config"
+	"go-cdn/internal/database/controller"
+	"go-cdn/internal/server"
+	"go-cdn/pkg/model"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTusRouter(t *testing.T, repo *memoryRepository) *gin.Engine {
+	return newRouter(t, repo, func(cfg *config.Config) {
+		cfg.Tus.TusMaxSize = 1024
+		cfg.Tus.TusMaxChunkSize = 4
+		cfg.Tus.TusExpiration = time.Hour
+		cfg.Upload.UploadMaxSize = 16
+		cfg.Upload.UploadDeniedExtensions = []string{"exe"}
+	}, server.WithUploads(database.NewUploadController(repo)))
+}
+
+func tusRequest(r *gin.Engine, method string, path string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestTusUpload(t *testing.T) {
+	repo := newMemoryRepository()
+	r := newTusRouter(t, repo)
+	var location string
+
+	t.Run("TestMissingVersion", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/uploads/", nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	})
+
+	t.Run("TestTooLarge", func(t *testing.T) {
+		w := tusRequest(r, http.MethodPost, "/uploads/", nil, map[string]string{"Upload-Length": "2048"})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+		// Larger than upload.max_size is fine, it only applies to the single requests
+		w = tusRequest(r, http.MethodPost, "/uploads/", nil, map[string]string{"Upload-Length": "512"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("TestDeniedExtension", func(t *testing.T) {
+		w := tusRequest(r, http.MethodPost, "/uploads/", nil, map[string]string{
+			"Upload-Length":   "6",
+			"Upload-Metadata": "filename dGVzdC5leGU=",
+		})
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+
+	t.Run("TestCreate", func(t *testing.T) {
+		w := tusRequest(r, http.MethodPost, "/uploads/", nil, map[string]string{
+			"Upload-Length":   "6",
+			"Upload-Metadata": "filename dGVzdC5wbmc=,private",
+		})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		location = w.Header().Get("Location")
+		assert.NotEmpty(t, location)
+		assert.NotEmpty(t, w.Header().Get("Upload-Expires"))
+	})
+
+	t.Run("TestPatchChunks", func(t *testing.T) {
+		headers := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"}
+
+		// Only max_chunk_size bytes are accepted per request
+		w := tusRequest(r, http.MethodPatch, location, []byte("abcdef"), headers)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "4", w.Header().Get("Upload-Offset"))
+
+		w = tusRequest(r, http.MethodPatch, location, []byte("ef"), headers)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = tusRequest(r, http.MethodHead, location, nil, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "4", w.Header().Get("Upload-Offset"))
+		assert.Equal(t, "6", w.Header().Get("Upload-Length"))
+
+		headers["Upload-Offset"] = "4"
+		w = tusRequest(r, http.MethodPatch, location, []byte("ef"), headers)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "6", w.Header().Get("Upload-Offset"))
+
+		hash := w.Header().Get("X-Content-Hash")
+		assert.NotEmpty(t, hash)
+		assert.Equal(t, []byte("abcdef"), repo.files[hash].Content)
+		assert.Equal(t, "test.png", repo.files[hash].Filename)
+	})
+
+	t.Run("TestWrongContentType", func(t *testing.T) {
+		w := tusRequest(r, http.MethodPatch, location, []byte("ef"), map[string]string{"Upload-Offset": "0"})
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	})
+
+	t.Run("TestFinalizedIsGone", func(t *testing.T) {
+		w := tusRequest(r, http.MethodHead, location, nil, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestTusPolicy(t *testing.T) {
+	repo := newMemoryRepository()
+	r := newRouter(t, repo, func(cfg *config.Config) {
+		cfg.Tus.TusMaxSize = 1024
+		cfg.Tus.TusMaxChunkSize = 4
+		cfg.Tus.TusExpiration = time.Hour
+		cfg.Upload.UploadAllowedTypes = []string{"image/*"}
+	}, server.WithUploads(database.NewUploadController(repo)), server.WithUsage(database.NewUsageController(repo)))
+
+	create := func(length int) string {
+		w := tusRequest(r, http.MethodPost, "/uploads/", nil, map[string]string{
+			"Upload-Length":   strconv.Itoa(length),
+			"Upload-Metadata": "filename dGVzdC5wbmc=",
+		})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		return w.Header().Get("Location")
+	}
+	patch := func(location string, offset int, body []byte) *httptest.ResponseRecorder {
+		headers := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": strconv.Itoa(offset)}
+		return tusRequest(r, http.MethodPatch, location, body, headers)
+	}
+	// Sends content in chunks of max_chunk_size, returning the response to the last one
+	send := func(location string, content []byte) *httptest.ResponseRecorder {
+		for offset := 0; ; offset += 4 {
+			if offset+4 >= len(content) {
+				return patch(location, offset, content[offset:])
+			}
+			assert.Equal(t, http.StatusNoContent, patch(location, offset, content[offset:offset+4]).Code)
+		}
+	}
+
+	t.Run("TestEmpty", func(t *testing.T) {
+		w := tusRequest(r, http.MethodPost, "/uploads/", nil, map[string]string{"Upload-Length": "0"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("TestTypeNotAllowed", func(t *testing.T) {
+		w := tusRequest(r, http.MethodPost, "/uploads/", nil, map[string]string{
+			"Upload-Length":   "6",
+			"Upload-Metadata": "filename dGVzdC5wbmc=",
+		})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		location := w.Header().Get("Location")
+
+		headers := map[string]string{"Content-Type": "application/offset+octet-stream", "Upload-Offset": "0"}
+		assert.Equal(t, http.StatusNoContent, tusRequest(r, http.MethodPatch, location, []byte("abcd"), headers).Code)
+
+		// The declared filename doesn't matter, the content is sniffed before finalizing
+		headers["Upload-Offset"] = "4"
+		w = tusRequest(r, http.MethodPatch, location, []byte("ef"), headers)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.Empty(t, w.Header().Get("X-Content-Hash"))
+		assert.Empty(t, repo.files)
+		assert.Equal(t, http.StatusNotFound, tusRequest(r, http.MethodHead, location, nil, nil).Code)
+	})
+	t.Run("TestHashTaken", func(t *testing.T) {
+		// Another hash is drawn when the first ones are taken
+		repo.taken = 2
+		w := send(create(len(pngHeader)), pngHeader)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.NotEmpty(t, w.Header().Get("X-Content-Hash"))
+
+		// Giving up keeps the upload, resending the last offset finalizes it
+		repo.taken = 3
+		location := create(len(pngHeader))
+		w = send(location, pngHeader)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Empty(t, w.Header().Get("X-Content-Hash"))
+
+		w = patch(location, len(pngHeader), nil)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.NotNil(t, repo.files[w.Header().Get("X-Content-Hash")])
+	})
+
+	t.Run("TestQuota", func(t *testing.T) {
+		owner := model.BucketOwner(model.DefaultBucket)
+		repo.files = map[string]*model.StoredFile{}
+		repo.quotas[owner] = &model.Quota{Owner: owner, HardBytes: int64(len(pngHeader)) + 8}
+		location := create(len(pngHeader))
+
+		// Checked again once complete, as other uploads may have gone through in the meantime
+		repo.files["other"] = &model.StoredFile{Bucket: model.DefaultBucket, IDHash: "other", Content: pngHeader}
+		w := send(location, pngHeader)
+		assert.Equal(t, http.StatusInsufficientStorage, w.Code)
+		assert.Empty(t, w.Header().Get("X-Content-Hash"))
+		assert.Len(t, repo.files, 1)
+		assert.Equal(t, http.StatusNotFound, tusRequest(r, http.MethodHead, location, nil, nil).Code)
+	})
+}
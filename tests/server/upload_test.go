@@ -0,0 +1,83 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-cdn/internal/config"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func newUploadRouter(t *testing.T, repo *memoryRepository) *gin.Engine {
+	return newRouter(t, repo, func(cfg *config.Config) {
+		cfg.Upload.UploadMaxSize = 1024
+		cfg.Upload.UploadAllowedTypes = []string{"image/*"}
+		cfg.Upload.UploadDeniedExtensions = []string{"exe"}
+	})
+}
+
+func multipartUpload(r *gin.Engine, filename string, content []byte) (*httptest.ResponseRecorder, map[string]string) {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", filename)
+	fw.Write(content)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/content/", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	res := map[string]string{}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	return w, res
+}
+
+func TestUploadPolicy(t *testing.T) {
+	repo := newMemoryRepository()
+	r := newUploadRouter(t, repo)
+
+	t.Run("TestAccepted", func(t *testing.T) {
+		w, res := multipartUpload(r, "../../image.png", pngHeader)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image.png", repo.files[res["hash"]].Filename)
+	})
+
+	// Used to panic when logging the first 6 bytes
+	t.Run("TestShortFile", func(t *testing.T) {
+		w, res := multipartUpload(r, "a.png", []byte("abc"))
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.Equal(t, "type_not_allowed", res["error"])
+	})
+
+	t.Run("TestEmptyFile", func(t *testing.T) {
+		w, res := multipartUpload(r, "a.png", []byte{})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "empty_file", res["error"])
+	})
+
+	t.Run("TestDeniedExtension", func(t *testing.T) {
+		w, res := multipartUpload(r, "a.EXE", pngHeader)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.Equal(t, "extension_not_allowed", res["error"])
+	})
+
+	t.Run("TestTooLarge", func(t *testing.T) {
+		w, res := multipartUpload(r, "a.png", append(pngHeader, make([]byte, 2048)...))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Equal(t, "file_too_large", res["error"])
+	})
+
+	t.Run("TestBodyOverLimit", func(t *testing.T) {
+		w, res := multipartUpload(r, "a.png", append(pngHeader, make([]byte, 128<<10)...))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Equal(t, "file_too_large", res["error"])
+	})
+}
@@ -0,0 +1,107 @@
+package server_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-cdn/internal/database/controller"
+	"go-cdn/internal/server"
+	"go-cdn/pkg/model"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func replaceFile(r *gin.Engine, hash string, content []byte) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, _ := mw.CreateFormFile("file", "new.png")
+	fw.Write(content)
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPut, "/content/"+hash, body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestVersions(t *testing.T) {
+	repo := newMemoryRepository()
+	repo.files["abcdef"] = &model.StoredFile{IDHash: "abcdef", Filename: "old.png", Content: []byte("old"), Version: 1}
+
+	r := newRouter(t, repo, nil, server.WithVersions(database.NewVersionController(repo, 1)))
+
+	put := func(hash string, content []byte) *httptest.ResponseRecorder {
+		return replaceFile(r, hash, content)
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	t.Run("TestReplace", func(t *testing.T) {
+		w := put("abcdef", []byte("new"))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var res map[string]any
+		json.Unmarshal(w.Body.Bytes(), &res)
+		assert.Equal(t, "abcdef", res["hash"])
+		assert.Equal(t, float64(2), res["version"])
+
+		assert.Equal(t, "new", get("/content/abcdef").Body.String())
+	})
+
+	t.Run("TestReplaceMissing", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, put("zzzzzz", []byte("new")).Code)
+	})
+
+	t.Run("TestGetVersion", func(t *testing.T) {
+		assert.Equal(t, "old", get("/content/abcdef?version=1").Body.String())
+		assert.Equal(t, "new", get("/content/abcdef?version=2").Body.String())
+		assert.Equal(t, http.StatusNotFound, get("/content/abcdef?version=3").Code)
+		assert.Equal(t, http.StatusBadRequest, get("/content/abcdef?version=x").Code)
+	})
+
+	t.Run("TestListVersions", func(t *testing.T) {
+		w := get("/content/abcdef/versions")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var res struct {
+			Versions []model.FileVersion `json:"versions"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		assert.Len(t, res.Versions, 2)
+		assert.True(t, res.Versions[0].Current)
+		assert.Equal(t, "old.png", res.Versions[1].Filename)
+	})
+	t.Run("TestKeep", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, put("abcdef", []byte("newer")).Code)
+
+		var res struct {
+			Versions []model.FileVersion `json:"versions"`
+		}
+		json.Unmarshal(get("/content/abcdef/versions").Body.Bytes(), &res)
+		assert.Len(t, res.Versions, 2)
+		assert.Equal(t, http.StatusNotFound, get("/content/abcdef?version=1").Code)
+		assert.Equal(t, "new", get("/content/abcdef?version=2").Body.String())
+	})
+}
+
+func TestReplaceQuota(t *testing.T) {
+	repo := newMemoryRepository()
+	repo.files["abcdef"] = &model.StoredFile{IDHash: "abcdef", Filename: "old.png", Content: []byte("old"), Version: 1}
+	repo.quotas[model.BucketOwner(model.DefaultBucket)] = &model.Quota{Owner: model.BucketOwner(model.DefaultBucket), HardBytes: 5}
+
+	r := newRouter(t, repo, nil,
+		server.WithVersions(database.NewVersionController(repo, 1)),
+		server.WithUsage(database.NewUsageController(repo)))
+
+	// Only the growth of the file counts
+	assert.Equal(t, http.StatusOK, replaceFile(r, "abcdef", []byte("newer")).Code)
+	assert.Equal(t, http.StatusInsufficientStorage, replaceFile(r, "abcdef", []byte("newest")).Code)
+}
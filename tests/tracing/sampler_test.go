@@ -0,0 +1,128 @@
+package tracing_test
+
+import (
+	"context"
+	"go-cdn/internal/config"
+	"go-cdn/internal/tracing"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newProvider(t *testing.T, cfg *config.Config) (trace.Tracer, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(tracing.NewHintProcessor(sdktrace.NewSimpleSpanProcessor(exporter), cfg)),
+		sdktrace.WithSampler(tracing.NewSampler(cfg)),
+	)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return provider.Tracer("test"), exporter
+}
+
+func exportedNames(exporter *tracetest.InMemoryExporter) []string {
+	names := []string{}
+	for _, s := range exporter.GetSpans() {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestSampler(t *testing.T) {
+	cfg := &config.Config{Telemetry: config.Telemetry{
+		Sampling:       1,
+		SamplingParent: true,
+		SamplingRules:  []config.SamplingRule{{Route: "/health", Ratio: 0}},
+	}}
+
+	t.Run("Rules", func(t *testing.T) {
+		tracer, exporter := newProvider(t, cfg)
+
+		_, span := tracer.Start(context.Background(), "/health")
+		span.End()
+		_, span = tracer.Start(context.Background(), "GET", trace.WithAttributes(semconv.HTTPRoute("/health")))
+		span.End()
+		_, span = tracer.Start(context.Background(), "/content/:file")
+		span.End()
+
+		assert.Equal(t, []string{"/content/:file"}, exportedNames(exporter))
+	})
+
+	t.Run("ParentBased", func(t *testing.T) {
+		tracer, exporter := newProvider(t, cfg)
+
+		// The caller sampled the trace, the rule doesn't apply to its children
+		parent := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{1},
+			SpanID:     trace.SpanID{1},
+			TraceFlags: trace.FlagsSampled,
+			Remote:     true,
+		})
+		_, span := tracer.Start(trace.ContextWithRemoteSpanContext(context.Background(), parent), "/health")
+		span.End()
+
+		// The caller didn't, the child isn't either
+		parent = parent.WithTraceFlags(0)
+		_, span = tracer.Start(trace.ContextWithRemoteSpanContext(context.Background(), parent), "/content/:file")
+		span.End()
+
+		assert.Equal(t, []string{"/health"}, exportedNames(exporter))
+	})
+
+	t.Run("NotParentBased", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Telemetry.SamplingParent = false
+		tracer, exporter := newProvider(t, &cfg)
+
+		parent := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: trace.TraceID{1},
+			SpanID:  trace.SpanID{1},
+			Remote:  true,
+		})
+		_, span := tracer.Start(trace.ContextWithRemoteSpanContext(context.Background(), parent), "/content/:file")
+		span.End()
+
+		assert.Equal(t, []string{"/content/:file"}, exportedNames(exporter))
+	})
+
+	t.Run("Hints", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Telemetry.Sampling = 0
+		cfg.Telemetry.SamplingErrors = true
+		cfg.Telemetry.SamplingSlow = time.Second
+		tracer, exporter := newProvider(t, &cfg)
+
+		_, span := tracer.Start(context.Background(), "fast")
+		span.End()
+
+		_, span = tracer.Start(context.Background(), "failed")
+		span.SetStatus(codes.Error, "boom")
+		span.End()
+
+		start := time.Now()
+		_, span = tracer.Start(context.Background(), "slow", trace.WithTimestamp(start))
+		span.End(trace.WithTimestamp(start.Add(2 * time.Second)))
+
+		assert.Equal(t, []string{"failed", "slow"}, exportedNames(exporter))
+		for _, s := range exporter.GetSpans() {
+			assert.True(t, s.SpanContext.IsSampled())
+		}
+	})
+
+	t.Run("NoHints", func(t *testing.T) {
+		cfg := *cfg
+		cfg.Telemetry.Sampling = 0
+		tracer, exporter := newProvider(t, &cfg)
+
+		_, span := tracer.Start(context.Background(), "failed")
+		span.SetStatus(codes.Error, "boom")
+		span.End()
+
+		assert.Empty(t, exporter.GetSpans())
+	})
+}
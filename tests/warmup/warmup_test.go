@@ -0,0 +1,147 @@
+package warmup_test
+
+import (
+	"context"
+	"go-cdn/internal/database/controller"
+	"go-cdn/internal/database/repository"
+	"go-cdn/internal/warmup"
+	"go-cdn/pkg/model"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// In-memory repository standing in for both Postgres and Redis
+type memoryRepository struct {
+	mu    sync.Mutex
+	files map[string]*model.StoredFile
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{files: map[string]*model.StoredFile{}}
+}
+
+func (m *memoryRepository) GetFile(ctx context.Context, bucket string, id_hash string) (*model.StoredFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[bucket+":"+id_hash]
+	if !ok {
+		return nil, repository.ErrKeyDoesNotExist
+	}
+	return f, nil
+}
+
+func (m *memoryRepository) GetFileList(ctx context.Context, bucket string) (*[]model.StoredFile, error) {
+	return &[]model.StoredFile{}, nil
+}
+
+func (m *memoryRepository) AddFile(ctx context.Context, file *model.StoredFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[file.Bucket+":"+file.IDHash] = file
+	return nil
+}
+
+func (m *memoryRepository) RemoveFile(ctx context.Context, bucket string, id_hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, bucket+":"+id_hash)
+	return nil
+}
+
+func (m *memoryRepository) Ping(ctx context.Context) error { return nil }
+func (m *memoryRepository) CloseConnection() error         { return nil }
+
+func (m *memoryRepository) AddFiles(ctx context.Context, files []*model.StoredFile) error {
+	for _, f := range files {
+		m.AddFile(ctx, f)
+	}
+	return nil
+}
+
+func (m *memoryRepository) RemoveFiles(ctx context.Context, bucket string, id_hashes []string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := []string{}
+	for _, id_hash := range id_hashes {
+		if _, ok := m.files[bucket+":"+id_hash]; ok {
+			delete(m.files, bucket+":"+id_hash)
+			removed = append(removed, id_hash)
+		}
+	}
+	return removed, nil
+}
+
+type staticStats struct{ refs []model.FileRef }
+
+func (s *staticStats) RecordHits(ctx context.Context, hits map[model.FileRef]int64) error { return nil }
+func (s *staticStats) GetPopularFiles(ctx context.Context, limit int) ([]model.FileRef, error) {
+	return s.refs[:limit], nil
+}
+func (s *staticStats) GetRecentFiles(ctx context.Context, limit int) ([]model.FileRef, error) {
+	return s.refs[len(s.refs)-limit:], nil
+}
+
+func waitDone(t *testing.T, w *warmup.Warmer) warmup.Progress {
+	assert.Eventually(t, func() bool { return !w.Progress().Running }, time.Second, 5*time.Millisecond)
+	return w.Progress()
+}
+
+func TestWarmup(t *testing.T) {
+	ctx := context.Background()
+	db_repo := newMemoryRepository()
+	refs := []model.FileRef{{Bucket: model.DefaultBucket, Hash: "aaaa"}, {Bucket: "photos", Hash: "bbbb"}, {Bucket: model.DefaultBucket, Hash: "cccc"}}
+	for _, ref := range refs {
+		db_repo.AddFile(ctx, &model.StoredFile{Bucket: ref.Bucket, IDHash: ref.Hash, Content: []byte(ref.Hash)})
+	}
+	stats := database.NewStatsController(&staticStats{refs: refs})
+
+	t.Run("TestPopular", func(t *testing.T) {
+		cache_repo := newMemoryRepository()
+		w := warmup.New(database.New(db_repo), database.New(cache_repo), stats, 0, zap.NewNop().Sugar())
+
+		err := w.Start(ctx, warmup.Request{Strategy: warmup.StrategyPopular, Count: 2})
+		assert.Nil(t, err)
+
+		p := waitDone(t, w)
+		assert.Equal(t, 2, p.Total)
+		assert.Equal(t, 2, p.Loaded)
+		_, err = cache_repo.GetFile(ctx, model.DefaultBucket, "aaaa")
+		assert.Nil(t, err)
+		_, err = cache_repo.GetFile(ctx, "photos", "bbbb")
+		assert.Nil(t, err)
+		_, err = cache_repo.GetFile(ctx, model.DefaultBucket, "cccc")
+		assert.ErrorIs(t, err, repository.ErrKeyDoesNotExist)
+	})
+
+	t.Run("TestExplicitHashes", func(t *testing.T) {
+		cache_repo := newMemoryRepository()
+		w := warmup.New(database.New(db_repo), database.New(cache_repo), stats, 100, zap.NewNop().Sugar())
+
+		err := w.Start(ctx, warmup.Request{Strategy: warmup.StrategyPopular, Hashes: []string{"cccc", "zzzz"}})
+		assert.Nil(t, err)
+
+		p := waitDone(t, w)
+		assert.Equal(t, 1, p.Loaded)
+		assert.Equal(t, 1, p.Failed)
+		assert.NotEmpty(t, p.LastError)
+	})
+
+	t.Run("TestUnknownStrategy", func(t *testing.T) {
+		w := warmup.New(database.New(db_repo), database.New(newMemoryRepository()), stats, 0, zap.NewNop().Sugar())
+		err := w.Start(ctx, warmup.Request{Strategy: "random", Count: 1})
+		assert.ErrorIs(t, err, warmup.ErrUnknownStrategy)
+		assert.False(t, w.Progress().Running)
+	})
+	t.Run("TestInvalidCount", func(t *testing.T) {
+		w := warmup.New(database.New(db_repo), database.New(newMemoryRepository()), stats, 0, zap.NewNop().Sugar())
+		for _, count := range []int{0, -1, warmup.MaxCount + 1} {
+			err := w.Start(ctx, warmup.Request{Strategy: warmup.StrategyPopular, Count: count})
+			assert.ErrorIs(t, err, warmup.ErrInvalidCount)
+		}
+		assert.False(t, w.Progress().Running)
+	})
+}